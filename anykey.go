@@ -0,0 +1,38 @@
+package cmap
+
+import "fmt"
+
+// encodeKey 会将任意类型的键编码为字符串
+func (c *myConcurrentMap) encodeKey(key interface{}) (string, error) {
+	if s, ok := key.(string); ok {
+		return s, nil
+	}
+	if c.opts.keyEncoder == nil {
+		return "", newIllegalParameterError(fmt.Sprintf("no key encoder for key type %T", key))
+	}
+	return c.opts.keyEncoder(key)
+}
+
+func (c *myConcurrentMap) PutAny(key interface{}, element interface{}) (bool, error) {
+	k, err := c.encodeKey(key)
+	if err != nil {
+		return false, err
+	}
+	return c.Put(k, element)
+}
+
+func (c *myConcurrentMap) GetAny(key interface{}) (interface{}, error) {
+	k, err := c.encodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return c.Get(k), nil
+}
+
+func (c *myConcurrentMap) DeleteAny(key interface{}) (bool, error) {
+	k, err := c.encodeKey(key)
+	if err != nil {
+		return false, err
+	}
+	return c.Delete(k), nil
+}
@@ -0,0 +1,56 @@
+package cmap
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+type testingCompositeKey struct {
+	Tenant string
+	ID     int
+}
+
+func TestCmapAnyKey(t *testing.T) {
+	encoder := func(key interface{}) (string, error) {
+		k, ok := key.(testingCompositeKey)
+		if !ok {
+			return "", errors.New("unsupported key type")
+		}
+		return fmt.Sprintf("%q/%d", k.Tenant, k.ID), nil
+	}
+	cm, _ := NewConcurrentMap(4, nil, WithKeyEncoder(encoder))
+	keys := []testingCompositeKey{{"a", 1}, {"a", 2}, {"b", 1}, {"a/1", 0}}
+	for i, key := range keys {
+		if ok, err := cm.PutAny(key, i); err != nil || !ok {
+			t.Fatalf("Couldn't put pair {%v: %d}! (error: %v)", key, i, err)
+		}
+	}
+	if cm.Len() != uint64(len(keys)) {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d", len(keys), cm.Len())
+	}
+	for i, key := range keys {
+		// 相同的结构体必须命中同一个键值对
+		element, err := cm.GetAny(testingCompositeKey{key.Tenant, key.ID})
+		if err != nil || element != i {
+			t.Fatalf("Inconsistent element: expected: %#v, actual: %#v (error: %v)", i, element, err)
+		}
+	}
+	if _, err := cm.GetAny(1.5); err == nil {
+		t.Fatal("No error when encoding an unsupported key, but should not be the case!")
+	}
+	if element, err := cm.GetAny(`"a"/1`); err != nil || element != 0 {
+		t.Fatalf("Inconsistent element: expected: %#v, actual: %#v (error: %v)", 0, element, err)
+	}
+	if ok, err := cm.DeleteAny(keys[0]); err != nil || !ok {
+		t.Fatalf("Couldn't delete key %v! (error: %v)", keys[0], err)
+	}
+	if element, _ := cm.GetAny(keys[0]); element != nil {
+		t.Fatalf("Found a deleted key %v!", keys[0])
+	}
+
+	cm, _ = NewConcurrentMap(4, nil)
+	if _, err := cm.PutAny(keys[0], 1); err == nil {
+		t.Fatal("No error when putting a struct key without an encoder, but should not be the case!")
+	}
+}
@@ -0,0 +1,105 @@
+package cmap
+
+// segmentChanges 代表属于同一散列段的修改
+type segmentChanges struct {
+	puts    []Pair
+	deletes []string
+}
+
+// ApplyChanges 会先按散列段对修改分组，再对每个散列段只加一次锁地依次应用其放入和删除
+// 每个散列段的修改是原子的，但不同散列段的修改不是同时生效的
+// 与 TxSegment 相同，同一个键既被放入又被删除时最终会被删除
+// 元素为 nil 或放入失败的键不计入 putCount
+func (c *myConcurrentMap) ApplyChanges(puts map[string]interface{}, deletes []string) (putCount, delCount int) {
+	var evicted []Pair
+	// 在释放 resizeLock 之后调用
+	defer func() {
+		c.notifyEvicted(evicted)
+	}()
+	if err := c.lockForWrite(); err != nil {
+		return
+	}
+	defer c.resizeLock.RUnlock()
+	segments := c.getSegments()
+	groups := make(map[int]*segmentChanges)
+	groupOf := func(keyHash uint64) *segmentChanges {
+		index := segmentIndex(keyHash, len(segments))
+		g, ok := groups[index]
+		if !ok {
+			g = &segmentChanges{}
+			groups[index] = g
+		}
+		return g
+	}
+	for key, element := range puts {
+		p, err := c.newPair(key, element)
+		if err != nil {
+			continue
+		}
+		g := groupOf(p.Hash())
+		g.puts = append(g.puts, p)
+	}
+	for _, key := range deletes {
+		key = c.normalizeKey(key)
+		g := groupOf(c.opts.hash(key))
+		g.deletes = append(g.deletes, key)
+	}
+	for index, g := range groups {
+		segments[index].Atomic(func(tx SegmentTx) {
+			for _, p := range g.puts {
+				if _, err := c.putInTx(tx, p); err == nil {
+					putCount++
+				}
+			}
+			for _, key := range g.deletes {
+				if deleted, ok := tx.Delete(key); ok {
+					decreaseUint64(&c.total)
+					evicted = append(evicted, deleted)
+					delCount++
+				}
+			}
+		})
+	}
+	return
+}
+
+// GetOrPutMulti 与 ApplyChanges 一样按散列段分组，对每个散列段只加一次锁
+// 元素为 nil 或放入失败的键不会出现在结果中，正在调整并发量时返回 nil
+func (c *myConcurrentMap) GetOrPutMulti(items map[string]interface{}) map[string]interface{} {
+	if err := c.lockForWrite(); err != nil {
+		return nil
+	}
+	defer c.resizeLock.RUnlock()
+	segments := c.getSegments()
+	// 结果以调用方给出的键为键，因此分组时需要同时保留原始的键
+	type item struct {
+		key string
+		p   Pair
+	}
+	groups := make(map[int][]item)
+	for key, element := range items {
+		p, err := c.newPair(key, element)
+		if err != nil {
+			continue
+		}
+		index := segmentIndex(p.Hash(), len(segments))
+		groups[index] = append(groups[index], item{key, p})
+	}
+	results := make(map[string]interface{}, len(items))
+	for index, group := range groups {
+		segments[index].Atomic(func(tx SegmentTx) {
+			for _, it := range group {
+				if existing := tx.Get(it.p.Key()); existing != nil {
+					if element, err := c.decodeElement(existing.Element()); err == nil {
+						results[it.key] = element
+					}
+					continue
+				}
+				if _, err := c.putInTx(tx, it.p); err == nil {
+					results[it.key] = items[it.key]
+				}
+			}
+		})
+	}
+	return results
+}
@@ -0,0 +1,80 @@
+package cmap
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCmapApplyChanges(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	expected := make(map[string]interface{})
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		cm.Put(key, i)
+		expected[key] = i
+	}
+	puts := make(map[string]interface{})
+	var deletes []string
+	for i := 0; i < 150; i += 3 {
+		key := fmt.Sprintf("key-%d", i)
+		puts[key] = -i
+		expected[key] = -i
+	}
+	puts["nil"] = nil
+	for i := 1; i < 200; i += 3 {
+		key := fmt.Sprintf("key-%d", i)
+		deletes = append(deletes, key)
+		delete(expected, key)
+	}
+	putCount, delCount := cm.ApplyChanges(puts, deletes)
+	if putCount != 50 || delCount != 33 {
+		t.Fatalf("Inconsistent counts: expected: %d %d, actual: %d %d", 50, 33, putCount, delCount)
+	}
+	if cm.Len() != uint64(len(expected)) {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", len(expected), cm.Len())
+	}
+	for key, element := range expected {
+		if actual := cm.Get(key); actual != element {
+			t.Fatalf("Inconsistent element of %s: expected: %v, actual: %v", key, element, actual)
+		}
+	}
+	cm.Range(func(key string, element interface{}) bool {
+		if _, ok := expected[key]; !ok {
+			t.Fatalf("Unexpected key %s", key)
+		}
+		return true
+	})
+}
+
+func TestCmapGetOrPutMulti(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	for i := 0; i < 10; i++ {
+		cm.Put(fmt.Sprintf("key-%d", i), "existing")
+	}
+	items := make(map[string]interface{})
+	for i := 0; i < 20; i++ {
+		items[fmt.Sprintf("key-%d", i)] = "new"
+	}
+	items["nil"] = nil
+	results := cm.GetOrPutMulti(items)
+	if len(results) != 20 {
+		t.Fatalf("Inconsistent result count: expected: %d, actual: %d", 20, len(results))
+	}
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		expected := "new"
+		if i < 10 {
+			expected = "existing"
+		}
+		if results[key] != expected || cm.Get(key) != expected {
+			t.Fatalf("Inconsistent element of %s: expected: %v, actual: %v (map: %v)",
+				key, expected, results[key], cm.Get(key))
+		}
+	}
+	if _, ok := results["nil"]; ok || cm.Contains("nil") {
+		t.Fatal("A nil element is put by GetOrPutMulti!")
+	}
+	if cm.Len() != 20 {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", 20, cm.Len())
+	}
+}
@@ -0,0 +1,130 @@
+package cmap
+
+import (
+	"sync"
+	"time"
+)
+
+// AutoTunePolicy 代表自动调整并发量的策略
+// Decide 会在每个统计周期结束时被调用，参数 segmentOps 是本周期内各散列段被访问的次数
+// 返回值 resize 为 true 时会将并发量调整为 newConcurrency
+// 同一个策略只会被一个 goroutine 调用，因此可以保存状态
+type AutoTunePolicy interface {
+	Decide(segmentOps []uint64, concurrency int) (newConcurrency int, resize bool)
+}
+
+// HotSegmentPolicy 代表默认的自动调整策略
+// 当某个散列段连续若干个周期都明显比平均更繁忙时，将并发量翻倍
+// 调整后会冷却若干个周期，且并发量不会超过上限，以避免反复调整
+type HotSegmentPolicy struct {
+	// HotRatio 代表繁忙散列段的访问次数至少是平均值的多少倍
+	HotRatio float64
+	// MinOps 代表一个周期内的总访问次数至少为多少时才进行判断
+	MinOps uint64
+	// HotIntervals 代表需要连续繁忙多少个周期才进行调整
+	HotIntervals int
+	// CooldownIntervals 代表调整之后至少等待多少个周期才能再次调整
+	CooldownIntervals int
+	// MaxConcurrency 代表自动调整的并发量上限
+	MaxConcurrency int
+
+	// hotStreak 代表已连续繁忙的周期数
+	hotStreak int
+	// cooldown 代表剩余的冷却周期数
+	cooldown int
+}
+
+func (p *HotSegmentPolicy) Decide(segmentOps []uint64, concurrency int) (int, bool) {
+	if p.cooldown > 0 {
+		p.cooldown--
+		return concurrency, false
+	}
+	var total, max uint64
+	for _, ops := range segmentOps {
+		total += ops
+		if ops > max {
+			max = ops
+		}
+	}
+	mean := float64(total) / float64(len(segmentOps))
+	if total < p.MinOps || float64(max) < mean*p.HotRatio {
+		p.hotStreak = 0
+		return concurrency, false
+	}
+	if p.hotStreak++; p.hotStreak < p.HotIntervals {
+		return concurrency, false
+	}
+	p.hotStreak = 0
+	newConcurrency := concurrency * 2
+	if newConcurrency > p.MaxConcurrency {
+		newConcurrency = p.MaxConcurrency
+	}
+	if newConcurrency <= concurrency {
+		return concurrency, false
+	}
+	p.cooldown = p.CooldownIntervals
+	return newConcurrency, true
+}
+
+// NewHotSegmentPolicy 会创建一个保守的 HotSegmentPolicy
+func NewHotSegmentPolicy() *HotSegmentPolicy {
+	return &HotSegmentPolicy{
+		HotRatio:          4,
+		MinOps:            1000,
+		HotIntervals:      3,
+		CooldownIntervals: 10,
+		MaxConcurrency:    256,
+	}
+}
+
+// autoTuner 代表自动调整并发量的后台监视器
+type autoTuner struct {
+	policy   AutoTunePolicy
+	interval time.Duration
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// run 会每隔一个周期统计各散列段的访问次数增量并调用策略，直到 stop 被关闭
+// Resize 之后散列段会被替换，此时以新散列段的计数重新开始
+func (at *autoTuner) run(c *myConcurrentMap) {
+	ticker := time.NewTicker(at.interval)
+	defer ticker.Stop()
+	var lastSegments []Segment
+	var lastOps []uint64
+	for {
+		select {
+		case <-at.stop:
+			return
+		case <-ticker.C:
+		}
+		segments := c.getSegments()
+		ops := make([]uint64, len(segments))
+		for i, s := range segments {
+			ops[i] = s.OpCount()
+		}
+		if len(lastSegments) != len(segments) || lastSegments[0] != segments[0] {
+			lastSegments, lastOps = segments, ops
+			continue
+		}
+		deltas := make([]uint64, len(ops))
+		for i := range ops {
+			deltas[i] = ops[i] - lastOps[i]
+		}
+		lastOps = ops
+		if newConcurrency, resize := at.policy.Decide(deltas, len(segments)); resize {
+			// 若正在调整则等待下一次决策
+			c.Resize(newConcurrency)
+		}
+	}
+}
+
+// StopAutoTune 可以重复调用，未启用自动调整时什么也不做
+func (c *myConcurrentMap) StopAutoTune() {
+	if c.autoTuner == nil {
+		return
+	}
+	c.autoTuner.once.Do(func() {
+		close(c.autoTuner.stop)
+	})
+}
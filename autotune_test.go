@@ -0,0 +1,71 @@
+package cmap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHotSegmentPolicy(t *testing.T) {
+	p := &HotSegmentPolicy{HotRatio: 2, MinOps: 10, HotIntervals: 2, CooldownIntervals: 1, MaxConcurrency: 8}
+	hot := []uint64{100, 1, 1, 1}
+	even := []uint64{25, 25, 25, 25}
+	if _, resize := p.Decide(hot, 4); resize {
+		t.Fatal("Resized before the segment is consistently hot!")
+	}
+	if _, resize := p.Decide(even, 4); resize {
+		t.Fatal("Resized for an even workload!")
+	}
+	p.Decide(hot, 4)
+	newConcurrency, resize := p.Decide(hot, 4)
+	if !resize || newConcurrency != 8 {
+		t.Fatalf("Inconsistent decision: expected: %d, actual: %d (resize: %v)", 8, newConcurrency, resize)
+	}
+	// 冷却期间不调整
+	if _, resize := p.Decide(hot, 8); resize {
+		t.Fatal("Resized during the cooldown!")
+	}
+	// 达到上限后不再调整
+	p.Decide(hot, 8)
+	if _, resize := p.Decide(hot, 8); resize {
+		t.Fatal("Resized beyond the max concurrency!")
+	}
+	if _, resize := p.Decide([]uint64{5, 0, 0, 0}, 4); resize {
+		t.Fatal("Resized with too few operations!")
+	}
+}
+
+func TestCmapAutoTune(t *testing.T) {
+	policy := &HotSegmentPolicy{HotRatio: 2, MinOps: 100, HotIntervals: 2, MaxConcurrency: 16}
+	cm, _ := NewConcurrentMap(4, nil, WithAutoTune(true),
+		WithAutoTunePolicy(policy, 10*time.Millisecond))
+	defer cm.StopAutoTune()
+	keys, _ := genKeysInSegment(cm, 5)
+	for _, key := range keys {
+		cm.Put(key, key)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for cm.Concurrency() == 4 {
+		if time.Now().After(deadline) {
+			t.Fatal("The hot segment doesn't trigger a resize!")
+		}
+		for i := 0; i < 1000; i++ {
+			cm.Get(keys[i%len(keys)])
+		}
+	}
+	for _, key := range keys {
+		if cm.Get(key) != key {
+			t.Fatalf("Not found key %s after auto tuning!", key)
+		}
+	}
+	cm.StopAutoTune()
+	cm.StopAutoTune()
+
+	// 未启用时不统计访问次数
+	cm, _ = NewConcurrentMap(4, nil)
+	cm.Put("key", 1)
+	cm.Get("key")
+	if ops := cm.(*myConcurrentMap).getSegments()[cm.SegmentIndexOf("key")].OpCount(); ops != 0 {
+		t.Fatalf("Inconsistent op count: expected: %d, actual: %d", 0, ops)
+	}
+	cm.StopAutoTune()
+}
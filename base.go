@@ -1,5 +1,7 @@
 package cmap
 
+import "time"
+
 const (
 	// DEFAULT_BUCKET_LOAD_FACTOR 代表默认的装载因子。
 	// 当散列段中的某个散列桶的尺寸超过了
@@ -9,9 +11,55 @@ const (
 	DEFAULT_BUCKET_NUMBER int = 16
 	// DEFAULT_BUCKET_MAX_SIZE 代表单个散列桶的默认最大尺寸。
 	DEFAULT_BUCKET_MAX_SIZE uint64 = 1000
+	// MAX_CHAIN_LENGTH 代表遍历单个散列桶的链表时最多访问的键值对数量。
+	// 超过该数量会被认为链表中存在环，以避免无限循环。
+	MAX_CHAIN_LENGTH int = 1 << 20
+	// MAX_GROW_BUCKET_NUMBER 代表 GrowTo 为单个散列段预先分配的散列桶的最大数量。
+	MAX_GROW_BUCKET_NUMBER int = 1 << 24
+)
+
+// DeleteMode 代表删除键值对的方式。
+type DeleteMode uint8
+
+const (
+	// DELETE_MODE_COPY 代表删除时拷贝目标之前的所有节点，使不加锁的读操作总能读到一致的链表，也是默认的方式。
+	DELETE_MODE_COPY DeleteMode = 0
+	// DELETE_MODE_COPY_FREE 代表删除时原地修改链表，读操作需要在散列段的锁的保护下进行。
+	DELETE_MODE_COPY_FREE DeleteMode = 1
 )
 
 const (
+	// DEFAULT_CONCURRENCY 代表默认并发量。
+	DEFAULT_CONCURRENCY int = 16
 	// MAX_CONCURRENCY 代表最大并发量。
 	MAX_CONCURRENCY int = 65536
 )
+
+const (
+	// DEFAULT_MAX_ELEMENT_STRING_LENGTH 代表键值对的字符串形式中元素部分的默认最大字节数。
+	DEFAULT_MAX_ELEMENT_STRING_LENGTH int = 1024
+)
+
+const (
+	// DEFAULT_COUNTER_FLUSH_THRESHOLD 代表 CounterMap 的一个分片中暂存的增量的默认最大个数。
+	DEFAULT_COUNTER_FLUSH_THRESHOLD int = 1024
+)
+
+const (
+	// DEFAULT_METRICS_PREFIX 代表 WriteMetrics 输出的指标名称的默认前缀。
+	DEFAULT_METRICS_PREFIX string = "cmap"
+)
+
+const (
+	// DEFAULT_SOFT_VALUE_MAX_AGE 代表软引用元素默认的最长闲置时间。
+	DEFAULT_SOFT_VALUE_MAX_AGE time.Duration = time.Minute
+)
+
+const (
+	// DEFAULT_REHASH_STEP 代表后台再散列每次迁移的散列桶数量。
+	DEFAULT_REHASH_STEP int = 8
+	// DEFAULT_REHASH_INTERVAL 代表后台再散列两次迁移之间的间隔。
+	DEFAULT_REHASH_INTERVAL time.Duration = 100 * time.Microsecond
+	// DEFAULT_AUTO_TUNE_INTERVAL 代表自动调整并发量的默认统计周期。
+	DEFAULT_AUTO_TUNE_INTERVAL time.Duration = time.Second
+)
@@ -0,0 +1,99 @@
+package cmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+)
+
+// MarshalBinary 生成的格式为：uvarint 编码的键值对数量，
+// 然后是每个键值对的 uvarint 长度前缀的键和 uvarint 长度前缀的元素 gob 数据
+// 所有元素属于同一个 gob 流，类型定义只会写入一次，因此必须按顺序解码
+// 元素以 interface{} 的形式编码，非内置类型的元素必须先通过 gob.Register 注册，
+// 且每个元素都会携带其类型名，元素很小时未必比 JSON 紧凑
+// 与 StreamJSON 相同，不同散列段的内容不是同一时刻的快照
+func (c *myConcurrentMap) MarshalBinary() ([]byte, error) {
+	var body, chunk bytes.Buffer
+	enc := gob.NewEncoder(&chunk)
+	var lenBuf [binary.MaxVarintLen64]byte
+	writeBytes := func(b []byte) {
+		n := binary.PutUvarint(lenBuf[:], uint64(len(b)))
+		body.Write(lenBuf[:n])
+		body.Write(b)
+	}
+	var count uint64
+	for _, s := range c.getSegments() {
+		for key, element := range s.Clone() {
+			element, err := c.decodeElement(element)
+			if err != nil {
+				return nil, err
+			}
+			if element == nil {
+				// 元素已被取走，ReplaceAll 也不接受 nil 元素
+				continue
+			}
+			chunk.Reset()
+			if err := enc.Encode(&element); err != nil {
+				return nil, err
+			}
+			writeBytes([]byte(key))
+			writeBytes(chunk.Bytes())
+			count++
+		}
+	}
+	n := binary.PutUvarint(lenBuf[:], count)
+	data := make([]byte, 0, n+body.Len())
+	data = append(data, lenBuf[:n]...)
+	return append(data, body.Bytes()...), nil
+}
+
+// UnmarshalBinary 会先解码全部数据，成功后再通过 ReplaceAll 整体替换，
+// 因此数据有误时 map 的内容不会改变
+func (c *myConcurrentMap) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return newIllegalParameterError(fmt.Sprintf("malformed binary data: %s", err))
+	}
+	// 每个键值对至少占用两个字节，以此避免按伪造的数量预先分配内存
+	if count > uint64(r.Len())/2 {
+		return newIllegalParameterError("malformed binary data: entry count is too large")
+	}
+	var chunks bytes.Buffer
+	dec := gob.NewDecoder(&chunks)
+	readBytes := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(r.Len()) {
+			return nil, fmt.Errorf("length %d exceeds remaining %d bytes", n, r.Len())
+		}
+		b := make([]byte, n)
+		_, err = io.ReadFull(r, b)
+		return b, err
+	}
+	items := make(map[string]interface{}, count)
+	for i := uint64(0); i < count; i++ {
+		key, err := readBytes()
+		if err != nil {
+			return newIllegalParameterError(fmt.Sprintf("malformed binary data: %s", err))
+		}
+		chunk, err := readBytes()
+		if err != nil {
+			return newIllegalParameterError(fmt.Sprintf("malformed binary data: %s", err))
+		}
+		chunks.Write(chunk)
+		var element interface{}
+		if err := dec.Decode(&element); err != nil {
+			return err
+		}
+		items[string(key)] = element
+	}
+	if r.Len() != 0 {
+		return newIllegalParameterError("malformed binary data: trailing bytes")
+	}
+	return c.ReplaceAll(items)
+}
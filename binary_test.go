@@ -0,0 +1,77 @@
+package cmap
+
+import (
+	"encoding/json"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestCmapBinaryRoundTrip(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	expected := map[string]interface{}{
+		"int":    1,
+		"string": "value",
+		"float":  1.5,
+		"slice":  []float64{1, 2, 3},
+		"":       "empty key",
+	}
+	for key, element := range expected {
+		cm.Put(key, element)
+	}
+	data, err := cm.MarshalBinary()
+	if err != nil {
+		t.Fatalf("An error occurs when marshaling the map: %s", err)
+	}
+
+	cm2, _ := NewConcurrentMap(2, nil)
+	cm2.Put("stale", 1)
+	if err := cm2.UnmarshalBinary(data); err != nil {
+		t.Fatalf("An error occurs when unmarshaling the map: %s", err)
+	}
+	if cm2.Len() != uint64(len(expected)) {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", len(expected), cm2.Len())
+	}
+	for key, element := range expected {
+		if actual := cm2.Get(key); !reflect.DeepEqual(actual, element) {
+			t.Fatalf("Inconsistent element of key %q: expected: %v, actual: %v", key, element, actual)
+		}
+	}
+
+	if err := cm2.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Fatalf("Expected an error for truncated data, but got nil")
+	}
+	if err := cm2.UnmarshalBinary([]byte{0xff, 0xff, 0xff, 0xff, 0x0f}); err == nil {
+		t.Fatalf("Expected an error for a forged entry count, but got nil")
+	}
+	if cm2.Len() != uint64(len(expected)) {
+		t.Fatalf("Map changed after failed unmarshaling: expected length: %d, actual: %d", len(expected), cm2.Len())
+	}
+}
+
+func TestCmapBinarySize(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		vector := make([]float64, 8)
+		for j := range vector {
+			vector[j] = r.Float64()
+		}
+		cm.Put("key-"+strconv.Itoa(i), vector)
+	}
+	data, err := cm.MarshalBinary()
+	if err != nil {
+		t.Fatalf("An error occurs when marshaling the map: %s", err)
+	}
+	items := make(map[string]interface{})
+	cm.Range(func(key string, element interface{}) bool {
+		items[key] = element
+		return true
+	})
+	jsonData, _ := json.Marshal(items)
+	if len(data) >= len(jsonData) {
+		t.Fatalf("Binary data is not smaller than JSON: binary: %d, json: %d", len(data), len(jsonData))
+	}
+	t.Logf("binary: %d bytes, json: %d bytes", len(data), len(jsonData))
+}
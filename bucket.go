@@ -17,6 +17,9 @@ type Bucket interface {
 	GetFirstPair() Pair
 	// 若在调用次方法前已经加了锁，则不要把锁传入！否则必须传入 lock
 	Delete(key string, lock sync.Locker) bool
+	// 删除指定键的键值对并返回被删除的键值对
+	// 若在调用次方法前已经加了锁，则不要把锁传入！否则必须传入 lock
+	DeleteAndReturn(key string, lock sync.Locker) (Pair, bool)
 	// 清空当前散列桶
 	// 若在调用次方法前已经加了锁，则不要把锁传入！否则必须传入 lock
 	Clear(lock sync.Locker)
@@ -57,13 +60,19 @@ func (b *bucket) Put(p Pair, lock sync.Locker) (bool, error) {
 
 	firstPair := b.GetFirstPair()
 	if firstPair == nil {
+		// p 可能来自另一条链表，不能保留其原有的后继
+		p.SetNext(nil)
 		b.firstValue.Store(p)
 		atomic.AddUint64(&b.size, 1)
 		return true, nil
 	}
 	var target Pair
 	key := p.Key()
+	var n int
 	for v := firstPair; v != nil; v = v.Next() {
+		if n++; n > MAX_CHAIN_LENGTH {
+			return false, newCyclicChainError()
+		}
 		if v.Key() == key {
 			target = v
 			break
@@ -71,6 +80,8 @@ func (b *bucket) Put(p Pair, lock sync.Locker) (bool, error) {
 	}
 	if target != nil {
 		target.SetElement(p.Element())
+		target.SetExpiry(p.Expiry())
+		target.SetChecksum(p.Checksum())
 		return false, nil
 	}
 	// 新加入的键值对做表头，因此可以并发安全的 get 键值对
@@ -85,19 +96,30 @@ func (b *bucket) Put(p Pair, lock sync.Locker) (bool, error) {
 // 删除逻辑：将要删除目标键值对的前置节点拷贝，
 // 再接在目标键值对后一个节点前
 func (b *bucket) Delete(key string, lock sync.Locker) bool {
+	_, ok := b.DeleteAndReturn(key, lock)
+	return ok
+}
+
+// DeleteAndReturn 返回的是被删除的原键值对而不是其副本，
+// 因此其中的元素就是删除前的元素
+func (b *bucket) DeleteAndReturn(key string, lock sync.Locker) (Pair, bool) {
 	if lock != nil {
 		lock.Lock()
 		defer lock.Unlock()
 	}
 	firstPair := b.GetFirstPair()
 	if firstPair == nil {
-		return false
+		return nil, false
 	}
 
 	var prevPairs []Pair
 	var target Pair
 	var breakpoint Pair
 	for v := firstPair; v != nil; v = v.Next() {
+		if len(prevPairs) >= MAX_CHAIN_LENGTH {
+			// 链表中存在环，拷贝前置节点只会复制出同样的环
+			return nil, false
+		}
 		if v.Key() == key {
 			target = v
 			breakpoint = v.Next()
@@ -106,7 +128,7 @@ func (b *bucket) Delete(key string, lock sync.Locker) bool {
 		prevPairs = append(prevPairs, v)
 	}
 	if target == nil {
-		return false
+		return nil, false
 	}
 	newFirstPair := breakpoint
 	for i := len(prevPairs) - 1; i >= 0; i-- {
@@ -119,9 +141,46 @@ func (b *bucket) Delete(key string, lock sync.Locker) bool {
 	} else {
 		b.firstValue.Store(placeholder)
 	}
-	atomic.AddUint64(&b.size, ^uint64(0))
+	decreaseUint64(&b.size)
 
-	return true
+	return target, true
+}
+
+// inPlaceDeleter 代表能够不拷贝前置节点而原地删除键值对的散列桶。
+// DELETE_MODE_COPY_FREE 模式下散列段使用它删除键值对。
+type inPlaceDeleter interface {
+	// deleteInPlace 与 DeleteAndReturn 相同，但直接修改前一个节点的 next
+	// 注意！必须在锁的保护下调用该方法
+	deleteInPlace(key string) (Pair, bool)
+}
+
+// deleteInPlace 不会修改被删除的节点，其 next 仍然指向原来的后继，
+// 因此正停留在该节点上的不加锁的遍历仍能走完链表，只是可能读到刚被删除的键值对
+func (b *bucket) deleteInPlace(key string) (Pair, bool) {
+	var prev Pair
+	var n int
+	for v := b.GetFirstPair(); v != nil; v = v.Next() {
+		if n++; n > MAX_CHAIN_LENGTH {
+			return nil, false
+		}
+		if v.Key() != key {
+			prev = v
+			continue
+		}
+		next := v.Next()
+		if prev != nil {
+			if err := prev.SetNext(next); err != nil {
+				return nil, false
+			}
+		} else if next != nil {
+			b.firstValue.Store(next)
+		} else {
+			b.firstValue.Store(placeholder)
+		}
+		decreaseUint64(&b.size)
+		return v, true
+	}
+	return nil, false
 }
 
 func (b *bucket) Get(key string) Pair {
@@ -129,7 +188,7 @@ func (b *bucket) Get(key string) Pair {
 	if firstPair == nil {
 		return nil
 	}
-	for v := firstPair; v != nil; v = v.Next() {
+	for v, n := firstPair, 0; v != nil && n < MAX_CHAIN_LENGTH; v, n = v.Next(), n+1 {
 		if v.Key() == key {
 			return v
 		}
@@ -151,10 +210,11 @@ func (b *bucket) Size() uint64 {
 	return atomic.LoadUint64(&b.size)
 }
 
+// String 使用每个键值对的 String 方法，其中过长的元素会按 SetMaxElementStringLength 截断
 func (b *bucket) String() string {
 	var buf bytes.Buffer
 	buf.WriteString("[ ")
-	for v := b.GetFirstPair(); v != nil; v = v.Next() {
+	for v, n := b.GetFirstPair(), 0; v != nil && n < MAX_CHAIN_LENGTH; v, n = v.Next(), n+1 {
 		buf.WriteString(v.String())
 		buf.WriteString(" ")
 	}
@@ -162,6 +222,22 @@ func (b *bucket) String() string {
 	return buf.String()
 }
 
+// chainHasCycle 使用 Floyd 判圈算法检查以 first 为表头的链表中是否存在环
+func chainHasCycle(first Pair) bool {
+	slow, fast := first, first
+	for fast != nil {
+		if fast = fast.Next(); fast == nil {
+			return false
+		}
+		fast = fast.Next()
+		slow = slow.Next()
+		if fast != nil && fast == slow {
+			return true
+		}
+	}
+	return false
+}
+
 func newBucket() Bucket {
 	b := &bucket{}
 	b.firstValue.Store(placeholder)
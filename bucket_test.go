@@ -3,6 +3,7 @@ package cmap
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -291,6 +292,51 @@ func TestBucketClear(t *testing.T) {
 	}
 }
 
+func TestBucketDeleteWhenSizeIsZero(t *testing.T) {
+	testCases := genNoRepetitiveTestingPairs(2)
+	b := newBucket()
+	for _, p := range testCases {
+		b.Put(p, nil)
+	}
+	// 模拟未加锁的 Clear 与 Delete 竞争：尺寸已被清零而链表中仍有键值对
+	atomic.StoreUint64(&b.(*bucket).size, 0)
+	for _, p := range testCases {
+		if !b.Delete(p.Key(), nil) {
+			t.Fatalf("Couldn't delete a pair from bucket! (pair: %#v)", p)
+		}
+		if b.Size() != 0 {
+			t.Fatalf("Inconsistent size: expected: %d, actual: %d",
+				0, b.Size())
+		}
+	}
+}
+
+func TestBucketCyclicChain(t *testing.T) {
+	testCases := genNoRepetitiveTestingPairs(3)
+	b := newBucket()
+	for _, p := range testCases {
+		b.Put(p, nil)
+	}
+	if chainHasCycle(b.GetFirstPair()) {
+		t.Fatal("Found a cycle in an intact chain!")
+	}
+	// 表头是最后放入的键值对，将表尾链接回表头形成环
+	testCases[0].SetNext(b.GetFirstPair())
+	if !chainHasCycle(b.GetFirstPair()) {
+		t.Fatal("Not found the cycle in a cyclic chain!")
+	}
+	// 以下操作都必须能够结束
+	if p := b.Get("nonexistent"); p != nil {
+		t.Fatalf("Found a nonexistent pair %#v!", p)
+	}
+	if b.Delete("nonexistent", nil) {
+		t.Fatal("Deleted a nonexistent pair!")
+	}
+	if _, err := b.Put(&pair{key: "new", hash: 1}, nil); err == nil {
+		t.Fatal("No error when putting a pair into a cyclic chain, but should not be the case!")
+	}
+}
+
 func TestBucketClearInParallel(t *testing.T) {
 	number := 1000
 	testCases := genTestingPairs(number)
@@ -0,0 +1,80 @@
+package cmap
+
+// Builder 用于以链式调用的方式创建并发安全 map
+// 所有参数都在 Build 时统一校验
+type Builder struct {
+	concurrency       int
+	bucketNumber      int
+	loadFactor        float64
+	hash              func(key string) uint64
+	pairRedistributor PairRedistributor
+	opts              []Option
+}
+
+// Concurrency 用于设置并发量，默认为 DEFAULT_CONCURRENCY
+func (b *Builder) Concurrency(n int) *Builder {
+	b.concurrency = n
+	return b
+}
+
+// Buckets 用于设置每个散列段初始的散列桶数量，默认为 DEFAULT_BUCKET_NUMBER
+func (b *Builder) Buckets(n int) *Builder {
+	b.bucketNumber = n
+	return b
+}
+
+// LoadFactor 用于设置默认再分布器的装载因子，默认为 DEFAULT_BUCKET_LOAD_FACTOR
+func (b *Builder) LoadFactor(f float64) *Builder {
+	b.loadFactor = f
+	return b
+}
+
+// Hash 用于设置散列函数，默认使用BKDR哈希算法
+func (b *Builder) Hash(fn func(key string) uint64) *Builder {
+	b.hash = fn
+	return b
+}
+
+// PairRedistributor 用于设置再分布器，为 nil 时使用默认的再分布器
+// 设置的再分布器被所有散列段共用，必须是并发安全的
+func (b *Builder) PairRedistributor(pr PairRedistributor) *Builder {
+	b.pairRedistributor = pr
+	return b
+}
+
+// With 用于追加其他可选配置项
+func (b *Builder) With(opts ...Option) *Builder {
+	b.opts = append(b.opts, opts...)
+	return b
+}
+
+// Build 会校验所有参数并创建并发安全 map
+// 并发量超过上限时与 NewConcurrentMap 一样返回 ConcurrencyLimitError，其他不合法的参数返回 IllegalParameterError
+func (b *Builder) Build() (ConcurrentMap, error) {
+	if b.bucketNumber <= 0 {
+		return nil, newIllegalParameterError("bucket number is too small")
+	}
+	if b.loadFactor <= 0 {
+		return nil, newIllegalParameterError("load factor is too small")
+	}
+	if b.hash == nil {
+		return nil, newIllegalParameterError("hash function is nil")
+	}
+	opts := []Option{
+		WithBucketNumber(b.bucketNumber),
+		WithLoadFactor(b.loadFactor),
+		WithHash(b.hash),
+	}
+	opts = append(opts, b.opts...)
+	return NewConcurrentMap(b.concurrency, b.pairRedistributor, opts...)
+}
+
+// NewBuilder 会创建一个使用默认参数的 Builder
+func NewBuilder() *Builder {
+	return &Builder{
+		concurrency:  DEFAULT_CONCURRENCY,
+		bucketNumber: DEFAULT_BUCKET_NUMBER,
+		loadFactor:   DEFAULT_BUCKET_LOAD_FACTOR,
+		hash:         hash,
+	}
+}
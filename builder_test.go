@@ -0,0 +1,110 @@
+package cmap
+
+import "testing"
+
+func TestBuilderBuild(t *testing.T) {
+	cm, err := NewBuilder().Build()
+	if err != nil {
+		t.Fatalf("An error occurs when building a cmap with default options: %s", err)
+	}
+	if cm.Concurrency() != DEFAULT_CONCURRENCY {
+		t.Fatalf("Inconsistent concurrency: expected: %d, actual: %d",
+			DEFAULT_CONCURRENCY, cm.Concurrency())
+	}
+
+	var hashCalls int
+	customHash := func(key string) uint64 {
+		hashCalls++
+		return hashFNV1a(key)
+	}
+	cm, err = NewBuilder().
+		Concurrency(4).
+		Buckets(2).
+		LoadFactor(0.5).
+		Hash(customHash).
+		Build()
+	if err != nil {
+		t.Fatalf("An error occurs when building a cmap: %s", err)
+	}
+	if cm.Concurrency() != 4 {
+		t.Fatalf("Inconsistent concurrency: expected: %d, actual: %d", 4, cm.Concurrency())
+	}
+	for _, s := range cm.(*myConcurrentMap).getSegments() {
+		if n := s.(*segment).bucketsLen; n != 2 {
+			t.Fatalf("Inconsistent bucket number: expected: %d, actual: %d", 2, n)
+		}
+		pr := s.(*segment).pairRedistributor.(*myPairRedistributor)
+		if pr.loadFactor != 0.5 {
+			t.Fatalf("Inconsistent load factor: expected: %f, actual: %f", 0.5, pr.loadFactor)
+		}
+	}
+	for _, p := range genNoRepetitiveTestingPairs(100) {
+		cm.Put(p.Key(), p.Element())
+		if actual := cm.Get(p.Key()); actual != p.Element() {
+			t.Fatalf("Inconsistent element: expected: %#v, actual: %#v", p.Element(), actual)
+		}
+	}
+	if hashCalls == 0 {
+		t.Fatal("Custom hash function is never called!")
+	}
+
+	var hookCalled bool
+	cm, err = NewBuilder().
+		Concurrency(1).
+		With(WithRedistributeHook(func(int, int, int) { hookCalled = true })).
+		Build()
+	if err != nil {
+		t.Fatalf("An error occurs when building a cmap: %s", err)
+	}
+	for _, p := range genNoRepetitiveTestingPairs(10000) {
+		cm.Put(p.Key(), p.Element())
+	}
+	if !hookCalled {
+		t.Fatal("Option passed to With doesn't take effect!")
+	}
+}
+
+func TestBuilderValidation(t *testing.T) {
+	testCases := map[string]*Builder{
+		"zero concurrency":     NewBuilder().Concurrency(0),
+		"zero buckets":         NewBuilder().Buckets(0),
+		"negative load factor": NewBuilder().LoadFactor(-1),
+		"nil hash":             NewBuilder().Hash(nil),
+	}
+	for name, b := range testCases {
+		t.Run(name, func(t *testing.T) {
+			cm, err := b.Build()
+			if err == nil {
+				t.Fatal("No error when building with an invalid option, but should not be the case!")
+			}
+			if _, ok := err.(IllegalParameterError); !ok {
+				t.Fatalf("Inconsistent error type: expected: %T, actual: %T",
+					IllegalParameterError{}, err)
+			}
+			if cm != nil {
+				t.Fatalf("Built a cmap with an invalid option: %#v", cm)
+			}
+		})
+	}
+}
+
+func TestBuilderConcurrencyLimit(t *testing.T) {
+	limit := 8
+	cm, err := NewBuilder().Concurrency(limit + 1).With(WithMaxConcurrency(limit)).Build()
+	if cm != nil {
+		t.Fatalf("Built a cmap with too large concurrency: %#v", cm)
+	}
+	cle, ok := err.(ConcurrencyLimitError)
+	if !ok {
+		t.Fatalf("Inconsistent error type: expected: %T, actual: %T", ConcurrencyLimitError{}, err)
+	}
+	if cle.Requested != limit+1 || cle.Limit != limit {
+		t.Fatalf("Inconsistent concurrency limit error: expected: %d/%d, actual: %d/%d",
+			limit+1, limit, cle.Requested, cle.Limit)
+	}
+	if _, err := NewBuilder().Concurrency(MAX_CONCURRENCY + 1).Build(); err == nil {
+		t.Fatal("No error when building with too large concurrency, but should not be the case!")
+	} else if _, ok := err.(ConcurrencyLimitError); !ok {
+		t.Fatalf("Inconsistent error type: expected: %T, actual: %T", ConcurrencyLimitError{}, err)
+	}
+}
@@ -0,0 +1,26 @@
+package cmap
+
+// VerifyChecksums 在每个散列段的锁的保护下重新计算元素的校验和，
+// 而所有修改元素的操作也都在散列段的锁的保护下更新校验和，因此不会把并发的更新误报为外部修改
+// 元素已被 TakeElement 取走的键会被跳过
+func (c *myConcurrentMap) VerifyChecksums() []string {
+	if c.opts.elementChecksum == nil {
+		return nil
+	}
+	var keys []string
+	for _, s := range c.getSegments() {
+		s.Atomic(func(tx SegmentTx) {
+			tx.Range(func(p Pair) bool {
+				element := p.Element()
+				if _, ok := element.(emptyElement); ok {
+					return true
+				}
+				if c.opts.elementChecksum(element) != p.Checksum() {
+					keys = append(keys, p.Key())
+				}
+				return true
+			})
+		})
+	}
+	return keys
+}
@@ -0,0 +1,48 @@
+package cmap
+
+import (
+	"hash/fnv"
+	"testing"
+)
+
+func checksumOfBytes(element interface{}) uint64 {
+	b, ok := element.([]byte)
+	if !ok {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write(b)
+	return h.Sum64()
+}
+
+func TestCmapVerifyChecksums(t *testing.T) {
+	cm, _ := NewConcurrentMap(2, nil, WithElementChecksum(checksumOfBytes))
+	shared := []byte("shared")
+	cm.Put("a", shared)
+	cm.Put("b", []byte("private"))
+	cm.Put("c", []byte("replaced"))
+	cm.Put("c", []byte("replacement"))
+	if keys := cm.VerifyChecksums(); len(keys) != 0 {
+		t.Fatalf("Inconsistent mutated keys: expected: %v, actual: %v", []string{}, keys)
+	}
+	_, version, _ := cm.LoadVersioned("b")
+	cm.CompareVersionAndSwap("b", version, []byte("swapped"))
+	cm.TakeElement("c")
+
+	// 在外部修改共享的元素
+	shared[0] = 'S'
+	keys := cm.VerifyChecksums()
+	if len(keys) != 1 || keys[0] != "a" {
+		t.Fatalf("Inconsistent mutated keys: expected: %v, actual: %v", []string{"a"}, keys)
+	}
+	cm.Put("a", []byte("fresh"))
+	if keys := cm.VerifyChecksums(); len(keys) != 0 {
+		t.Fatalf("Inconsistent mutated keys: expected: %v, actual: %v", []string{}, keys)
+	}
+
+	cm, _ = NewConcurrentMap(2, nil)
+	cm.Put("a", shared)
+	if keys := cm.VerifyChecksums(); keys != nil {
+		t.Fatalf("Got mutated keys without checksum: %v", keys)
+	}
+}
@@ -1,8 +1,19 @@
 package cmap
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
+	"unsafe"
 )
 
 // 并发安全 map 的接口
@@ -13,49 +24,733 @@ type ConcurrentMap interface {
 	// 第一个返回值表示是否新增了键值对
 	// 若键已存在，新元素将替换旧元素
 	Put(key string, element interface{}) (bool, error)
+	// 返回给定键所在散列段的索引，有效范围是 [0, Concurrency())
+	// 注意！Resize 之后索引会失效
+	SegmentIndexOf(key string) int
+	// 将键值对直接放入索引为 segmentIndex 的散列段
+	// 若键不属于该散列段则不会放入并返回 IllegalParameterError
+	PutInSegment(segmentIndex int, key string, element interface{}) (bool, error)
+	// 以下三个方法会先使用 WithKeyEncoder 设置的编码函数将 key 编码为字符串，再执行对应的操作
+	// string 类型的 key 不经编码直接使用；未设置编码函数时其他类型的 key 会导致 IllegalParameterError
+	PutAny(key interface{}, element interface{}) (bool, error)
+	GetAny(key interface{}) (interface{}, error)
+	DeleteAny(key interface{}) (bool, error)
+	// 若键已存在则返回已有元素，第二个返回值为 true
+	// 否则放入给定元素并将其返回，第二个返回值为 false
+	// 设置了 WithKeyNormalizer 时按规范化后的键判断是否存在
+	// 注意！element 不能为 nil
+	GetOrPut(key string, element interface{}) (interface{}, bool, error)
+	// 与 GetOrPut 相同，但不返回已有元素，第一个返回值表示键是否已存在
+	// 规范化后相等的键视为同一个键，只有第一次会放入
+	PutIfAbsent(key string, element interface{}) (loaded bool, err error)
+	// 与 GetOrPut 相同，但只有键不存在时才会调用 f 构造元素
+	// 同一个缺失的键的 f 最多只会被调用一次
+	// f 返回 nil 或放入失败时返回 nil 和 false
+	// 注意！回调执行期间持有散列段的写锁，同一散列段的读写操作都会被阻塞，在回调中调用当前 map 的方法会导致死锁
+	LoadOrStoreFunc(key string, f func() interface{}) (interface{}, bool)
+	// 返回键对应的切片的指针，键不存在时放入一个新的空切片，用于把元素累积到每个键的切片中
+	// 同一个键的所有调用方得到的是同一个指针；键的元素不是 *[]interface{} 或已被取走时返回 nil
+	// 注意！map 只保证切片的创建是并发安全的，通过指针读写切片时需要调用方自行同步；
+	// 设置了编解码函数时存放的是编码后的元素，对返回的指针的修改不会反映到 map 中
+	GetOrPutSlice(key string) *[]interface{}
+	// 在散列段的锁的保护下，键不存在时放入 insert 的返回值，
+	// 键已存在时放入 update 对已有元素的处理结果，返回放入的元素
+	// 注意！回调执行期间持有散列段的写锁，同一散列段的读写操作都会被阻塞，在回调中调用当前 map 的方法会导致死锁
+	Upsert(key string, insert func() interface{}, update func(existing interface{}) interface{}) (interface{}, error)
+	// 在散列段的锁的保护下以原有元素调用 f 并放入其返回值，返回原有元素、放入的元素以及键原本是否存在
+	// f 返回 nil 或放入失败时不修改 map，此时返回的 newElement 为 nil
+	// 注意！回调执行期间持有散列段的写锁，同一散列段的读写操作都会被阻塞，在回调中调用当前 map 的方法会导致死锁
+	GetAndUpdate(key string, f func(old interface{}, exists bool) interface{}) (old, newElement interface{}, existed bool)
+	// 键已存在时在散列段的锁的保护下以已有元素和 incoming 调用 merge，并放入其返回值，用于求和、追加等累积操作
+	// 键不存在或元素已被取走时直接放入 incoming，此时不调用 merge；返回放入的元素
+	// merge 返回 nil 时不修改 map 并返回 IllegalParameterError
+	// 注意！回调执行期间持有散列段的写锁，同一散列段的读写操作都会被阻塞，在回调中调用当前 map 的方法会导致死锁
+	MergeKey(key string, incoming interface{}, merge func(existing, incoming interface{}) interface{}) (interface{}, error)
+	// 返回所有键值对的快照，并在同一次加锁中把每个元素替换为 reset 的返回值，用于周期性地取出计数的增量
+	// 热点键的 Increment 不加锁，与重置并发的累加可能既不在快照中也不在重置后的元素中
+	// reset 返回 nil 时删除该键；元素已被取走的键不会出现在快照中；reset 为 nil 或正在调整并发量时返回 nil
+	// 注意！回调执行期间持有散列段的写锁，同一散列段的读写操作都会被阻塞，在回调中调用当前 map 的方法会导致死锁
+	SnapshotAndReset(reset func(key string, element interface{}) interface{}) map[string]interface{}
+	// 原子地把 oldKey 的元素移到 newKey，oldKey 不存在、元素已被取走或 newKey 已存在时返回 false
+	// 两个键可能位于不同的散列段，期间两个散列段的读写操作都会被阻塞
+	Rename(oldKey, newKey string) bool
+	// 将 src 中满足 filter 的键值对复制到当前 map 中，返回复制的数量
+	// filter 为 nil 时复制全部键值对
+	WarmFrom(src ConcurrentMap, filter func(key string, element interface{}) bool) int
 	// 若返回 nil 说明键不存在
+	// 返回的是 map 中存放的元素本身而不是其副本，指针类型的元素与 map 中的指向同一个值
+	// 未设置 WithElementCodec 时如此，否则返回的是解码后的新值
+	// 设置了 WithBackingStore 时，未命中的键会从后备存储中读取并放入 map
 	Get(key string) interface{}
+	// 返回指针类型元素的指针值，第二个返回值表示键是否存在且元素是指针类型
+	// 通过返回值修改其指向的值会被 map 看到，但并发修改需要调用方自行同步
+	// 注意！设置了 WithElementCodec 时 map 中存放的是编码后的元素，因此总是返回 nil 和 false
+	LoadPointer(key string) (unsafe.Pointer, bool)
+	// 与 Get 相同，但不会统计访问次数或记录使用时间，因此不影响 LeastFrequent 和软引用元素的回收
+	// 第二个返回值表示是否读到了元素
+	Peek(key string) (interface{}, bool)
+	// 与 Get 相同，同时返回键的散列值、所在的散列段和散列桶、在链表中的位置以及访问次数
+	// 第三个返回值表示键是否存在，键不存在时仍会返回其散列值和应当所在的位置
+	LoadWithMeta(key string) (element interface{}, meta EntryMeta, ok bool)
+	// 返回一个只能读取当前 map 的查找函数，其行为与 Get 相同，第二个返回值表示是否读到了元素
+	// 返回的函数可以被并发调用，且在 Resize 之后依然有效
+	AsLookupFunc() func(key string) (interface{}, bool)
+	// 返回键是否存在
+	Contains(key string) bool
+	// 与 Get 相同，但会返回 WithElementCodec 设置的解码函数返回的错误
+	// 以及达到 WithMaxLookupDepth 设置的上限时的 ChainTooDeepError
+	// 键不存在时返回 nil 和 nil
+	GetWithError(key string) (interface{}, error)
+	// 返回每个给定键是否存在，返回值的键就是 keys 中的键
+	// 同一散列段的键只加一次锁，且不会读取元素
+	ContainsMulti(keys []string) map[string]bool
+	// 返回元素的动态类型，第二个返回值表示键是否存在
+	ElementType(key string) (reflect.Type, bool)
+	// 与 Get 相同但不获取散列段的锁，也不会统计访问次数或记录使用时间
+	// 可能读不到刚刚开始但尚未完成的写操作，散列段再分布期间还可能读不到已存在的键
+	// 但不会读到损坏的元素
+	GetStale(key string) interface{}
+	// 与 Get 相同，但若未读到键且读取期间散列段发生了结构性修改，则重试，至多读取 attempts 次
+	// 用于减少并发删除其他键引起的误判
+	GetWithRetry(key string, attempts int) interface{}
+	// 按 keys 的顺序返回对应的元素，不存在的键对应位置为 nil
+	GetOrdered(keys []string) []interface{}
+	// 把 keys 中存在的键及其元素放入调用方提供的 dst，不存在的键和元素已被取走的键不会放入
+	// dst 可以在多次调用之间复用以减少分配，默认不会清空 dst 中原有的内容，
+	// 设置了 WithGetIntoReset 时会先清空；dst 为 nil 时不做任何事
+	GetInto(keys []string, dst map[string]interface{})
+	// 若键存在则立即返回其元素，否则阻塞直到键被放入或超时
+	// 第二个返回值表示是否获取到了元素
+	GetOrWait(key string, timeout time.Duration) (interface{}, bool)
+	// 返回元素及其版本号，第三个返回值表示键是否存在
+	LoadVersioned(key string) (interface{}, uint64, bool)
+	// 仅当元素的版本号等于 expectedVersion 时才将其替换为 element
+	// 返回值表示是否替换成功
+	// 注意！键被删除后再放入时版本号会重新计数
+	CompareVersionAndSwap(key string, expectedVersion uint64, element interface{}) bool
+	// 两阶段放入：若键不存在且未被预留则预留该键，committed 为 false，
+	// 之后只能通过 commit 放入元素或通过 cancel 放弃预留，两者只有第一次调用有效
+	// 若键已存在或已被预留，committed 为 true，此时 commit 和 cancel 什么也不做
+	// 注意！以 nil 调用 commit 会放弃预留
+	Reserve(key string) (committed bool, commit func(element interface{}), cancel func())
+	// 批量应用放入和删除，每个散列段只加一次锁，返回实际放入和删除的数量
+	ApplyChanges(puts map[string]interface{}, deletes []string) (putCount, delCount int)
+	// 对 items 中的每个键执行 GetOrPut，每个散列段只加一次锁
+	// 返回每个键最终的元素，即已有的元素或刚放入的元素
+	GetOrPutMulti(items map[string]interface{}) map[string]interface{}
+	// 在同一个散列段的锁的保护下对多个键执行事务
+	// 若 keys 跨越了多个散列段则返回错误
+	TxSegment(keys []string, f func(view map[string]interface{}) (updates map[string]interface{}, deletes []string)) error
 	// 删除指定键值对
 	// 不存在返回 false
 	Delete(key string) bool
+	// 删除指定键值对并返回被删除的元素
+	// 第二个返回值表示键是否存在
+	DeleteAndReturn(key string) (interface{}, bool)
+	// 删除所有与 pattern 匹配的键值对，返回删除的数量
+	DeleteMatching(pattern *regexp.Regexp) int
+	// 把键登记为热点计数键，其 int64 元素会被替换为分片存放的计数器，键不存在时从 0 开始
+	// 之后 Increment 会不加锁地累加到计数器的某个分片上，Get 和 Range 返回各分片之和
+	// Put、Delete 等其他写操作会替换掉计数器，使该键不再是热点键
+	// 元素不是 int64 或设置了 WithElementCodec 时返回 IllegalParameterError
+	MarkHot(key string) error
+	// 把 delta 累加到键的 int64 元素上，键不存在时放入 delta
+	// 热点键的累加不加锁，其他键在散列段的锁的保护下累加
+	// 注意！热点键的计数在并发删除和重置时是有损的：与 Delete、SnapshotAndReset 等替换计数器的操作并发的累加
+	// 可能落在已被替换的计数器上而丢失，此时仍返回 nil
+	Increment(key string, delta int64) error
+	// 取走键对应的元素并保留键，第二个返回值表示是否取到了元素
+	// 元素被取走后 Get 返回 nil，但 Contains 和 LoadVersioned 仍然可以判断键存在
+	// 键不存在或元素已被取走时返回 nil 和 false
+	TakeElement(key string) (interface{}, bool)
+	// 遍历所有键值对，f 返回 false 时停止遍历
+	// 遍历是弱一致的：不会加全局锁，遍历期间的修改不一定可见
+	// 元素已被 TakeElement 取走的键也会被访问，此时 element 为 nil
+	// 遍历期间发生的 Resize、散列桶再分布和后台再散列都不会使开始时已存在的键值对被重复访问或遗漏
+	Range(f func(key string, element interface{}) bool)
+	// 遍历所有键值对，并根据 f 返回的 Action 保留、删除或更新当前键值对
+	// 若键值对在 f 返回之后被其他操作修改过，则其 Action 会被忽略
+	RangeMutable(f func(key string, element interface{}) Action)
+	// 按键的插入顺序遍历键值对，f 返回 false 时停止遍历
+	// 注意！只有启用了插入顺序记录时才有效，否则不会调用 f
+	RangeInOrder(f func(key string, element interface{}) bool)
+	// 返回最早插入且仍然存在的键值对，第三个返回值表示是否存在这样的键值对
+	// 注意！只有启用了插入顺序记录时才有效，否则返回 false
+	Oldest() (key string, element interface{}, ok bool)
+	// 返回最晚插入且仍然存在的键值对，第三个返回值表示是否存在这样的键值对
+	// 注意！只有启用了插入顺序记录时才有效，否则返回 false
+	Newest() (key string, element interface{}, ok bool)
+	// 返回一个通道，后台 goroutine 会将所有键值对依次发送到其中，发送完毕后关闭通道
+	Stream() <-chan Entry
+	// 与 Stream 相同，但在 ctx 结束时会提前关闭通道
+	StreamContext(ctx context.Context) <-chan Entry
+	// 若键存在则返回其元素，否则调用 loader 加载元素、放入并返回
+	// 对同一个键的并发加载会被合并，loader 只会被调用一次
+	// loader 返回错误时不会放入任何元素
+	GetWithLoader(key string, loader func(key string) (interface{}, error)) (interface{}, error)
+	// 按 WithSoftValuePolicy 的策略回收闲置过久的键值对，返回回收的数量
+	// 注意！只有启用了软引用元素时才有效，否则返回 0
+	ReclaimSoftValues() int
+	// 放入一个在 ttl 之后过期的键值对，其余与 Put 相同
+	// 过期的键值对在被 DeleteExpired 删除之前仍然可见
+	PutWithTTL(key string, element interface{}, ttl time.Duration) (bool, error)
+	// 删除所有已过期的键值对并返回删除的数量
+	DeleteExpired() int
+	// 返回键对应的元素和剩余的存活时间
+	// 永不过期的键返回的 ttl 为 0，已过期但尚未删除的键返回的 ttl 为负数
+	GetWithTTL(key string) (element interface{}, ttl time.Duration, ok bool)
+	// 按键的散列值升序遍历所有键值对，散列值相同时按键升序，f 返回 false 时停止遍历
+	// 遍历顺序与并发量无关，便于比较不同 map 的导出结果
+	RangeByHash(f func(key string, element interface{}) bool)
+	// 返回所有键，按字典序升序排列
+	// 与 Range 一样是弱一致的，不会加全局锁
+	SortedKeys() []string
+	// 遍历所有以 prefix 开头的键值对，f 返回 false 时停止遍历
+	// 若启用了前缀索引则只访问匹配的键，否则会遍历所有散列段
+	RangePrefix(prefix string, f func(key string, element interface{}) bool)
+	// 遍历所有元素的动态类型恰好为 t 的键值对，f 返回 false 时停止遍历
+	// 类型必须完全相同，t 为接口类型时不会匹配实现了该接口的元素
+	RangeOfType(t reflect.Type, f func(key string, element interface{}) bool)
+	// 逐行读取 r，使用 parse 解析每一行并放入 map，返回成功放入的行数
+	// 遇到第一个解析错误或放入错误时停止并返回该错误
+	LoadFromLines(r io.Reader, parse func(line string) (key string, element interface{}, err error)) (int, error)
+	// 依次读取 r 中每行一个的 JSON 值，使用 decode 解码并放入 map，返回成功放入的数量
+	// 遇到第一个 JSON 语法错误、解码错误或放入错误时停止并返回该错误
+	ImportJSONLines(r io.Reader, decode func(raw json.RawMessage) (key string, element interface{}, err error)) (int, error)
+	// 复制索引为 index 的散列段中的所有键值对
+	// 每次只锁住一个散列段，可用于分批备份
+	// index 的有效范围是 [0, Concurrency())
+	CloneSegment(index int) (map[string]interface{}, error)
+	// 随机返回至多 n 个键值对，用于基于采样的淘汰和监控
+	// 注意！采样是近似均匀的：先随机选择散列段和散列桶，再从桶中随机选择键值对
+	RandomEntries(n int) map[string]interface{}
+	// 返回遍历时最先遇到的至多 n 个键值对，不排序也不随机，用于预览
+	// 键值对数量不少于 n 时恰好返回 n 个
+	Preview(n int) map[string]interface{}
+	// 返回访问次数最少的 n 个键，按访问次数升序排列
+	// 注意！只有启用了访问次数统计时才有效，否则返回 nil
+	LeastFrequent(n int) []string
+	// 返回所有的键，顺序不确定
+	Keys() []string
+	// 返回当前 map 中存在而 other 中不存在的键，顺序不确定
+	// 与 Range 一样是弱一致的，不会加全局锁
+	Difference(other ConcurrentMap) []string
+	// 返回只存在于两个 map 之一中的键，先是只存在于当前 map 中的键，顺序不确定
+	SymmetricDifference(other ConcurrentMap) []string
+	// 与 Keys 相同，但由最多 GOMAXPROCS 个 goroutine 并行地收集各个散列段的键
+	KeysParallel() []string
+	// 使用 sizer 计算每个元素的大小，并按升序的上界 bounds 分组计数
+	// 返回值长度为 len(bounds)+1，第 i 个计数对应大小在 (bounds[i-1], bounds[i]] 内的元素，
+	// 最后一个计数对应大于所有上界的元素
+	ValueSizeHistogram(sizer func(element interface{}) int, bounds []int) []uint64
+	// 逐个散列段地将所有键值对以 JSON 对象的形式写入 w
+	StreamJSON(w io.Writer) error
+	// 以 Prometheus 文本格式写入键值对数量、各散列段的键值对和散列桶数量，
+	// 以及已启用的 Get 命中统计和再分布统计，指标名称的前缀由 WithMetricsPrefix 设置
+	WriteMetrics(w io.Writer) error
+	// 将所有键值对以 CSV 的形式写入 w，每个键值对一行，行的内容由 format 生成
+	WriteCSV(w io.Writer, format func(key string, element interface{}) []string, header []string) error
+	// 将所有键值对编码为紧凑的二进制格式，元素使用 gob 编码
+	MarshalBinary() ([]byte, error)
+	// 以 MarshalBinary 生成的数据整体替换 map 的全部内容
+	UnmarshalBinary(data []byte) error
+	// 将并发量调整为 concurrency，并把所有键值对迁移到新的散列段中
+	// 调整期间其他写操作会阻塞或返回 MapResizingError，读操作读到的是调整前的内容
+	// 不返回错误的写操作（如 Delete、ApplyChanges）此时不做任何修改，按失败返回
+	// 若已有其他调整正在进行，则返回 MapResizingError；超过最大并发量时返回 ConcurrencyLimitError
+	Resize(concurrency int) error
+	// 以 items 整体替换 map 的全部内容
+	// 读操作要么看到替换前的全部内容，要么看到替换后的全部内容
+	// 替换期间完成的写操作会随旧内容一起被丢弃
+	ReplaceAll(items map[string]interface{}) error
+	// 返回散列桶链表中存在环的散列段的索引，用于诊断数据损坏
+	// 正常情况下返回空切片
+	DetectCycles() []int
+	// 返回当前元素的校验和与放入时记录的不一致的键，即元素在放入之后被外部修改过的键
+	// 注意！只有设置了 WithElementChecksum 时才有效，否则返回 nil
+	VerifyChecksums() []string
+	// 检查每个键值对是否位于其散列值对应的散列段和散列桶中，
+	// 返回描述第一个错位的键值对的 MisplacedPairError，全部正确时返回 nil
+	VerifyPlacement() error
+	// 按当前的散列函数重新计算每个键值对的散列值，把不在对应散列段中的键值对移到正确的散列段，返回移动的数量
+	// 期间所有写操作都会被阻塞；注意！在冻结期间调用会导致死锁
+	RebalanceSegments() int
+	// 返回 Put、Get 和 Delete 的耗时统计，键是操作名称
+	// 注意！只有启用了耗时统计时才有效，否则返回 nil
+	OperationLatencies() map[string]LatencyStats
+	// 返回散列桶再分布的次数、移动的键值对数量和累计耗时
+	// 注意！只有启用了 WithStats 时才有效，否则返回零值
+	RedistributionStats() RedistributionStats
+	// 按从早到晚的顺序返回最近的修改，每个修改包含键、操作类型和时间
+	// 注意！只有启用了 WithMutationLog 时才有效，否则返回 nil
+	RecentMutations() []Mutation
+	// 按当前的装载因子为 expectedEntries 个键值对预先扩容每个散列段的散列桶，
+	// 使键值对增长到该数量的过程中不再需要再分布，扩容后的散列桶数量也不会再被收缩
+	GrowTo(expectedEntries uint64) error
+	// 阻塞所有写操作直到调用 Unfreeze，GetOrWait、Reserve 和 VerifyPlacement 之外的读操作不受影响
+	// 冻结期间 Range 等遍历操作可以得到全局一致的结果
+	// 注意！冻结会使整个 map 的写操作串行等待，应尽快解冻；
+	// Freeze 和 Unfreeze 必须成对调用，在同一个 goroutine 中重复冻结或在冻结期间写入会导致死锁
+	Freeze()
+	// 解除冻结，被阻塞的写操作会继续执行
+	Unfreeze()
+	// 结束自动调整并发量的后台 goroutine
+	StopAutoTune()
 	// 返回键值对数量
 	Len() uint64
+	// 逐个数出各散列段中的键值对，若与 Len 使用的计数不一致则修正该计数并返回 true
+	// 期间所有写操作都会被阻塞；注意！在冻结期间调用会导致死锁
+	ReconcileLen() (corrected bool)
+	// 清理辅助结构中不再需要的部分：移除驻留表中没有键值对引用的键，并释放驻留表在键减少后多占用的空间
+	// 驻留表在最后一个引用被删除时就会移除该键，RunGC 主要用于在大量键被删除后回收空间
+	// 注意！只有启用了 WithKeyInterning 时才有效，否则什么也不做
+	RunGC()
+	// 返回与给定键位于同一散列桶中的所有键（包含该键本身）
+	// 用于排查哈希碰撞
+	CollisionChain(key string) []string
 }
 
 type myConcurrentMap struct {
-	// 并发量，也代表了 segments 的长度
-	concurrency int
 	// 一个 segment 代表一个散列值
 	// 分段锁保证并发安全
-	// 长度在初始化是就需要确定且不可更改
-	segments []Segment
+	// 其中存放的是 []Segment，其长度即并发量，只有 Resize 可以整体替换它
+	segments atomic.Value
 	// 键值对数量
 	total uint64
+	// 可选配置
+	opts *options
+	// 创建散列段时使用的再分布器，可以为 nil
+	pairRedistributor PairRedistributor
+	// 表示是否正在调整并发量，为 1 时会使写操作返回 MapResizingError
+	resizing int32
+	// 写操作持有读锁，Resize 持有写锁
+	resizeLock sync.RWMutex
+	// 保护 loads
+	loadLock sync.Mutex
+	// 正在进行中的 GetWithLoader 加载，用于合并对同一个键的并发加载
+	loads map[string]*loadCall
+	// 自动调整并发量的后台监视器，为 nil 表示未启用
+	autoTuner *autoTuner
+	// 由 MarkHot 登记的热点键及其计数器，键是 string，值是 *hotCounter
+	// 可能包含已不再是热点键的过期项，使用前需要确认计数器仍是键的元素
+	hotCounters sync.Map
 }
 
 func (c *myConcurrentMap) Concurrency() int {
-	return c.concurrency
+	return len(c.getSegments())
+}
+
+// 返回当前的散列段切片
+func (c *myConcurrentMap) getSegments() []Segment {
+	return c.segments.Load().([]Segment)
+}
+
+// isResizing 用于判断是否正在调整并发量
+func (c *myConcurrentMap) isResizing() bool {
+	return atomic.LoadInt32(&c.resizing) == 1
+}
+
+// 若正在调整并发量则返回 MapResizingError，否则获取调整并发量的读锁
+// 注意！返回 nil 时调用方必须在写操作结束后调用 c.resizeLock.RUnlock()
+func (c *myConcurrentMap) lockForWrite() error {
+	if atomic.LoadInt32(&c.resizing) == 1 {
+		return newMapResizingError()
+	}
+	c.resizeLock.RLock()
+	return nil
 }
 
 func (c *myConcurrentMap) Put(key string, element interface{}) (bool, error) {
-	p, err := newPair(key, element)
+	if c.opts.latencyTracker != nil {
+		defer c.opts.latencyTracker.record(opPut, time.Now())
+	}
+	p, err := c.newPair(key, element)
 	if err != nil {
 		return false, err
 	}
+	return c.putPair(p)
+}
+
+// putInSegment 会将键值对放入散列段 s 并更新键值对总数
+// 设置了 WithMaxEntries 时会在散列段的锁的保护下检查上限
+// 注意！必须在 resizeLock 的读锁的保护下调用该方法
+func (c *myConcurrentMap) putInSegment(s Segment, p Pair) (ok bool, err error) {
+	if c.opts.maxEntries == 0 {
+		if ok, err = s.Put(p); ok {
+			atomic.AddUint64(&c.total, 1)
+		}
+		return
+	}
+	s.Atomic(func(tx SegmentTx) {
+		ok, err = c.putInTx(tx, p)
+	})
+	return
+}
+
+// putInTx 会在散列段的锁的保护下放入键值对并更新键值对总数
+// 设置了 WithMaxEntries 时，新增键值对之前会先占用名额，名额不足时返回 CapacityExceededError
+func (c *myConcurrentMap) putInTx(tx SegmentTx, p Pair) (bool, error) {
+	if c.opts.maxEntries == 0 || tx.Get(p.Key()) != nil {
+		ok, err := tx.Put(p)
+		if ok {
+			atomic.AddUint64(&c.total, 1)
+		}
+		return ok, err
+	}
+	if !c.acquireEntries(1) {
+		return false, newCapacityExceededError(c.opts.maxEntries)
+	}
+	ok, err := tx.Put(p)
+	if !ok {
+		decreaseUint64(&c.total)
+	}
+	return ok, err
+}
+
+// acquireEntries 会在键值对总数加 n 不超过上限时以原子操作将其加 n
+func (c *myConcurrentMap) acquireEntries(n uint64) bool {
+	for {
+		total := atomic.LoadUint64(&c.total)
+		if total+n > c.opts.maxEntries {
+			return false
+		}
+		if atomic.CompareAndSwapUint64(&c.total, total, total+n) {
+			return true
+		}
+	}
+}
+
+// putPair 会放入已创建好的键值对并更新键值对总数
+func (c *myConcurrentMap) putPair(p Pair) (bool, error) {
+	if err := c.lockForWrite(); err != nil {
+		return false, err
+	}
+	defer c.resizeLock.RUnlock()
 	s := c.findSegment(p.Hash())
-	ok, err := s.Put(p)
-	if ok {
-		atomic.AddUint64(&c.total, 1)
+	ok, err := c.putInSegment(s, p)
+	if !ok && err == nil && c.opts.softValues {
+		// 替换已有元素时保留的是旧的键值对
+		if existing := s.GetWithHash(p.Key(), p.Hash()); existing != nil {
+			existing.Touch()
+		}
 	}
 	return ok, err
 }
 
+func (c *myConcurrentMap) SegmentIndexOf(key string) int {
+	key = c.normalizeKey(key)
+	return segmentIndex(c.opts.hash(key), c.Concurrency())
+}
+
+// PutInSegment 创建键值对时本就需要计算散列值，因此校验索引的开销很小，
+// 节省的是寻找散列段的计算
+func (c *myConcurrentMap) PutInSegment(index int, key string, element interface{}) (bool, error) {
+	p, err := c.newPair(key, element)
+	if err != nil {
+		return false, err
+	}
+	if err := c.lockForWrite(); err != nil {
+		return false, err
+	}
+	defer c.resizeLock.RUnlock()
+	segments := c.getSegments()
+	if index < 0 || index >= len(segments) {
+		return false, newIllegalParameterError(
+			fmt.Sprintf("segment index %d is out of range [0, %d)", index, len(segments)))
+	}
+	if actual := segmentIndex(p.Hash(), len(segments)); actual != index {
+		return false, newIllegalParameterError(
+			fmt.Sprintf("key %s belongs to segment %d, not %d", key, actual, index))
+	}
+	return c.putInSegment(segments[index], p)
+}
+
+func (c *myConcurrentMap) GetOrPut(key string, element interface{}) (interface{}, bool, error) {
+	p, err := c.newPair(key, element)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := c.lockForWrite(); err != nil {
+		return nil, false, err
+	}
+	defer c.resizeLock.RUnlock()
+	s := c.findSegment(p.Hash())
+	var actual Pair
+	var loaded bool
+	if c.opts.maxEntries == 0 {
+		if actual, loaded, err = s.GetOrPut(p); err == nil && !loaded {
+			atomic.AddUint64(&c.total, 1)
+		}
+	} else {
+		s.Atomic(func(tx SegmentTx) {
+			if actual = tx.Get(p.Key()); actual != nil {
+				loaded = true
+				return
+			}
+			actual = p
+			_, err = c.putInTx(tx, p)
+		})
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if loaded && c.opts.softValues {
+		actual.Touch()
+	}
+	element, err = c.decodeElement(actual.Element())
+	return element, loaded, err
+}
+
+// PutIfAbsent 与 GetOrPut 共用同一条路径，键在 newPair 中规范化，
+// 因此规范化后相等的键会在同一个散列段的同一个散列桶中被判断为已存在
+func (c *myConcurrentMap) PutIfAbsent(key string, element interface{}) (bool, error) {
+	_, loaded, err := c.GetOrPut(key, element)
+	return loaded, err
+}
+
+// LoadOrStoreFunc 会先不加写锁地读取键，未命中时在散列段的锁的保护下再次检查并调用 f，
+// 因此同一个键的 f 不会被并发调用，但 f 执行期间同一散列段的其他读写操作都会被阻塞
+// 散列段的锁不可重入，而 Get 等读操作也需要短暂地获取它的读锁，所以不能在 f 中访问当前 map
+func (c *myConcurrentMap) LoadOrStoreFunc(key string, f func() interface{}) (interface{}, bool) {
+	key = c.normalizeKey(key)
+	keyHash := c.opts.hash(key)
+	if p := c.findSegment(keyHash).GetWithHash(key, keyHash); p != nil {
+		element, _ := c.decodeElement(p.Element())
+		return element, true
+	}
+	if err := c.lockForWrite(); err != nil {
+		return nil, false
+	}
+	defer c.resizeLock.RUnlock()
+	var existing, stored interface{}
+	c.findSegment(keyHash).Atomic(func(tx SegmentTx) {
+		if p := tx.Get(key); p != nil {
+			existing = p.Element()
+			return
+		}
+		var element interface{}
+		if !c.opts.invokeCallback(func() {
+			element = f()
+		}) || element == nil {
+			return
+		}
+		p, err := c.newPair(key, element)
+		if err != nil {
+			return
+		}
+		if ok, _ := c.putInTx(tx, p); ok {
+			stored = element
+		}
+	})
+	if existing != nil {
+		element, _ := c.decodeElement(existing)
+		return element, true
+	}
+	return stored, false
+}
+
+// GetOrPutSlice 借助 LoadOrStoreFunc 保证同一个键只会创建一个切片
+func (c *myConcurrentMap) GetOrPutSlice(key string) *[]interface{} {
+	element, _ := c.LoadOrStoreFunc(key, func() interface{} {
+		return &[]interface{}{}
+	})
+	slice, _ := element.(*[]interface{})
+	return slice
+}
+
+// Upsert 在整个过程中持有散列段的锁，因此 insert 和 update 不会对同一个键并发执行，
+// 两者执行期间同一散列段的其他读写操作都会被阻塞，也不能在其中访问当前 map
+// 回调返回 nil 时返回 IllegalParameterError，回调 panic 且设置了 WithCallbackRecovery 时返回 nil 和 nil，
+// 这两种情况下都不会修改 map
+func (c *myConcurrentMap) Upsert(key string,
+	insert func() interface{}, update func(existing interface{}) interface{}) (interface{}, error) {
+	if insert == nil || update == nil {
+		return nil, newIllegalParameterError("insert or update function is nil")
+	}
+	if err := c.lockForWrite(); err != nil {
+		return nil, err
+	}
+	defer c.resizeLock.RUnlock()
+	key = c.normalizeKey(key)
+	var element interface{}
+	var err error
+	c.findSegment(c.opts.hash(key)).Atomic(func(tx SegmentTx) {
+		var ok bool
+		if p := tx.Get(key); p != nil {
+			var existing interface{}
+			if existing, err = c.decodeElement(p.Element()); err != nil {
+				return
+			}
+			ok = c.opts.invokeCallback(func() {
+				element = update(existing)
+			})
+		} else {
+			ok = c.opts.invokeCallback(func() {
+				element = insert()
+			})
+		}
+		if !ok {
+			element = nil
+			return
+		}
+		var p Pair
+		if p, err = c.newPair(key, element); err != nil {
+			element = nil
+			return
+		}
+		if _, err = c.putInTx(tx, p); err != nil {
+			element = nil
+		}
+	})
+	return element, err
+}
+
+// GetAndUpdate 与 Upsert 相同，f 执行期间同一散列段的其他读写操作都会被阻塞，也不能在 f 中访问当前 map
+func (c *myConcurrentMap) GetAndUpdate(key string,
+	f func(old interface{}, exists bool) interface{}) (old, newElement interface{}, existed bool) {
+	if f == nil || c.lockForWrite() != nil {
+		return nil, nil, false
+	}
+	defer c.resizeLock.RUnlock()
+	key = c.normalizeKey(key)
+	c.findSegment(c.opts.hash(key)).Atomic(func(tx SegmentTx) {
+		if p := tx.Get(key); p != nil {
+			var err error
+			if old, err = c.decodeElement(p.Element()); err != nil {
+				return
+			}
+			existed = true
+		}
+		var element interface{}
+		if !c.opts.invokeCallback(func() {
+			element = f(old, existed)
+		}) || element == nil {
+			return
+		}
+		p, err := c.newPair(key, element)
+		if err != nil {
+			return
+		}
+		if _, err := c.putInTx(tx, p); err == nil {
+			newElement = element
+		}
+	})
+	return old, newElement, existed
+}
+
+// MergeKey 在散列段的锁的保护下通过 Pair.MergeElement 合并元素，因此同一个键的合并不会互相覆盖
+// 设置了编解码函数时，merge 收到的是解码后的元素，其返回值会被编码后存放
+func (c *myConcurrentMap) MergeKey(key string, incoming interface{},
+	merge func(existing, incoming interface{}) interface{}) (interface{}, error) {
+	if incoming == nil {
+		return nil, newIllegalParameterError("incoming element is nil")
+	}
+	if merge == nil {
+		return nil, newIllegalParameterError("merge function is nil")
+	}
+	if err := c.lockForWrite(); err != nil {
+		return nil, err
+	}
+	defer c.resizeLock.RUnlock()
+	key = c.normalizeKey(key)
+	var merged interface{}
+	var err error
+	c.findSegment(c.opts.hash(key)).Atomic(func(tx SegmentTx) {
+		p := tx.Get(key)
+		var existing interface{}
+		if p != nil {
+			if existing, err = c.decodeElement(p.Element()); err != nil {
+				return
+			}
+		}
+		// 键不存在或元素已被取走时直接放入 incoming
+		if existing == nil {
+			if p, err = c.newPair(key, incoming); err != nil {
+				return
+			}
+			if _, err = c.putInTx(tx, p); err == nil {
+				merged = incoming
+			}
+			return
+		}
+		// 合并函数出错时返回 nil 使 MergeElement 不修改元素，并记录具体的错误
+		var element, encoded interface{}
+		var mergeErr error
+		err = p.MergeElement(incoming, func(stored, incoming interface{}) interface{} {
+			if existing, mergeErr = c.decodeElement(stored); mergeErr != nil {
+				return nil
+			}
+			if !c.opts.invokeCallback(func() {
+				element = merge(existing, incoming)
+			}) {
+				mergeErr = newCallbackPanicError()
+				return nil
+			}
+			if element == nil {
+				return nil
+			}
+			if encoded, mergeErr = c.encodeElement(element); mergeErr != nil {
+				return nil
+			}
+			return encoded
+		})
+		if mergeErr != nil {
+			err = mergeErr
+		}
+		if err != nil {
+			return
+		}
+		if c.opts.elementChecksum != nil {
+			p.SetChecksum(c.opts.elementChecksum(encoded))
+		}
+		c.opts.recordMutation(key, MUTATION_OP_UPDATE)
+		merged = element
+	})
+	return merged, err
+}
+
+// 使用当前 map 的散列函数创建键值对
+// 若设置了键的规范化函数，则使用规范化后的键
+// 若设置了元素的编解码函数，则存放编码后的元素
+func (c *myConcurrentMap) newPair(key string, element interface{}) (Pair, error) {
+	key = c.normalizeKey(key)
+	element, err := c.encodeElement(element)
+	if err != nil {
+		return nil, err
+	}
+	p, err := newPairWithHash(key, c.opts.hash(key), element)
+	if err != nil {
+		return nil, err
+	}
+	if c.opts.softValues {
+		p.Touch()
+	}
+	if c.opts.elementChecksum != nil {
+		p.SetChecksum(c.opts.elementChecksum(element))
+	}
+	return p, nil
+}
+
+// 若设置了 WithKeyNormalizer 则返回规范化后的键，否则原样返回
+func (c *myConcurrentMap) normalizeKey(key string) string {
+	if c.opts.keyNormalizer == nil {
+		return key
+	}
+	return c.opts.keyNormalizer(key)
+}
+
 // 根据给定参数寻找并返回对应散列段
+func (c *myConcurrentMap) findSegment(keyHash uint64) Segment {
+	segments := c.getSegments()
+	return segments[segmentIndex(keyHash, len(segments))]
+}
+
+// 根据给定参数计算散列段的索引
 // 使用高位的几个字节来决定散列段的索引
 // 可以使键值对在 segments 中分布更广更均匀
-func (c *myConcurrentMap) findSegment(keyHash uint64) Segment {
-	if c.concurrency == 1 {
-		return c.segments[0]
+func segmentIndex(keyHash uint64, concurrency int) int {
+	if concurrency == 1 {
+		return 0
 	}
 	var keyHash32 uint32
 	if keyHash > math.MaxUint32 {
@@ -64,46 +759,712 @@ func (c *myConcurrentMap) findSegment(keyHash uint64) Segment {
 		keyHash32 = uint32(keyHash)
 	}
 
-	return c.segments[int(keyHash32>>16)%(c.concurrency-1)]
+	return int(keyHash32>>16) % (concurrency - 1)
 }
 
 func (c *myConcurrentMap) Get(key string) interface{} {
-	keyHash := hash(key)
+	element, _ := c.GetWithError(key)
+	return element
+}
+
+// AsLookupFunc 返回的闭包只持有当前 map，每次调用都会重新获取散列段切片
+func (c *myConcurrentMap) AsLookupFunc() func(key string) (interface{}, bool) {
+	return func(key string) (interface{}, bool) {
+		element, err := c.GetWithError(key)
+		if err != nil || element == nil {
+			return nil, false
+		}
+		return element, true
+	}
+}
+
+// Peek 适用于监控等不应影响回收策略的读取
+func (c *myConcurrentMap) Peek(key string) (interface{}, bool) {
+	key = c.normalizeKey(key)
+	keyHash := c.opts.hash(key)
+	pair := c.findSegment(keyHash).GetWithHash(key, keyHash)
+	if pair == nil {
+		return nil, false
+	}
+	element, err := c.decodeElement(pair.Element())
+	if err != nil || element == nil {
+		return nil, false
+	}
+	return element, true
+}
+
+// LoadPointer 与 Get 一样读取键值对中存放的元素，但不会统计访问次数或记录使用时间
+// 元素被 SetElement 整体替换后，之前返回的指针仍然有效，只是不再属于 map
+func (c *myConcurrentMap) LoadPointer(key string) (unsafe.Pointer, bool) {
+	if c.opts.elementEncoder != nil {
+		return nil, false
+	}
+	key = c.normalizeKey(key)
+	keyHash := c.opts.hash(key)
+	pair := c.findSegment(keyHash).GetWithHash(key, keyHash)
+	if pair == nil {
+		return nil, false
+	}
+	// 热点计数器是内部使用的指针，不能交给调用方
+	if _, ok := pair.Element().(*hotCounter); ok {
+		return nil, false
+	}
+	v := reflect.ValueOf(pair.Element())
+	if v.Kind() != reflect.Ptr && v.Kind() != reflect.UnsafePointer {
+		return nil, false
+	}
+	return v.UnsafePointer(), true
+}
+
+func (c *myConcurrentMap) GetWithError(key string) (interface{}, error) {
+	if c.opts.latencyTracker != nil {
+		defer c.opts.latencyTracker.record(opGet, time.Now())
+	}
+	key = c.normalizeKey(key)
+	element, found, err := c.getLocal(key)
+	if c.opts.lookupCounter != nil {
+		// 只统计当前 map 是否命中，从后备存储加载的键也算作未命中
+		c.opts.lookupCounter.record(found)
+	}
+	// 链表过长时不确定键是否存在，因此不从后备存储加载
+	if !found && err == nil && c.opts.backingStore != nil {
+		return c.loadFromStore(key)
+	}
+	return element, err
+}
+
+// lookup 用于查找已规范化的键，设置了 WithMaxLookupDepth 时最多访问其数量的键值对
+// 达到上限仍未找到键时返回 nil 和 ChainTooDeepError
+func (c *myConcurrentMap) lookup(key string, keyHash uint64) (Pair, error) {
 	s := c.findSegment(keyHash)
-	pair := s.GetWithHash(key, keyHash)
+	getter, ok := s.(depthLimitedGetter)
+	if c.opts.maxLookupDepth == 0 || !ok {
+		return s.GetWithHash(key, keyHash), nil
+	}
+	pair, tooDeep := getter.getWithHashAndDepth(key, keyHash, c.opts.maxLookupDepth)
+	if tooDeep {
+		return nil, newChainTooDeepError(c.opts.maxLookupDepth)
+	}
+	return pair, nil
+}
+
+// getLocal 只在当前 map 中读取已规范化的键，不会访问后备存储
+// 第二个返回值表示键是否存在
+func (c *myConcurrentMap) getLocal(key string) (interface{}, bool, error) {
+	keyHash := c.opts.hash(key)
+	pair, err := c.lookup(key, keyHash)
+	if pair == nil {
+		return nil, false, err
+	}
+	if c.opts.accessCounting {
+		pair.IncrAccessCount()
+	}
+	if c.opts.softValues {
+		pair.Touch()
+	}
+	element, err := c.decodeElement(pair.Element())
+	return element, true, err
+}
+
+// Contains 不会统计访问次数或记录使用时间
+func (c *myConcurrentMap) Contains(key string) bool {
+	key = c.normalizeKey(key)
+	keyHash := c.opts.hash(key)
+	return c.findSegment(keyHash).GetWithHash(key, keyHash) != nil
+}
+
+// ContainsMulti 先按散列段对键分组，再在每个散列段的锁的保护下逐一检查
+func (c *myConcurrentMap) ContainsMulti(keys []string) map[string]bool {
+	result := make(map[string]bool, len(keys))
+	segments := c.getSegments()
+	groups := make(map[int][]string)
+	for _, key := range keys {
+		index := segmentIndex(c.opts.hash(c.normalizeKey(key)), len(segments))
+		groups[index] = append(groups[index], key)
+	}
+	for index, group := range groups {
+		segments[index].Atomic(func(tx SegmentTx) {
+			for _, key := range group {
+				result[key] = tx.Get(c.normalizeKey(key)) != nil
+			}
+		})
+	}
+	return result
+}
+
+// ElementType 与 Contains 一样不会统计访问次数或记录使用时间
+func (c *myConcurrentMap) ElementType(key string) (reflect.Type, bool) {
+	key = c.normalizeKey(key)
+	keyHash := c.opts.hash(key)
+	pair := c.findSegment(keyHash).GetWithHash(key, keyHash)
+	if pair == nil {
+		return nil, false
+	}
+	element := visibleElement(pair.Element())
+	if element == nil {
+		// 元素已被取走
+		return nil, true
+	}
+	return reflect.TypeOf(element), true
+}
+
+// GetStale 不获取散列段的锁，而是读取散列桶切片的原子快照，再通过原子操作读取表头和链表
+// 读到的是读取表头那一刻的链表，之后完成的写操作不可见，再分布期间还可能读不到已存在的键
+// 由于放入的元素和新的表头都是整体原子替换的，读到的元素要么是旧值要么是新值
+func (c *myConcurrentMap) GetStale(key string) interface{} {
+	key = c.normalizeKey(key)
+	keyHash := c.opts.hash(key)
+	pair := c.findSegment(keyHash).GetStaleWithHash(key, keyHash)
 	if pair == nil {
 		return nil
 	}
+	element, _ := c.decodeElement(pair.Element())
+	return element
+}
+
+// GetWithRetry 在每次读取前后比较散列段的修改次数，
+// 未读到键且修改次数不变时说明键确实不存在，可以立即返回
+func (c *myConcurrentMap) GetWithRetry(key string, attempts int) interface{} {
+	key = c.normalizeKey(key)
+	keyHash := c.opts.hash(key)
+	for i := 0; i < attempts; i++ {
+		s := c.findSegment(keyHash)
+		modCount := s.ModCount()
+		if pair := s.GetWithHash(key, keyHash); pair != nil {
+			element, _ := c.decodeElement(pair.Element())
+			return element
+		}
+		if s.ModCount() == modCount {
+			return nil
+		}
+	}
+	return nil
+}
+
+// LoadVersioned 先读取版本号再读取元素
+// 因此返回的版本号不会比元素新，据此进行的 CompareVersionAndSwap 不会覆盖未见过的更新
+func (c *myConcurrentMap) LoadVersioned(key string) (interface{}, uint64, bool) {
+	key = c.normalizeKey(key)
+	keyHash := c.opts.hash(key)
+	pair := c.findSegment(keyHash).GetWithHash(key, keyHash)
+	if pair == nil {
+		return nil, 0, false
+	}
+	version := pair.Version()
+	element, _ := c.decodeElement(pair.Element())
+	return element, version, true
+}
+
+func (c *myConcurrentMap) CompareVersionAndSwap(key string, expectedVersion uint64, element interface{}) bool {
+	key = c.normalizeKey(key)
+	element, err := c.encodeElement(element)
+	if err != nil {
+		return false
+	}
+	if err := c.lockForWrite(); err != nil {
+		return false
+	}
+	defer c.resizeLock.RUnlock()
+	ok, _ := c.findSegment(c.opts.hash(key)).CompareVersionAndSwap(key, expectedVersion, element)
+	return ok
+}
+
+func (c *myConcurrentMap) GetOrdered(keys []string) []interface{} {
+	elements := make([]interface{}, len(keys))
+	for i, key := range keys {
+		elements[i] = c.Get(key)
+	}
+	return elements
+}
+
+// GetInto 与 GetOrdered 一样逐个调用 Get，只是把结果放入 dst 而不分配新的结果
+// dst 中的键是调用方给出的键，而不是规范化后的键
+func (c *myConcurrentMap) GetInto(keys []string, dst map[string]interface{}) {
+	if dst == nil {
+		return
+	}
+	if c.opts.getIntoReset {
+		// 编译器会把这种写法优化为清空整个 map，不会逐个删除
+		for key := range dst {
+			delete(dst, key)
+		}
+	}
+	for _, key := range keys {
+		if element := c.Get(key); element != nil {
+			dst[key] = element
+		}
+	}
+}
 
-	return pair.Element()
+// GetOrWait 在散列段的锁的保护下检查键并登记通知通道，而散列段在其锁的保护下通知，
+// 因此不会丢失通知；超时后会注销通知通道，不会泄漏
+// Resize 会唤醒所有等待者，使其在新的散列段上重新登记
+// 键存在但元素已被 TakeElement 取走时立即返回 nil 和 false
+func (c *myConcurrentMap) GetOrWait(key string, timeout time.Duration) (interface{}, bool) {
+	key = c.normalizeKey(key)
+	keyHash := c.opts.hash(key)
+	deadline := time.Now().Add(timeout)
+	for {
+		c.resizeLock.RLock()
+		s := c.findSegment(keyHash)
+		pair, ch := s.Watch(key, time.Until(deadline) > 0)
+		c.resizeLock.RUnlock()
+		if pair != nil {
+			// 元素已被取走或解码失败时没有获取到元素，且放入已存在的键不会发出通知，因此不再等待
+			element, err := c.decodeElement(pair.Element())
+			return element, err == nil && element != nil
+		}
+		if ch == nil {
+			return nil, false
+		}
+		timer := time.NewTimer(time.Until(deadline))
+		select {
+		case <-ch:
+			// 键被放入后可能又被删除，因此需要重新检查
+			timer.Stop()
+		case <-timer.C:
+			s.Unwatch(key, ch)
+		}
+	}
+}
+
+// Reserve 返回的 commit 和 cancel 每次都会重新寻找散列段，
+// 因此在预留之后调整并发量也不会丢失预留
+func (c *myConcurrentMap) Reserve(key string) (bool, func(element interface{}), func()) {
+	key = c.normalizeKey(key)
+	keyHash := c.opts.hash(key)
+	c.resizeLock.RLock()
+	reserved := c.findSegment(keyHash).Reserve(key)
+	c.resizeLock.RUnlock()
+	if !reserved {
+		return true, func(interface{}) {}, func() {}
+	}
+	var once sync.Once
+	cancelReservation := func() {
+		c.resizeLock.RLock()
+		c.findSegment(keyHash).CancelReservation(key)
+		c.resizeLock.RUnlock()
+	}
+	commit := func(element interface{}) {
+		once.Do(func() {
+			p, err := c.newPair(key, element)
+			if err != nil {
+				cancelReservation()
+				return
+			}
+			c.resizeLock.RLock()
+			defer c.resizeLock.RUnlock()
+			if ok, _ := c.findSegment(keyHash).Commit(p); ok {
+				atomic.AddUint64(&c.total, 1)
+			}
+		})
+	}
+	cancel := func() {
+		once.Do(cancelReservation)
+	}
+	return false, commit, cancel
 }
 
 func (c *myConcurrentMap) Delete(key string) bool {
-	s := c.findSegment(hash(key))
-	if s.Delete(key) {
-		atomic.AddUint64(&c.total, ^uint64(0))
-		return true
+	if c.opts.latencyTracker != nil {
+		defer c.opts.latencyTracker.record(opDelete, time.Now())
+	}
+	key = c.normalizeKey(key)
+	if err := c.lockForWrite(); err != nil {
+		return false
+	}
+	p, ok := c.findSegment(c.opts.hash(key)).DeleteAndReturn(key)
+	if ok {
+		decreaseUint64(&c.total)
+	}
+	c.resizeLock.RUnlock()
+	if ok {
+		c.notifyEvicted([]Pair{p})
+	}
+	return ok
+}
+
+func (c *myConcurrentMap) DetectCycles() []int {
+	var indexes []int
+	for i, s := range c.getSegments() {
+		if s.HasCycle() {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// VerifyPlacement 会先检查散列段内的散列桶，再通过遍历检查键值对所在的散列段
+// 在 resizeLock 的读锁的保护下进行，因此 Resize 不会在检查期间替换散列段
+func (c *myConcurrentMap) VerifyPlacement() error {
+	c.resizeLock.RLock()
+	defer c.resizeLock.RUnlock()
+	segments := c.getSegments()
+	for i, s := range segments {
+		if err := s.VerifyPlacement(); err != nil {
+			return err
+		}
+		var err error
+		s.Range(func(p Pair) bool {
+			if expected := segmentIndex(p.Hash(), len(segments)); expected != i {
+				err = newMisplacedPairError(fmt.Sprintf(
+					"key %s is in segment %d, expected segment %d", p.Key(), i, expected))
+			}
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CollisionChain 会找到给定键所在的散列段和散列桶，
+// 然后遍历桶中的链表收集所有的键
+func (c *myConcurrentMap) CollisionChain(key string) []string {
+	key = c.normalizeKey(key)
+	keyHash := c.opts.hash(key)
+	b := c.findSegment(keyHash).GetBucketWithHash(keyHash)
+	var keys []string
+	for v, n := b.GetFirstPair(), 0; v != nil && n < MAX_CHAIN_LENGTH; v, n = v.Next(), n+1 {
+		keys = append(keys, v.Key())
+	}
+	return keys
+}
+
+func (c *myConcurrentMap) DeleteAndReturn(key string) (interface{}, bool) {
+	key = c.normalizeKey(key)
+	if err := c.lockForWrite(); err != nil {
+		return nil, false
+	}
+	p, ok := c.findSegment(c.opts.hash(key)).DeleteAndReturn(key)
+	if ok {
+		decreaseUint64(&c.total)
 	}
-	return false
+	c.resizeLock.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	c.notifyEvicted([]Pair{p})
+	element, _ := c.decodeElement(p.Element())
+	return element, true
+}
+
+// DeleteMatching 会逐个散列段地在其锁的保护下匹配并删除键，
+// 因此每个散列段内的结果是一致的，但不同散列段的删除不是同时发生的
+func (c *myConcurrentMap) DeleteMatching(pattern *regexp.Regexp) int {
+	if pattern == nil {
+		return 0
+	}
+	var evicted []Pair
+	// 在释放 resizeLock 之后调用
+	defer func() {
+		c.notifyEvicted(evicted)
+	}()
+	if err := c.lockForWrite(); err != nil {
+		return 0
+	}
+	defer c.resizeLock.RUnlock()
+	for _, s := range c.getSegments() {
+		s.Atomic(func(tx SegmentTx) {
+			var keys []string
+			tx.Range(func(p Pair) bool {
+				if pattern.MatchString(p.Key()) {
+					keys = append(keys, p.Key())
+				}
+				return true
+			})
+			for _, key := range keys {
+				if deletedPair, ok := tx.Delete(key); ok {
+					decreaseUint64(&c.total)
+					evicted = append(evicted, deletedPair)
+				}
+			}
+		})
+	}
+	return len(evicted)
+}
+
+// TakeElement 在散列段的锁的保护下读取元素并将其替换为 emptyElement，
+// 因此同一个元素只会被一次 TakeElement 取走
+func (c *myConcurrentMap) TakeElement(key string) (interface{}, bool) {
+	key = c.normalizeKey(key)
+	if err := c.lockForWrite(); err != nil {
+		return nil, false
+	}
+	defer c.resizeLock.RUnlock()
+	var taken interface{}
+	c.findSegment(c.opts.hash(key)).Atomic(func(tx SegmentTx) {
+		p := tx.Get(key)
+		if p == nil {
+			return
+		}
+		element := p.Element()
+		if _, ok := element.(emptyElement); ok {
+			return
+		}
+		if p.SetElement(emptyElement{}) == nil {
+			taken = element
+			c.opts.recordMutation(key, MUTATION_OP_UPDATE)
+		}
+	})
+	if taken == nil {
+		return nil, false
+	}
+	element, err := c.decodeElement(taken)
+	if err != nil {
+		return nil, false
+	}
+	return element, true
+}
+
+// Range 在开始时取得散列段切片并只遍历其中的散列段
+// Resize 和 ReplaceAll 会整体替换散列段切片，而不会修改被替换下来的散列段，
+// 因此即使遍历期间发生了调整，访问到的也是调整前的完整结构
+func (c *myConcurrentMap) Range(f func(key string, element interface{}) bool) {
+	for _, s := range c.getSegments() {
+		if !s.Range(func(p Pair) (goOn bool) {
+			// 回调发生 panic 且被捕获时停止遍历
+			element := visibleElement(p.Element())
+			c.opts.invokeCallback(func() {
+				goOn = f(p.Key(), element)
+			})
+			return
+		}) {
+			return
+		}
+	}
+}
+
+// SortedKeys 先对每个散列段的键分别排序再逐一归并，
+// 遍历散列段时不持有任何锁，因此不会与写操作形成死锁
+func (c *myConcurrentMap) SortedKeys() []string {
+	var keys []string
+	for _, s := range c.getSegments() {
+		var segmentKeys []string
+		s.Range(func(p Pair) bool {
+			segmentKeys = append(segmentKeys, p.Key())
+			return true
+		})
+		sort.Strings(segmentKeys)
+		keys = mergeSortedKeys(keys, segmentKeys)
+	}
+	return keys
+}
+
+// 归并两个已排序的键切片
+func mergeSortedKeys(a, b []string) []string {
+	if len(a) == 0 {
+		return b
+	}
+	if len(b) == 0 {
+		return a
+	}
+	merged := make([]string, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if a[i] <= b[j] {
+			merged = append(merged, a[i])
+			i++
+		} else {
+			merged = append(merged, b[j])
+			j++
+		}
+	}
+	merged = append(merged, a[i:]...)
+	return append(merged, b[j:]...)
+}
+
+// RangeByHash 先对每个散列段的键值对分别排序再逐一归并
+// 需要先收集全部键值对，因此会占用与键值对数量成正比的内存
+func (c *myConcurrentMap) RangeByHash(f func(key string, element interface{}) bool) {
+	var pairs []Pair
+	for _, s := range c.getSegments() {
+		var segmentPairs []Pair
+		s.Range(func(p Pair) bool {
+			segmentPairs = append(segmentPairs, p)
+			return true
+		})
+		sort.Slice(segmentPairs, func(i, j int) bool {
+			return pairLessByHash(segmentPairs[i], segmentPairs[j])
+		})
+		pairs = mergePairsByHash(pairs, segmentPairs)
+	}
+	for _, p := range pairs {
+		var goOn bool
+		c.opts.invokeCallback(func() {
+			goOn = f(p.Key(), visibleElement(p.Element()))
+		})
+		if !goOn {
+			return
+		}
+	}
+}
+
+// 按散列值比较两个键值对，散列值相同时按键比较
+func pairLessByHash(a, b Pair) bool {
+	if a.Hash() != b.Hash() {
+		return a.Hash() < b.Hash()
+	}
+	return a.Key() < b.Key()
+}
+
+// 归并两个已按散列值排序的键值对切片
+func mergePairsByHash(a, b []Pair) []Pair {
+	if len(a) == 0 {
+		return b
+	}
+	if len(b) == 0 {
+		return a
+	}
+	merged := make([]Pair, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if !pairLessByHash(b[j], a[i]) {
+			merged = append(merged, a[i])
+			i++
+		} else {
+			merged = append(merged, b[j])
+			j++
+		}
+	}
+	merged = append(merged, a[i:]...)
+	return append(merged, b[j:]...)
+}
+
+// RangeOfType 在遍历时比较每个元素的类型，不匹配的键值对不会调用 f
+// 已被 TakeElement 取走的元素的类型视为 nil，因此 t 为 nil 时只会访问这些键
+func (c *myConcurrentMap) RangeOfType(t reflect.Type, f func(key string, element interface{}) bool) {
+	c.Range(func(key string, element interface{}) bool {
+		if reflect.TypeOf(element) != t {
+			return true
+		}
+		return f(key, element)
+	})
 }
 
+func (c *myConcurrentMap) RangePrefix(prefix string, f func(key string, element interface{}) bool) {
+	if c.opts.prefixIndex == nil {
+		c.Range(func(key string, element interface{}) bool {
+			if !strings.HasPrefix(key, prefix) {
+				return true
+			}
+			return f(key, element)
+		})
+		return
+	}
+	for _, key := range c.opts.prefixIndex.keysWithPrefix(prefix) {
+		// 键可能在获取索引之后被删除了
+		element := c.Get(key)
+		if element == nil {
+			continue
+		}
+		var goOn bool
+		c.opts.invokeCallback(func() {
+			goOn = f(key, element)
+		})
+		if !goOn {
+			return
+		}
+	}
+}
+
+func (c *myConcurrentMap) CloneSegment(index int) (map[string]interface{}, error) {
+	segments := c.getSegments()
+	if index < 0 || index >= len(segments) {
+		return nil, newIllegalParameterError(
+			fmt.Sprintf("segment index %d is out of range [0, %d)", index, len(segments)))
+	}
+	clone := segments[index].Clone()
+	for key, element := range clone {
+		element, err := c.decodeElement(element)
+		if err != nil {
+			return nil, err
+		}
+		clone[key] = element
+	}
+	return clone, nil
+}
+
+func (c *myConcurrentMap) LeastFrequent(n int) []string {
+	if !c.opts.accessCounting || n <= 0 {
+		return nil
+	}
+	type keyCount struct {
+		key   string
+		count uint64
+	}
+	var counts []keyCount
+	for _, s := range c.getSegments() {
+		s.Range(func(p Pair) bool {
+			counts = append(counts, keyCount{p.Key(), p.AccessCount()})
+			return true
+		})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].count != counts[j].count {
+			return counts[i].count < counts[j].count
+		}
+		return counts[i].key < counts[j].key
+	})
+	if n > len(counts) {
+		n = len(counts)
+	}
+	keys := make([]string, n)
+	for i := 0; i < n; i++ {
+		keys[i] = counts[i].key
+	}
+	return keys
+}
+
+// Len 读取的是所有写操作以原子操作维护的总数，本身就是 O(1) 的，
+// 因此不需要对各个散列段的计数求和，也不需要缓存
 func (cmap *myConcurrentMap) Len() uint64 {
 	return atomic.LoadUint64(&cmap.total)
 }
 
-// 参数 pairRedistributor 可以为空
-func NewConcurrentMap(concurrency int, pairRedistributor PairRedistributor) (ConcurrentMap, error) {
+// ReconcileLen 与 Resize 一样获取 resizeLock 的写锁，
+// 写操作都在持有其读锁时同时修改散列段和计数，因此持有写锁时两者之间不会有进行中的修改
+// 数的是链表中实际存在的键值对，而不是散列段自己的计数，以免两种计数一起出错
+func (cmap *myConcurrentMap) ReconcileLen() bool {
+	cmap.resizeLock.Lock()
+	defer cmap.resizeLock.Unlock()
+	var actual uint64
+	for _, s := range cmap.getSegments() {
+		s.Range(func(p Pair) bool {
+			actual++
+			return true
+		})
+	}
+	return atomic.SwapUint64(&cmap.total, actual) != actual
+}
+
+// 参数 concurrency 不能超过最大并发量，否则返回 ConcurrencyLimitError
+// 参数 pairRedistributor 可以为空，不为空时被所有散列段共用，必须是并发安全的
+// 参数 opts 为可选配置项
+func NewConcurrentMap(concurrency int, pairRedistributor PairRedistributor, opts ...Option) (ConcurrentMap, error) {
 	if concurrency <= 0 {
 		return nil, newIllegalParameterError("concurrency is too small")
 	}
-	if concurrency > MAX_CONCURRENCY {
-		return nil, newIllegalParameterError("concurrency is too large")
-	}
 	cmap := &myConcurrentMap{}
-	cmap.concurrency = concurrency
-	cmap.segments = make([]Segment, concurrency)
-	for i := 0; i < concurrency; i++ {
-		cmap.segments[i] = newSegment(DEFAULT_BUCKET_NUMBER, pairRedistributor)
+	cmap.opts = newOptions(opts...)
+	if concurrency > cmap.opts.maxConcurrency {
+		return nil, newConcurrencyLimitError(concurrency, cmap.opts.maxConcurrency)
+	}
+	cmap.pairRedistributor = pairRedistributor
+	cmap.loads = make(map[string]*loadCall)
+	cmap.segments.Store(cmap.newSegments(concurrency))
+	if cmap.opts.autoTune {
+		policy := cmap.opts.autoTunePolicy
+		if policy == nil {
+			policy = NewHotSegmentPolicy()
+		}
+		cmap.autoTuner = &autoTuner{
+			policy:   policy,
+			interval: cmap.opts.autoTuneInterval,
+			stop:     make(chan struct{}),
+		}
+		go cmap.autoTuner.run(cmap)
 	}
 	return cmap, nil
 }
@@ -3,8 +3,10 @@ package cmap
 import (
 	"fmt"
 	"math/rand"
+	"sort"
 	"strconv"
 	"testing"
+	"time"
 )
 
 func BenchmarkCmapPutAbsent(b *testing.B) {
@@ -164,3 +166,99 @@ func BenchmarkMapLen(b *testing.B) {
 		})
 	}
 }
+
+// BenchmarkCmapPutLatency 用于比较同步再分布与后台再散列下持续插入的 p99 延迟
+func BenchmarkCmapPutLatency(b *testing.B) {
+	modes := []struct {
+		name string
+		opts []Option
+	}{
+		{"sync", nil},
+		{"background", []Option{WithBackgroundRehash(true)}},
+	}
+	for _, mode := range modes {
+		b.Run(mode.name, func(b *testing.B) {
+			cm, _ := NewConcurrentMap(1, nil, mode.opts...)
+			latencies := make([]time.Duration, b.N)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				key := "key-" + strconv.Itoa(i)
+				start := time.Now()
+				cm.Put(key, i)
+				latencies[i] = time.Since(start)
+			}
+			b.StopTimer()
+			sort.Slice(latencies, func(i, j int) bool {
+				return latencies[i] < latencies[j]
+			})
+			b.ReportMetric(float64(latencies[len(latencies)*99/100].Nanoseconds()), "p99-ns")
+			b.ReportMetric(float64(latencies[len(latencies)-1].Nanoseconds()), "max-ns")
+		})
+	}
+}
+
+// BenchmarkCmapNewLarge 用于比较串行与并行初始化时创建大 map 的耗时
+func BenchmarkCmapNewLarge(b *testing.B) {
+	modes := []struct {
+		name string
+		opts []Option
+	}{
+		{"serial", []Option{WithBucketNumber(1 << 10)}},
+		{"parallel", []Option{WithBucketNumber(1 << 10), WithParallelInit(true)}},
+	}
+	for _, mode := range modes {
+		b.Run(mode.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := NewConcurrentMap(1<<10, nil, mode.opts...); err != nil {
+					b.Fatalf("An error occurs when new a concurrent map: %s", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkCmapKeys 用于比较串行与并行收集大 map 的键的耗时
+func BenchmarkCmapKeys(b *testing.B) {
+	cm, _ := NewConcurrentMap(64, nil)
+	for i := 0; i < 1000000; i++ {
+		cm.Put("key-"+strconv.Itoa(i), i)
+	}
+	b.Run("serial", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			cm.Keys()
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			cm.KeysParallel()
+		}
+	})
+}
+
+func BenchmarkCmapGetInto(b *testing.B) {
+	number := 64
+	cm, _ := NewConcurrentMap(16, nil, WithGetIntoReset(true))
+	keys := make([]string, number)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+		cm.Put(keys[i], i)
+	}
+	b.Run("NewMap", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			result := make(map[string]interface{})
+			for _, key := range keys {
+				if element := cm.Get(key); element != nil {
+					result[key] = element
+				}
+			}
+		}
+	})
+	b.Run("Reused", func(b *testing.B) {
+		b.ReportAllocs()
+		dst := make(map[string]interface{}, number)
+		for i := 0; i < b.N; i++ {
+			cm.GetInto(keys, dst)
+		}
+	})
+}
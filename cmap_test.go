@@ -2,7 +2,14 @@ package cmap
 
 import (
 	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+	"unsafe"
 )
 
 func TestCmapNew(t *testing.T) {
@@ -314,3 +321,1397 @@ func TestCmapAllInParallel(t *testing.T) {
 		})
 	})
 }
+
+func TestCmapCollisionChain(t *testing.T) {
+	cm, _ := NewConcurrentMap(1, nil)
+	// 只有一个散列桶的散列段可以让所有键都发生碰撞
+	cm.(*myConcurrentMap).getSegments()[0] = newSegment(1, nil)
+	number := 10
+	testCases := genNoRepetitiveTestingPairs(number)
+	for _, p := range testCases {
+		cm.Put(p.Key(), p.Element())
+	}
+	for _, p := range testCases {
+		chain := cm.CollisionChain(p.Key())
+		if len(chain) != number {
+			t.Fatalf("Inconsistent chain length: expected: %d, actual: %d (key: %s)",
+				number, len(chain), p.Key())
+		}
+		keys := make(map[string]struct{})
+		for _, k := range chain {
+			keys[k] = struct{}{}
+		}
+		for _, tc := range testCases {
+			if _, ok := keys[tc.Key()]; !ok {
+				t.Fatalf("Not found key %s in collision chain of key %s!",
+					tc.Key(), p.Key())
+			}
+		}
+	}
+}
+
+func TestCmapDeleteAndReturn(t *testing.T) {
+	cm, _ := NewConcurrentMap(1, nil)
+	// 所有键位于同一散列桶中，以便覆盖删除时拷贝前置节点的逻辑
+	cm.(*myConcurrentMap).getSegments()[0] = newSegment(1, nil)
+	number := 30
+	testCases := genNoRepetitiveTestingPairs(number)
+	for _, p := range testCases {
+		cm.Put(p.Key(), p.Element())
+	}
+	for _, p := range testCases {
+		element, ok := cm.DeleteAndReturn(p.Key())
+		if !ok {
+			t.Fatalf("Couldn't delete a key-element from cmap! (key: %s, element: %#v)",
+				p.Key(), p.Element())
+		}
+		if element != p.Element() {
+			t.Fatalf("Inconsistent element: expected: %#v, actual: %#v",
+				p.Element(), element)
+		}
+		element, ok = cm.DeleteAndReturn(p.Key())
+		if ok || element != nil {
+			t.Fatalf("Couldn't delete a key-element from cmap again! (key: %s, element: %#v)",
+				p.Key(), element)
+		}
+	}
+	if cm.Len() != 0 {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d",
+			0, cm.Len())
+	}
+}
+
+func TestCmapDeleteAndReturnInParallel(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	key, element := "key", "element"
+	cm.Put(key, element)
+	var count int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if actual, ok := cm.DeleteAndReturn(key); ok {
+				atomic.AddInt32(&count, 1)
+				if actual != element {
+					t.Errorf("Inconsistent element: expected: %#v, actual: %#v",
+						element, actual)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if count != 1 {
+		t.Fatalf("Inconsistent deletion count: expected: %d, actual: %d",
+			1, count)
+	}
+	if cm.Len() != 0 {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d",
+			0, cm.Len())
+	}
+}
+
+func TestCmapRange(t *testing.T) {
+	number := 30
+	testCases := genNoRepetitiveTestingPairs(number)
+	cm, _ := NewConcurrentMap(number/2, nil)
+	expected := make(map[string]interface{})
+	for _, p := range testCases {
+		cm.Put(p.Key(), p.Element())
+		expected[p.Key()] = p.Element()
+	}
+	actual := make(map[string]interface{})
+	cm.Range(func(key string, element interface{}) bool {
+		actual[key] = element
+		return true
+	})
+	if len(actual) != number {
+		t.Fatalf("Inconsistent range count: expected: %d, actual: %d",
+			number, len(actual))
+	}
+	for key, element := range expected {
+		if actual[key] != element {
+			t.Fatalf("Inconsistent element: expected: %#v, actual: %#v (key: %s)",
+				element, actual[key], key)
+		}
+	}
+}
+
+func TestCmapRangePanic(t *testing.T) {
+	number := 30
+	testCases := genNoRepetitiveTestingPairs(number)
+	var recovered []interface{}
+	cm, _ := NewConcurrentMap(number/2, nil, WithCallbackRecovery(func(r interface{}) {
+		recovered = append(recovered, r)
+	}))
+	for _, p := range testCases {
+		cm.Put(p.Key(), p.Element())
+	}
+	var count int
+	cm.Range(func(key string, element interface{}) bool {
+		count++
+		panic(key)
+	})
+	if count != 1 || len(recovered) != 1 {
+		t.Fatalf("Inconsistent recovered count: expected: %d, actual: %d (calls: %d)",
+			1, len(recovered), count)
+	}
+	// map 在回调发生 panic 后应仍然可用
+	for _, p := range testCases {
+		if !cm.Delete(p.Key()) {
+			t.Fatalf("Not found pair %s after a panic!", p.Key())
+		}
+	}
+	if cm.Len() != 0 {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d", 0, cm.Len())
+	}
+
+	cm, _ = NewConcurrentMap(number/2, nil)
+	cm.Put("key", "element")
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("The panic in the callback is not propagated!")
+			}
+		}()
+		cm.Range(func(key string, element interface{}) bool {
+			panic(key)
+		})
+	}()
+	if _, err := cm.Put("key", "new"); err != nil {
+		t.Fatalf("An error occurs when putting a pair after a panic: %s", err)
+	}
+}
+
+func TestCmapPutInSegment(t *testing.T) {
+	cm, _ := NewConcurrentMap(8, nil)
+	keys, index := genKeysInSegment(cm, 3)
+	for i, key := range keys {
+		if actual := cm.SegmentIndexOf(key); actual != index {
+			t.Fatalf("Inconsistent segment index: expected: %d, actual: %d", index, actual)
+		}
+		ok, err := cm.PutInSegment(index, key, i)
+		if err != nil {
+			t.Fatalf("An error occurs when putting a pair in segment: %s", err)
+		}
+		if !ok {
+			t.Fatalf("Couldn't put pair {%s: %d} in segment %d!", key, i, index)
+		}
+		if actual := cm.Get(key); actual != i {
+			t.Fatalf("Inconsistent element: expected: %#v, actual: %#v", i, actual)
+		}
+	}
+	if cm.Len() != uint64(len(keys)) {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d", len(keys), cm.Len())
+	}
+	other := genKeyInOtherSegment(cm, index)
+	if _, err := cm.PutInSegment(index, other, 1); err == nil {
+		t.Fatal("No error when putting a pair in a wrong segment, but should not be the case!")
+	}
+	for _, i := range []int{-1, cm.Concurrency()} {
+		if _, err := cm.PutInSegment(i, keys[0], 1); err == nil {
+			t.Fatalf("No error when putting a pair in segment %d, but should not be the case!", i)
+		}
+	}
+	if cm.Get(other) != nil || cm.Len() != uint64(len(keys)) {
+		t.Fatal("A pair is put in a wrong segment!")
+	}
+}
+
+func TestCmapDetectCycles(t *testing.T) {
+	number := 30
+	testCases := genNoRepetitiveTestingPairs(number)
+	cm, _ := NewConcurrentMap(4, nil)
+	for _, p := range testCases {
+		cm.Put(p.Key(), p.Element())
+	}
+	if indexes := cm.DetectCycles(); len(indexes) != 0 {
+		t.Fatalf("Found cycles in intact segments: %v", indexes)
+	}
+	key := testCases[0].Key()
+	index := cm.SegmentIndexOf(key)
+	b := cm.(*myConcurrentMap).getSegments()[index].GetBucketWithHash(hash(key))
+	first := b.GetFirstPair()
+	first.SetNext(first)
+	indexes := cm.DetectCycles()
+	if len(indexes) != 1 || indexes[0] != index {
+		t.Fatalf("Inconsistent cyclic segments: expected: %v, actual: %v", []int{index}, indexes)
+	}
+}
+
+func TestCmapGetStale(t *testing.T) {
+	type record struct {
+		id    int
+		check int
+	}
+	cm, _ := NewConcurrentMap(4, nil, WithAccessCounting(true))
+	keys := []string{"a", "b", "c"}
+	for _, key := range keys {
+		cm.Put(key, record{0, 0})
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			key := keys[i%len(keys)]
+			if i%2 == 0 {
+				cm.Delete(key)
+			}
+			cm.Put(key, record{i, -i})
+		}
+	}()
+	for i := 0; i < 10000; i++ {
+		element := cm.GetStale(keys[i%len(keys)])
+		if element == nil {
+			continue
+		}
+		r, ok := element.(record)
+		if !ok || r.id != -r.check {
+			t.Fatalf("Read a corrupt element: %#v", element)
+		}
+	}
+	close(done)
+	wg.Wait()
+	p := cm.(*myConcurrentMap).findSegment(hash("a")).Get("a")
+	if p.AccessCount() != 0 {
+		t.Fatalf("Inconsistent access count: expected: %d, actual: %d", 0, p.AccessCount())
+	}
+}
+
+func TestCmapRangeByHash(t *testing.T) {
+	number := 100
+	testCases := genNoRepetitiveTestingPairs(number)
+	var dumps []string
+	for _, concurrency := range []int{1, 7, 16} {
+		cm, _ := NewConcurrentMap(concurrency, nil)
+		for _, p := range testCases {
+			cm.Put(p.Key(), p.Element())
+		}
+		var lastHash uint64
+		var keys []string
+		cm.RangeByHash(func(key string, element interface{}) bool {
+			if h := hash(key); h < lastHash {
+				t.Fatalf("The hash order is decreasing: %d < %d", h, lastHash)
+			} else {
+				lastHash = h
+			}
+			keys = append(keys, key)
+			return true
+		})
+		if len(keys) != number {
+			t.Fatalf("Inconsistent range count: expected: %d, actual: %d", number, len(keys))
+		}
+		dumps = append(dumps, fmt.Sprint(keys))
+	}
+	for _, dump := range dumps[1:] {
+		if dump != dumps[0] {
+			t.Fatal("The hash order depends on the concurrency!")
+		}
+	}
+}
+
+func TestCmapGetWithRetry(t *testing.T) {
+	cm, _ := NewConcurrentMap(1, nil)
+	cm.Put("stable", "element")
+	if actual := cm.GetWithRetry("stable", 1); actual != "element" {
+		t.Fatalf("Inconsistent element: expected: %#v, actual: %#v", "element", actual)
+	}
+	if actual := cm.GetWithRetry("nonexistent", 3); actual != nil {
+		t.Fatalf("Found a nonexistent key: %#v", actual)
+	}
+	testCases := genNoRepetitiveTestingPairs(2000)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	// 反复放入和删除其他键，使散列段不断地扩容、收缩和复制链表
+	go func() {
+		defer wg.Done()
+		for {
+			for _, p := range testCases {
+				cm.Put(p.Key(), p.Element())
+			}
+			for _, p := range testCases {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				cm.Delete(p.Key())
+			}
+		}
+	}()
+	for i := 0; i < 20000; i++ {
+		if cm.GetWithRetry("stable", 100) == nil {
+			close(done)
+			wg.Wait()
+			t.Fatal("GetWithRetry spuriously returns nil!")
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestCmapContainsMulti(t *testing.T) {
+	number := 30
+	testCases := genNoRepetitiveTestingPairs(number)
+	cm, _ := NewConcurrentMap(4, nil)
+	var keys []string
+	expected := make(map[string]bool)
+	for i, p := range testCases {
+		if i%2 == 0 {
+			cm.Put(p.Key(), p.Element())
+		}
+		keys = append(keys, p.Key())
+		expected[p.Key()] = i%2 == 0
+	}
+	actual := cm.ContainsMulti(keys)
+	if len(actual) != number {
+		t.Fatalf("Inconsistent result count: expected: %d, actual: %d", number, len(actual))
+	}
+	for key, present := range expected {
+		if actual[key] != present {
+			t.Fatalf("Inconsistent presence of key %s: expected: %v, actual: %v", key, present, actual[key])
+		}
+	}
+	if actual := cm.ContainsMulti(nil); len(actual) != 0 {
+		t.Fatalf("Inconsistent result count: expected: %d, actual: %d", 0, len(actual))
+	}
+}
+
+func TestCmapElementType(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	elements := map[string]interface{}{
+		"int":    1,
+		"string": "s",
+		"slice":  []byte("b"),
+		"struct": struct{ A int }{1},
+		"pair":   &pair{},
+	}
+	for key, element := range elements {
+		cm.Put(key, element)
+	}
+	for key, element := range elements {
+		typ, ok := cm.ElementType(key)
+		if !ok {
+			t.Fatalf("Not found key %s!", key)
+		}
+		if expected := reflect.TypeOf(element); typ != expected {
+			t.Fatalf("Inconsistent element type: expected: %v, actual: %v", expected, typ)
+		}
+	}
+	if typ, ok := cm.ElementType("nonexistent"); ok || typ != nil {
+		t.Fatalf("Found a nonexistent key with type %v!", typ)
+	}
+}
+
+func TestCmapSortedKeys(t *testing.T) {
+	number := 50
+	testCases := genNoRepetitiveTestingPairs(number)
+	cm, _ := NewConcurrentMap(number/5, nil)
+	expected := make(map[string]bool)
+	for _, p := range testCases {
+		cm.Put(p.Key(), p.Element())
+		expected[p.Key()] = true
+	}
+	keys := cm.SortedKeys()
+	if len(keys) != number {
+		t.Fatalf("Inconsistent key count: expected: %d, actual: %d",
+			number, len(keys))
+	}
+	if !sort.StringsAreSorted(keys) {
+		t.Fatalf("Keys are not sorted: %v", keys)
+	}
+	for _, key := range keys {
+		if !expected[key] {
+			t.Fatalf("Unexpected key %s!", key)
+		}
+		delete(expected, key)
+	}
+}
+
+func TestCmapCompareVersionAndSwap(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	key := "key"
+	if _, _, ok := cm.LoadVersioned(key); ok {
+		t.Fatalf("Found a nonexistent key %s!", key)
+	}
+	if cm.CompareVersionAndSwap(key, 0, "new") {
+		t.Fatalf("Swapped a nonexistent key %s!", key)
+	}
+	cm.Put(key, "v0")
+	element, version, ok := cm.LoadVersioned(key)
+	if !ok || element != "v0" {
+		t.Fatalf("Inconsistent element: expected: %#v, actual: %#v", "v0", element)
+	}
+	// 另一个写入者更新了元素，使 version 过期
+	cm.Put(key, "v1")
+	if cm.CompareVersionAndSwap(key, version, "stale") {
+		t.Fatal("Swapped with a stale version!")
+	}
+	if actual := cm.Get(key); actual != "v1" {
+		t.Fatalf("Inconsistent element: expected: %#v, actual: %#v", "v1", actual)
+	}
+	_, version, _ = cm.LoadVersioned(key)
+	if !cm.CompareVersionAndSwap(key, version, "v2") {
+		t.Fatal("Couldn't swap with the current version!")
+	}
+	element, newVersion, _ := cm.LoadVersioned(key)
+	if element != "v2" || newVersion != version+1 {
+		t.Fatalf("Inconsistent versioned element: expected: (%#v, %d), actual: (%#v, %d)",
+			"v2", version+1, element, newVersion)
+	}
+	if cm.CompareVersionAndSwap(key, newVersion, nil) {
+		t.Fatal("Swapped to a nil element!")
+	}
+}
+
+func TestCmapCompareVersionAndSwapInParallel(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	key := "counter"
+	cm.Put(key, 0)
+	number := 50
+	var wg sync.WaitGroup
+	for i := 0; i < number; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				element, version, _ := cm.LoadVersioned(key)
+				if cm.CompareVersionAndSwap(key, version, element.(int)+1) {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if actual := cm.Get(key); actual != number {
+		t.Fatalf("Lost updates: expected: %d, actual: %#v", number, actual)
+	}
+}
+
+func TestCmapGetOrWait(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	key, element := "key", "element"
+	number := 5
+	var wg sync.WaitGroup
+	for i := 0; i < number; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			actual, ok := cm.GetOrWait(key, 5*time.Second)
+			if !ok || actual != element {
+				t.Errorf("Inconsistent element: expected: %#v, actual: %#v",
+					element, actual)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	cm.Put(key, element)
+	wg.Wait()
+	actual, ok := cm.GetOrWait(key, 0)
+	if !ok || actual != element {
+		t.Fatalf("Inconsistent element: expected: %#v, actual: %#v",
+			element, actual)
+	}
+}
+
+func TestCmapGetOrWaitTimeout(t *testing.T) {
+	cm, _ := NewConcurrentMap(1, nil)
+	key := "absent"
+	begin := time.Now()
+	actual, ok := cm.GetOrWait(key, 50*time.Millisecond)
+	if ok || actual != nil {
+		t.Fatalf("Inconsistent element: expected: %#v, actual: %#v", nil, actual)
+	}
+	if elapsed := time.Since(begin); elapsed < 50*time.Millisecond {
+		t.Fatalf("GetOrWait returned before the timeout: %s", elapsed)
+	}
+	s := cm.(*myConcurrentMap).getSegments()[0].(*segment)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.waiters) != 0 {
+		t.Fatalf("Waiters leaked after timeout: %d", len(s.waiters))
+	}
+}
+
+func TestCmapReserve(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	key := "key"
+	committed, commit, cancel := cm.Reserve(key)
+	if committed {
+		t.Fatalf("Couldn't reserve an absent key %s!", key)
+	}
+	if again, _, _ := cm.Reserve(key); !again {
+		t.Fatalf("Reserved a reserved key %s again!", key)
+	}
+	if cm.Get(key) != nil {
+		t.Fatalf("Reserved key %s is visible before commit!", key)
+	}
+	commit("element")
+	cancel()
+	commit("other")
+	if actual := cm.Get(key); actual != "element" {
+		t.Fatalf("Inconsistent element: expected: %#v, actual: %#v", "element", actual)
+	}
+	if cm.Len() != 1 {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d", 1, cm.Len())
+	}
+	if committed, _, _ := cm.Reserve(key); !committed {
+		t.Fatalf("Reserved an existing key %s!", key)
+	}
+
+	key = "canceled"
+	_, _, cancel = cm.Reserve(key)
+	cancel()
+	committed, commit, _ = cm.Reserve(key)
+	if committed {
+		t.Fatalf("Couldn't reserve a canceled key %s!", key)
+	}
+	commit(nil)
+	if committed, _, _ := cm.Reserve(key); committed {
+		t.Fatalf("Key %s is still reserved after committing nil!", key)
+	}
+}
+
+func TestCmapReserveInParallel(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	key := "key"
+	var winners int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			committed, commit, _ := cm.Reserve(key)
+			if committed {
+				return
+			}
+			atomic.AddInt32(&winners, 1)
+			commit(i)
+		}(i)
+	}
+	wg.Wait()
+	if winners != 1 {
+		t.Fatalf("Inconsistent reserver count: expected: %d, actual: %d", 1, winners)
+	}
+	if cm.Get(key) == nil || cm.Len() != 1 {
+		t.Fatalf("Reserved key %s is not committed!", key)
+	}
+}
+
+func TestCmapCloneSegment(t *testing.T) {
+	number := 1000
+	testCases := genNoRepetitiveTestingPairs(number)
+	cm, _ := NewConcurrentMap(8, nil)
+	for _, p := range testCases {
+		cm.Put(p.Key(), p.Element())
+	}
+	union := make(map[string]interface{})
+	for i := 0; i < cm.Concurrency(); i++ {
+		clone, err := cm.CloneSegment(i)
+		if err != nil {
+			t.Fatalf("An error occurs when cloning segment %d: %s", i, err)
+		}
+		for key, element := range clone {
+			if _, ok := union[key]; ok {
+				t.Fatalf("Key %s is cloned from more than one segment!", key)
+			}
+			union[key] = element
+		}
+	}
+	if len(union) != number {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d", number, len(union))
+	}
+	for _, p := range testCases {
+		if union[p.Key()] != p.Element() {
+			t.Fatalf("Inconsistent element: expected: %#v, actual: %#v (key: %s)",
+				p.Element(), union[p.Key()], p.Key())
+		}
+	}
+	for _, index := range []int{-1, cm.Concurrency()} {
+		if _, err := cm.CloneSegment(index); err == nil {
+			t.Fatalf("No error when cloning segment %d, but should not be the case!", index)
+		}
+	}
+}
+
+func TestCmapLeastFrequent(t *testing.T) {
+	number := 20
+	testCases := genNoRepetitiveTestingPairs(number)
+	cm, _ := NewConcurrentMap(4, nil, WithAccessCounting(true))
+	for _, p := range testCases {
+		cm.Put(p.Key(), p.Element())
+	}
+	untouched := make(map[string]struct{})
+	for i, p := range testCases {
+		if i%4 == 0 {
+			untouched[p.Key()] = struct{}{}
+			continue
+		}
+		for j := 0; j < i*10; j++ {
+			cm.Get(p.Key())
+		}
+	}
+	keys := cm.LeastFrequent(len(untouched))
+	if len(keys) != len(untouched) {
+		t.Fatalf("Inconsistent key count: expected: %d, actual: %d",
+			len(untouched), len(keys))
+	}
+	for _, key := range keys {
+		if _, ok := untouched[key]; !ok {
+			t.Fatalf("Key %s is accessed but returned as least frequent!", key)
+		}
+	}
+	if keys := cm.LeastFrequent(number * 2); len(keys) != number {
+		t.Fatalf("Inconsistent key count: expected: %d, actual: %d", number, len(keys))
+	}
+	cm, _ = NewConcurrentMap(4, nil)
+	cm.Put("key", "element")
+	cm.Get("key")
+	if keys := cm.LeastFrequent(1); keys != nil {
+		t.Fatalf("Got least frequent keys without access counting: %v", keys)
+	}
+	if p := cm.(*myConcurrentMap).findSegment(hash("key")).Get("key"); p.AccessCount() != 0 {
+		t.Fatalf("Access counted without access counting: %d", p.AccessCount())
+	}
+}
+
+func TestCmapGetOrdered(t *testing.T) {
+	number := 20
+	testCases := genNoRepetitiveTestingPairs(number)
+	cm, _ := NewConcurrentMap(4, nil)
+	keys := make([]string, 0, number)
+	for i, p := range testCases {
+		if i%2 == 0 {
+			cm.Put(p.Key(), p.Element())
+		}
+		keys = append(keys, p.Key())
+	}
+	elements := cm.GetOrdered(keys)
+	if len(elements) != len(keys) {
+		t.Fatalf("Inconsistent element count: expected: %d, actual: %d",
+			len(keys), len(elements))
+	}
+	for i, p := range testCases {
+		var expected interface{}
+		if i%2 == 0 {
+			expected = p.Element()
+		}
+		if elements[i] != expected {
+			t.Fatalf("Inconsistent element at %d: expected: %#v, actual: %#v",
+				i, expected, elements[i])
+		}
+	}
+	if elements := cm.GetOrdered(nil); len(elements) != 0 {
+		t.Fatalf("Inconsistent element count: expected: %d, actual: %d", 0, len(elements))
+	}
+}
+
+func TestCmapLoadOrStoreFunc(t *testing.T) {
+	cm, _ := NewConcurrentMap(2, nil)
+	cm.Put("a", 1)
+	element, loaded := cm.LoadOrStoreFunc("a", func() interface{} {
+		t.Fatal("f is called on a hit!")
+		return nil
+	})
+	if !loaded || element != 1 {
+		t.Fatalf("Inconsistent result: expected: %v true, actual: %v %v", 1, element, loaded)
+	}
+	if element, loaded := cm.LoadOrStoreFunc("b", func() interface{} { return 2 }); loaded || element != 2 {
+		t.Fatalf("Inconsistent result: expected: %v false, actual: %v %v", 2, element, loaded)
+	}
+	if element, loaded := cm.LoadOrStoreFunc("c", func() interface{} { return nil }); loaded || element != nil {
+		t.Fatalf("Inconsistent result: expected: <nil> false, actual: %v %v", element, loaded)
+	}
+	if cm.Len() != 2 {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", 2, cm.Len())
+	}
+
+	var calls int32
+	var wg sync.WaitGroup
+	number := 50
+	results := make([]interface{}, number)
+	for i := 0; i < number; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = cm.LoadOrStoreFunc("race", func() interface{} {
+				atomic.AddInt32(&calls, 1)
+				time.Sleep(time.Millisecond)
+				return i
+			})
+		}(i)
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Fatalf("Inconsistent call count: expected: %d, actual: %d", 1, calls)
+	}
+	for _, result := range results {
+		if result != results[0] {
+			t.Fatalf("Inconsistent result: expected: %v, actual: %v", results[0], result)
+		}
+	}
+}
+
+func TestCmapGetOrPutSlice(t *testing.T) {
+	cm, _ := NewConcurrentMap(2, nil)
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	number := 100
+	slices := make([]*[]interface{}, number)
+	for i := 0; i < number; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			slices[i] = cm.GetOrPutSlice("events")
+			// 切片本身需要调用方同步
+			lock.Lock()
+			*slices[i] = append(*slices[i], i)
+			lock.Unlock()
+		}(i)
+	}
+	wg.Wait()
+	for i, slice := range slices {
+		if slice == nil || slice != slices[0] {
+			t.Fatalf("Inconsistent slice pointer #%d: expected: %p, actual: %p", i, slices[0], slice)
+		}
+	}
+	if stored := cm.Get("events"); stored != slices[0] {
+		t.Fatalf("Inconsistent stored element: expected: %p, actual: %v", slices[0], stored)
+	}
+	seen := make(map[interface{}]bool)
+	for _, v := range *slices[0] {
+		seen[v] = true
+	}
+	if len(*slices[0]) != number || len(seen) != number {
+		t.Fatalf("Inconsistent slice length: expected: %d, actual: %d (distinct: %d)", number, len(*slices[0]), len(seen))
+	}
+	if cm.Len() != 1 {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", 1, cm.Len())
+	}
+
+	cm.Put("other", 1)
+	if slice := cm.GetOrPutSlice("other"); slice != nil {
+		t.Fatalf("Inconsistent slice of a non-slice element: expected: <nil>, actual: %v", slice)
+	}
+}
+
+func TestCmapUpsert(t *testing.T) {
+	cm, _ := NewConcurrentMap(2, nil)
+	insert := func() interface{} { return []string{"first"} }
+	update := func(existing interface{}) interface{} {
+		return append(existing.([]string), "next")
+	}
+	element, err := cm.Upsert("a", insert, update)
+	if err != nil {
+		t.Fatalf("An error occurs when upserting a new key: %s", err)
+	}
+	if !reflect.DeepEqual(element, []string{"first"}) {
+		t.Fatalf("Inconsistent element: expected: %v, actual: %v", []string{"first"}, element)
+	}
+	element, _ = cm.Upsert("a", insert, update)
+	if !reflect.DeepEqual(element, []string{"first", "next"}) ||
+		!reflect.DeepEqual(cm.Get("a"), []string{"first", "next"}) {
+		t.Fatalf("Inconsistent element: expected: %v, actual: %v %v",
+			[]string{"first", "next"}, element, cm.Get("a"))
+	}
+	if _, err := cm.Upsert("b", func() interface{} { return nil }, update); err == nil {
+		t.Fatal("No error when upserting a nil element!")
+	}
+	if cm.Len() != 1 {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", 1, cm.Len())
+	}
+
+	var inserts, updates int32
+	var wg sync.WaitGroup
+	number := 50
+	for i := 0; i < number; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cm.Upsert("counter", func() interface{} {
+				atomic.AddInt32(&inserts, 1)
+				return 1
+			}, func(existing interface{}) interface{} {
+				atomic.AddInt32(&updates, 1)
+				return existing.(int) + 1
+			})
+		}()
+	}
+	wg.Wait()
+	if inserts != 1 || updates != int32(number-1) {
+		t.Fatalf("Inconsistent call count: expected: %d %d, actual: %d %d",
+			1, number-1, inserts, updates)
+	}
+	if element := cm.Get("counter"); element != number {
+		t.Fatalf("Inconsistent element: expected: %v, actual: %v", number, element)
+	}
+}
+
+func TestCmapGetAndUpdate(t *testing.T) {
+	cm, _ := NewConcurrentMap(2, nil)
+	increment := func(old interface{}, exists bool) interface{} {
+		if !exists {
+			return 1
+		}
+		return old.(int) + 1
+	}
+	old, newElement, existed := cm.GetAndUpdate("a", increment)
+	if old != nil || newElement != 1 || existed {
+		t.Fatalf("Inconsistent result: expected: <nil> 1 false, actual: %v %v %v", old, newElement, existed)
+	}
+	old, newElement, existed = cm.GetAndUpdate("a", increment)
+	if old != 1 || newElement != 2 || !existed {
+		t.Fatalf("Inconsistent result: expected: 1 2 true, actual: %v %v %v", old, newElement, existed)
+	}
+	if element := cm.Get("a"); element != 2 {
+		t.Fatalf("Inconsistent element: expected: %v, actual: %v", 2, element)
+	}
+	old, newElement, existed = cm.GetAndUpdate("a", func(old interface{}, exists bool) interface{} {
+		return nil
+	})
+	if old != 2 || newElement != nil || !existed || cm.Get("a") != 2 {
+		t.Fatalf("Inconsistent result: expected: 2 <nil> true, actual: %v %v %v", old, newElement, existed)
+	}
+
+	var wg sync.WaitGroup
+	number := 50
+	olds := make([]interface{}, number)
+	for i := 0; i < number; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			olds[i], _, _ = cm.GetAndUpdate("counter", increment)
+		}(i)
+	}
+	wg.Wait()
+	seen := make(map[interface{}]bool)
+	for _, old := range olds {
+		if seen[old] {
+			t.Fatalf("Duplicate old element: %v", old)
+		}
+		seen[old] = true
+	}
+	if element := cm.Get("counter"); element != number {
+		t.Fatalf("Inconsistent element: expected: %v, actual: %v", number, element)
+	}
+}
+
+func TestCmapMergeKey(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	sum := func(existing, incoming interface{}) interface{} {
+		return existing.(int) + incoming.(int)
+	}
+	appendSlice := func(existing, incoming interface{}) interface{} {
+		// 不能修改已有的切片，它可能正在被其他 goroutine 读取
+		merged := append([]int(nil), existing.([]int)...)
+		return append(merged, incoming.([]int)...)
+	}
+	var wg sync.WaitGroup
+	number := 100
+	for i := 0; i < number; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := cm.MergeKey("sum", i, sum); err != nil {
+				t.Errorf("An error occurs when merging the sum: %s", err)
+			}
+			if _, err := cm.MergeKey("slice", []int{i}, appendSlice); err != nil {
+				t.Errorf("An error occurs when merging the slice: %s", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if element := cm.Get("sum"); element != number*(number-1)/2 {
+		t.Fatalf("Inconsistent element: expected: %v, actual: %v", number*(number-1)/2, element)
+	}
+	slice := cm.Get("slice").([]int)
+	if len(slice) != number {
+		t.Fatalf("Inconsistent slice length: expected: %d, actual: %d", number, len(slice))
+	}
+	seen := make(map[int]bool)
+	for _, v := range slice {
+		if seen[v] {
+			t.Fatalf("Duplicate element in slice: %v", v)
+		}
+		seen[v] = true
+	}
+	if cm.Len() != 2 {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", 2, cm.Len())
+	}
+
+	if merged, err := cm.MergeKey("sum", 1, func(existing, incoming interface{}) interface{} {
+		return nil
+	}); merged != nil || err == nil || cm.Get("sum") != number*(number-1)/2 {
+		t.Fatalf("Inconsistent result of a failing merge: %v %v (element: %v)", merged, err, cm.Get("sum"))
+	}
+	// 元素已被取走时直接放入 incoming
+	cm.TakeElement("sum")
+	if merged, err := cm.MergeKey("sum", 7, sum); merged != 7 || err != nil || cm.Get("sum") != 7 {
+		t.Fatalf("Inconsistent result: expected: 7 <nil>, actual: %v %v (element: %v)", merged, err, cm.Get("sum"))
+	}
+	if _, err := cm.MergeKey("sum", nil, sum); err == nil {
+		t.Fatal("No error when merging a nil element!")
+	}
+	if _, err := cm.MergeKey("sum", 1, nil); err == nil {
+		t.Fatal("No error when merging with a nil function!")
+	}
+}
+
+func TestCmapTakeElement(t *testing.T) {
+	cm, _ := NewConcurrentMap(2, nil)
+	cm.Put("a", 1)
+	if element, ok := cm.TakeElement("a"); !ok || element != 1 {
+		t.Fatalf("Inconsistent taken element: expected: %v true, actual: %v %v", 1, element, ok)
+	}
+	for i := 0; i < 2; i++ {
+		if element, ok := cm.TakeElement("a"); ok || element != nil {
+			t.Fatalf("Inconsistent taken element: expected: <nil> false, actual: %v %v", element, ok)
+		}
+	}
+	if element := cm.Get("a"); element != nil {
+		t.Fatalf("Inconsistent element: expected: %v, actual: %v", nil, element)
+	}
+	if !cm.Contains("a") || cm.Len() != 1 {
+		t.Fatalf("Key a has been removed by TakeElement!")
+	}
+	if element, _, ok := cm.LoadVersioned("a"); !ok || element != nil {
+		t.Fatalf("Inconsistent loaded element: expected: <nil> true, actual: %v %v", element, ok)
+	}
+	if _, _, ok := cm.LoadVersioned("b"); ok {
+		t.Fatalf("Found a missing key b!")
+	}
+	if element, ok := cm.TakeElement("b"); ok || element != nil {
+		t.Fatalf("Inconsistent taken element: expected: <nil> false, actual: %v %v", element, ok)
+	}
+	cm.Range(func(key string, element interface{}) bool {
+		if element != nil {
+			t.Fatalf("Inconsistent element in range: expected: %v, actual: %v", nil, element)
+		}
+		return true
+	})
+	// 重新放入后可以再次取走
+	cm.Put("a", 2)
+	if element, ok := cm.TakeElement("a"); !ok || element != 2 {
+		t.Fatalf("Inconsistent taken element: expected: %v true, actual: %v %v", 2, element, ok)
+	}
+
+	var taken int32
+	cm.Put("race", 1)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := cm.TakeElement("race"); ok {
+				atomic.AddInt32(&taken, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if taken != 1 {
+		t.Fatalf("Inconsistent take count: expected: %d, actual: %d", 1, taken)
+	}
+}
+
+func TestCmapLoadPointer(t *testing.T) {
+	type counter struct {
+		n int
+	}
+	cm, _ := NewConcurrentMap(2, nil)
+	c := &counter{}
+	cm.Put("a", c)
+	cm.Put("b", 1)
+
+	// Get 返回的是 map 中的元素本身
+	cm.Get("a").(*counter).n++
+	if c.n != 1 || cm.Get("a").(*counter).n != 1 {
+		t.Fatalf("Inconsistent mutated value: expected: %d, actual: %d", 1, cm.Get("a").(*counter).n)
+	}
+	pointer, ok := cm.LoadPointer("a")
+	if !ok || pointer != unsafe.Pointer(c) {
+		t.Fatalf("Inconsistent pointer: expected: %p true, actual: %p %v", c, pointer, ok)
+	}
+	(*counter)(pointer).n++
+	if cm.Get("a").(*counter).n != 2 {
+		t.Fatalf("Inconsistent mutated value: expected: %d, actual: %d", 2, cm.Get("a").(*counter).n)
+	}
+	if _, ok := cm.LoadPointer("b"); ok {
+		t.Fatal("Loaded a pointer from a non-pointer element!")
+	}
+	if _, ok := cm.LoadPointer("c"); ok {
+		t.Fatal("Loaded a pointer from a missing key!")
+	}
+}
+
+func TestCmapVerifyPlacement(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil, WithBackgroundRehash(true))
+	for i := 0; i < 1000; i++ {
+		cm.Put(fmt.Sprintf("key-%d", i), i)
+	}
+	c := cm.(*myConcurrentMap)
+	for _, s := range c.getSegments() {
+		waitRehash(t, s.(*segment))
+	}
+	if err := cm.VerifyPlacement(); err != nil {
+		t.Fatalf("An error occurs when verifying a clean map: %s", err)
+	}
+	if err := cm.Resize(8); err != nil {
+		t.Fatalf("An error occurs when resizing the map: %s", err)
+	}
+	if err := cm.VerifyPlacement(); err != nil {
+		t.Fatalf("An error occurs when verifying a resized map: %s", err)
+	}
+	for _, s := range c.getSegments() {
+		waitRehash(t, s.(*segment))
+	}
+
+	// 将一个键值对放入错误的散列桶
+	p, _ := c.newPair("misplaced", 1)
+	s := c.findSegment(p.Hash()).(*segment)
+	s.lock.Lock()
+	s.buckets[int((p.Hash()+1)%uint64(s.bucketsLen))].Put(p, nil)
+	s.lock.Unlock()
+	err := cm.VerifyPlacement()
+	if _, ok := err.(MisplacedPairError); !ok {
+		t.Fatalf("Inconsistent error type: expected: %T, actual: %T (%v)", MisplacedPairError{}, err, err)
+	}
+
+	// 将一个键值对放入错误的散列段
+	cm, _ = NewConcurrentMap(4, nil)
+	c = cm.(*myConcurrentMap)
+	p, _ = c.newPair("misplaced", 1)
+	index := segmentIndex(p.Hash(), 4)
+	c.getSegments()[(index+1)%4].Put(p)
+	if err := cm.VerifyPlacement(); err == nil {
+		t.Fatal("Couldn't detect a pair in the wrong segment!")
+	}
+}
+
+func TestCmapPeek(t *testing.T) {
+	cm, _ := NewConcurrentMap(2, nil, WithAccessCounting(true), WithSoftValues(true))
+	cm.Put("a", 1)
+	cm.Put("b", 2)
+	cm.Get("b")
+	c := cm.(*myConcurrentMap)
+	p := c.findSegment(c.opts.hash("a")).Get("a")
+	touched := p.Touched()
+	for i := 0; i < 10; i++ {
+		if element, ok := cm.Peek("a"); !ok || element != 1 {
+			t.Fatalf("Inconsistent peeked element: expected: %v true, actual: %v %v", 1, element, ok)
+		}
+	}
+	if p.AccessCount() != 0 || p.Touched() != touched {
+		t.Fatalf("Peek changes the access stats: count: %d, touched: %d -> %d", p.AccessCount(), touched, p.Touched())
+	}
+	if keys := cm.LeastFrequent(1); len(keys) != 1 || keys[0] != "a" {
+		t.Fatalf("Inconsistent least frequent keys: expected: %v, actual: %v", []string{"a"}, keys)
+	}
+	cm.Get("a")
+	cm.Get("a")
+	if keys := cm.LeastFrequent(1); len(keys) != 1 || keys[0] != "b" {
+		t.Fatalf("Inconsistent least frequent keys: expected: %v, actual: %v", []string{"b"}, keys)
+	}
+	if _, ok := cm.Peek("c"); ok {
+		t.Fatal("Peeked a missing key!")
+	}
+}
+
+func TestCmapAsLookupFunc(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	number := 100
+	for i := 0; i < number; i++ {
+		cm.Put(fmt.Sprintf("key-%d", i), i)
+	}
+	lookup := cm.AsLookupFunc()
+	var wg sync.WaitGroup
+	errs := make(chan string, 10)
+	for g := 0; g < 10; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < number; i++ {
+				element, ok := lookup(fmt.Sprintf("key-%d", i))
+				if !ok || element != i {
+					errs <- fmt.Sprintf("key-%d: %v %v", i, element, ok)
+					return
+				}
+				if _, ok := lookup(fmt.Sprintf("missing-%d", i)); ok {
+					errs <- fmt.Sprintf("missing-%d is found", i)
+					return
+				}
+			}
+		}(g)
+	}
+	// 调整并发量后查找函数依然有效
+	cm.Resize(8)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("Inconsistent lookup result: %s", err)
+	}
+	cm.Put("new", 1)
+	if element, ok := lookup("new"); !ok || element != 1 {
+		t.Fatalf("Inconsistent lookup result: expected: %v true, actual: %v %v", 1, element, ok)
+	}
+}
+
+func TestCmapLenConsistency(t *testing.T) {
+	cm, _ := NewConcurrentMap(8, nil)
+	c := cm.(*myConcurrentMap)
+	sum := func() uint64 {
+		var total uint64
+		for _, s := range c.getSegments() {
+			total += s.Size()
+		}
+		return total
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				key := fmt.Sprintf("key-%d-%d", g, i%100)
+				switch i % 3 {
+				case 0, 1:
+					cm.Put(key, i)
+				default:
+					cm.Delete(key)
+				}
+				cm.Len()
+			}
+		}(g)
+	}
+	wg.Wait()
+	if cm.Len() != sum() {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", sum(), cm.Len())
+	}
+	for i := 0; i < 100; i++ {
+		cm.Put(fmt.Sprintf("extra-%d", i), i)
+		if cm.Len() != sum() {
+			t.Fatalf("Inconsistent map length: expected: %d, actual: %d", sum(), cm.Len())
+		}
+	}
+}
+
+func TestCmapRangeOfType(t *testing.T) {
+	type foo struct{ n int }
+	cm, _ := NewConcurrentMap(2, nil)
+	cm.Put("s1", "one")
+	cm.Put("s2", "two")
+	cm.Put("i1", 1)
+	cm.Put("f1", &foo{1})
+	cm.Put("f2", foo{2})
+	cm.Put("b1", []byte("one"))
+
+	visit := func(typ reflect.Type) []string {
+		var keys []string
+		cm.RangeOfType(typ, func(key string, element interface{}) bool {
+			if reflect.TypeOf(element) != typ {
+				t.Fatalf("Inconsistent element type: expected: %v, actual: %T", typ, element)
+			}
+			keys = append(keys, key)
+			return true
+		})
+		sort.Strings(keys)
+		return keys
+	}
+	if keys := visit(reflect.TypeOf("")); !reflect.DeepEqual(keys, []string{"s1", "s2"}) {
+		t.Fatalf("Inconsistent keys: expected: %v, actual: %v", []string{"s1", "s2"}, keys)
+	}
+	if keys := visit(reflect.TypeOf(&foo{})); !reflect.DeepEqual(keys, []string{"f1"}) {
+		t.Fatalf("Inconsistent keys: expected: %v, actual: %v", []string{"f1"}, keys)
+	}
+	if keys := visit(reflect.TypeOf(1.5)); keys != nil {
+		t.Fatalf("Inconsistent keys: expected: %v, actual: %v", nil, keys)
+	}
+	var count int
+	cm.RangeOfType(reflect.TypeOf(""), func(key string, element interface{}) bool {
+		count++
+		return false
+	})
+	if count != 1 {
+		t.Fatalf("Inconsistent visit count: expected: %d, actual: %d", 1, count)
+	}
+}
+
+func TestCmapDeleteMatching(t *testing.T) {
+	var evicted int32
+	cm, _ := NewConcurrentMap(4, nil, WithOnEvict(func(key string, element interface{}) {
+		atomic.AddInt32(&evicted, 1)
+	}))
+	number := 100
+	for i := 0; i < number; i++ {
+		cm.Put(fmt.Sprintf("session:%d", i), i)
+		cm.Put(fmt.Sprintf("user:%d", i), i)
+	}
+	if n := cm.DeleteMatching(regexp.MustCompile(`^session:\d*7$`)); n != 10 {
+		t.Fatalf("Inconsistent deleted count: expected: %d, actual: %d", 10, n)
+	}
+	if evicted != 10 {
+		t.Fatalf("Inconsistent evicted count: expected: %d, actual: %d", 10, evicted)
+	}
+	if cm.Len() != uint64(2*number-10) {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", 2*number-10, cm.Len())
+	}
+	for i := 0; i < number; i++ {
+		session := cm.Get(fmt.Sprintf("session:%d", i))
+		if i%10 == 7 && session != nil {
+			t.Fatalf("Inconsistent element: expected: %v, actual: %v", nil, session)
+		}
+		if i%10 != 7 && session != i {
+			t.Fatalf("Inconsistent element: expected: %v, actual: %v", i, session)
+		}
+		if user := cm.Get(fmt.Sprintf("user:%d", i)); user != i {
+			t.Fatalf("Inconsistent element: expected: %v, actual: %v", i, user)
+		}
+	}
+	if n := cm.DeleteMatching(regexp.MustCompile(`^session:`)); n != number-10 {
+		t.Fatalf("Inconsistent deleted count: expected: %d, actual: %d", number-10, n)
+	}
+	if n := cm.DeleteMatching(regexp.MustCompile(`^session:`)); n != 0 {
+		t.Fatalf("Inconsistent deleted count: expected: %d, actual: %d", 0, n)
+	}
+	if cm.Len() != uint64(number) {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", number, cm.Len())
+	}
+}
+
+func TestCmapCallbackBlocksSegment(t *testing.T) {
+	cm, _ := NewConcurrentMap(1, nil)
+	cm.Put("other", 1)
+	// 在回调中启动同一散列段的 Get，并检查它直到回调返回后才能完成
+	blocked := func(name string) func() {
+		return func() {
+			done := make(chan struct{})
+			go func() {
+				cm.Get("other")
+				close(done)
+			}()
+			select {
+			case <-done:
+				t.Errorf("Get is not blocked by the callback of %s", name)
+			case <-time.After(20 * time.Millisecond):
+			}
+		}
+	}
+	callbacks := []struct {
+		name string
+		run  func(wait func())
+	}{
+		{"LoadOrStoreFunc", func(wait func()) {
+			cm.LoadOrStoreFunc("a", func() interface{} { wait(); return 1 })
+		}},
+		{"Upsert", func(wait func()) {
+			cm.Upsert("a", func() interface{} { wait(); return 1 },
+				func(existing interface{}) interface{} { wait(); return 2 })
+		}},
+		{"GetAndUpdate", func(wait func()) {
+			cm.GetAndUpdate("a", func(old interface{}, exists bool) interface{} { wait(); return 3 })
+		}},
+	}
+	for _, callback := range callbacks {
+		callback.run(blocked(callback.name))
+		finished := make(chan struct{})
+		go func() {
+			cm.Get("other")
+			close(finished)
+		}()
+		select {
+		case <-finished:
+		case <-time.After(time.Second):
+			t.Fatalf("Get is still blocked after the callback of %s returns", callback.name)
+		}
+	}
+	if element := cm.Get("a"); element != 3 {
+		t.Fatalf("Inconsistent element: expected: %v, actual: %v", 3, element)
+	}
+}
+
+func TestCmapGetInto(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	for i := 0; i < 10; i++ {
+		cm.Put(fmt.Sprintf("key-%d", i), i)
+	}
+	cm.TakeElement("key-3")
+	dst := map[string]interface{}{"stale": 1}
+	cm.GetInto([]string{"key-1", "key-3", "missing", "key-5"}, dst)
+	expected := map[string]interface{}{"stale": 1, "key-1": 1, "key-5": 5}
+	if !reflect.DeepEqual(dst, expected) {
+		t.Fatalf("Inconsistent result: expected: %v, actual: %v", expected, dst)
+	}
+	cm.GetInto([]string{"key-1"}, nil)
+
+	cm, _ = NewConcurrentMap(4, nil, WithGetIntoReset(true))
+	cm.Put("a", 1)
+	cm.Put("b", 2)
+	cm.GetInto([]string{"a", "b"}, dst)
+	expected = map[string]interface{}{"a": 1, "b": 2}
+	if !reflect.DeepEqual(dst, expected) {
+		t.Fatalf("Inconsistent result after reset: expected: %v, actual: %v", expected, dst)
+	}
+	cm.GetInto([]string{"b", "c"}, dst)
+	expected = map[string]interface{}{"b": 2}
+	if !reflect.DeepEqual(dst, expected) {
+		t.Fatalf("Inconsistent result after reset: expected: %v, actual: %v", expected, dst)
+	}
+}
+
+func TestCmapReconcileLen(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	number := 100
+	for i := 0; i < number; i++ {
+		cm.Put(fmt.Sprintf("key-%d", i), i)
+	}
+	if cm.ReconcileLen() {
+		t.Fatal("The length is corrected without drift!")
+	}
+	m := cm.(*myConcurrentMap)
+	for _, drifted := range []uint64{7, ^uint64(0)} {
+		atomic.StoreUint64(&m.total, drifted)
+		if !cm.ReconcileLen() {
+			t.Fatalf("The drifted length %d is not corrected!", drifted)
+		}
+		if cm.Len() != uint64(number) {
+			t.Fatalf("Inconsistent length: expected: %d, actual: %d", number, cm.Len())
+		}
+	}
+
+	// 与写操作并发调用
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				key := fmt.Sprintf("extra-%d-%d", w, i)
+				cm.Put(key, i)
+				if i%2 == 0 {
+					cm.Delete(key)
+				}
+			}
+		}(w)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			if cm.ReconcileLen() {
+				t.Errorf("The length is corrected without drift!")
+				return
+			}
+		}
+	}()
+	wg.Wait()
+	if expected := uint64(number + 4*100); cm.Len() != expected || cm.ReconcileLen() {
+		t.Fatalf("Inconsistent length: expected: %d, actual: %d", expected, cm.Len())
+	}
+}
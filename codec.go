@@ -0,0 +1,46 @@
+package cmap
+
+// encodeElement 会在设置了编码函数时返回编码后的元素
+// 所有放入元素的方法都会经过这里，因此 WithRejectPairElements 的检查也在这里进行
+func (c *myConcurrentMap) encodeElement(element interface{}) (interface{}, error) {
+	if c.opts.rejectPairElements {
+		if _, ok := element.(Pair); ok {
+			return nil, newIllegalParameterError("element is a pair")
+		}
+	}
+	if c.opts.elementEncoder == nil || element == nil {
+		return element, nil
+	}
+	return c.opts.elementEncoder(element)
+}
+
+// decodeElement 会在设置了解码函数时返回解码后的元素
+// 解码失败时返回 nil 和解码函数返回的错误
+// 已被 TakeElement 取走的元素解码为 nil，热点计数器解码为其各分片之和
+func (c *myConcurrentMap) decodeElement(element interface{}) (interface{}, error) {
+	switch element.(type) {
+	case emptyElement, *hotCounter:
+		return visibleElement(element), nil
+	}
+	if c.opts.elementDecoder == nil || element == nil {
+		return element, nil
+	}
+	decoded, err := c.opts.elementDecoder(element)
+	if err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+// visibleElement 用于把内部使用的元素转换为调用方看到的元素
+// 已被 TakeElement 取走的元素转换为 nil，热点计数器转换为其各分片之和，其他元素原样返回
+// 不经过 decodeElement 的遍历方法至少要经过这里，否则会把内部类型泄露给调用方
+func visibleElement(element interface{}) interface{} {
+	switch e := element.(type) {
+	case emptyElement:
+		return nil
+	case *hotCounter:
+		return e.sum()
+	}
+	return element
+}
@@ -0,0 +1,79 @@
+package cmap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"testing"
+)
+
+func gzipEncode(element interface{}) (interface{}, error) {
+	s, ok := element.(string)
+	if !ok {
+		return nil, errors.New("not a string")
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(s)); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gzipDecode(element interface{}) (interface{}, error) {
+	r, err := gzip.NewReader(bytes.NewReader(element.([]byte)))
+	if err != nil {
+		return nil, err
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func TestCmapElementCodec(t *testing.T) {
+	cm, err := NewConcurrentMap(2, nil, WithElementCodec(gzipEncode, gzipDecode))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	value := string(bytes.Repeat([]byte("abc"), 100))
+	if _, err := cm.Put("a", value); err != nil {
+		t.Fatalf("An error occurs when putting a key-element: %s", err)
+	}
+	if got := cm.Get("a"); got != value {
+		t.Fatalf("Inconsistent element: expected: %q, actual: %q", value, got)
+	}
+	c := cm.(*myConcurrentMap)
+	stored := c.findSegment(c.opts.hash("a")).Get("a").Element()
+	b, ok := stored.([]byte)
+	if !ok {
+		t.Fatalf("Inconsistent stored element type: expected: %T, actual: %T", b, stored)
+	}
+	if len(b) >= len(value) || b[0] != 0x1f || b[1] != 0x8b {
+		t.Fatalf("Stored element is not gzip compressed: %v", b)
+	}
+	actual, loaded, err := cm.GetOrPut("a", "other")
+	if err != nil || !loaded || actual != value {
+		t.Fatalf("Inconsistent GetOrPut result: expected: %q true <nil>, actual: %q %v %v", value, actual, loaded, err)
+	}
+
+	if _, err := cm.Put("b", 1); err == nil {
+		t.Fatalf("Expected an encode error, but got nil")
+	}
+	if cm.Len() != 1 {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", 1, cm.Len())
+	}
+	broken, _ := newPairWithHash("c", c.opts.hash("c"), []byte("broken"))
+	c.findSegment(broken.Hash()).Put(broken)
+	if _, err := cm.GetWithError("c"); err == nil {
+		t.Fatalf("Expected a decode error, but got nil")
+	}
+	if got := cm.Get("c"); got != nil {
+		t.Fatalf("Inconsistent element: expected: %v, actual: %v", nil, got)
+	}
+}
@@ -0,0 +1,107 @@
+package cmap
+
+import "sync"
+
+// CounterMap 是基于 ConcurrentMap 的计数器 map，每个键对应一个 int64 类型的和
+// Add 只把增量暂存在当前 goroutine 对应的分片中，分片暂存的增量的个数达到阈值时才会写入被包装的 map，
+// 因此频繁累加同一个键的 goroutine 之间几乎没有竞争
+// 被包装的 map 中的值是最终一致的，每个分片中最多暂存阈值个尚未写入的增量，Value 和 Flush 会先写入暂存的增量
+// 分片按 goroutine 的栈地址选择，不保证每个 goroutine 独占一个分片，分片之间以各自的锁互斥
+// 被包装的 ConcurrentMap 不应再被直接修改
+type CounterMap struct {
+	cm ConcurrentMap
+	// 分片中暂存的增量的个数达到该值时写入被包装的 map
+	flushThreshold int
+	shards         []counterShard
+	mask           uintptr
+}
+
+// counterShard 代表暂存增量的一个分片
+type counterShard struct {
+	lock   sync.Mutex
+	deltas map[string]int64
+	// 上次写入以来累加的增量的个数，同一个键的多次累加分别计数
+	pending int
+	// 避免相邻分片的锁位于同一个缓存行
+	_ [48]byte
+}
+
+// NewCounterMap 会创建一个包装了给定 ConcurrentMap 的 CounterMap
+// 参数 flushThreshold 小于等于 0 时使用 DEFAULT_COUNTER_FLUSH_THRESHOLD
+func NewCounterMap(cm ConcurrentMap, flushThreshold int) *CounterMap {
+	if flushThreshold <= 0 {
+		flushThreshold = DEFAULT_COUNTER_FLUSH_THRESHOLD
+	}
+	n := shardNumber()
+	m := &CounterMap{
+		cm:             cm,
+		flushThreshold: flushThreshold,
+		shards:         make([]counterShard, n),
+		mask:           uintptr(n - 1),
+	}
+	for i := range m.shards {
+		m.shards[i].deltas = make(map[string]int64)
+	}
+	return m
+}
+
+// Add 会把 delta 暂存到当前 goroutine 对应的分片中
+// 只有在分片写入被包装的 map 时才可能返回错误，此时未写入的增量仍保留在分片中
+func (m *CounterMap) Add(key string, delta int64) error {
+	shard := &m.shards[goroutineShard(m.mask)]
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	shard.deltas[key] += delta
+	if shard.pending++; shard.pending < m.flushThreshold {
+		return nil
+	}
+	return m.flushShard(shard)
+}
+
+// Value 会先把所有分片中暂存的该键的增量写入被包装的 map，再返回其和
+// 键从未被累加过时返回 0
+func (m *CounterMap) Value(key string) (int64, error) {
+	for i := range m.shards {
+		shard := &m.shards[i]
+		shard.lock.Lock()
+		delta, ok := shard.deltas[key]
+		var err error
+		if ok {
+			if err = m.cm.Increment(key, delta); err == nil {
+				delete(shard.deltas, key)
+			}
+		}
+		shard.lock.Unlock()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, _ := m.cm.Get(key).(int64)
+	return n, nil
+}
+
+// Flush 会把所有分片中暂存的增量写入被包装的 map，遇到第一个错误时停止
+func (m *CounterMap) Flush() error {
+	for i := range m.shards {
+		shard := &m.shards[i]
+		shard.lock.Lock()
+		err := m.flushShard(shard)
+		shard.lock.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 注意！必须在分片的锁的保护下调用该方法
+func (m *CounterMap) flushShard(shard *counterShard) error {
+	for key, delta := range shard.deltas {
+		if err := m.cm.Increment(key, delta); err != nil {
+			return err
+		}
+		delete(shard.deltas, key)
+	}
+	shard.pending = 0
+	return nil
+}
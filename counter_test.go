@@ -0,0 +1,81 @@
+package cmap
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestCounterMap(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	m := NewCounterMap(cm, 8)
+	var wg sync.WaitGroup
+	workers, number, keys := 8, 1000, 20
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < number; i++ {
+				if err := m.Add(fmt.Sprintf("key-%d", i%keys), int64(w+1)); err != nil {
+					t.Errorf("An error occurs when adding to a counter: %s", err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	// 每个键被每个 goroutine 累加 number/keys 次
+	var expectedSum int64
+	for w := 0; w < workers; w++ {
+		expectedSum += int64(w + 1)
+	}
+	expected := expectedSum * int64(number/keys)
+	value, err := m.Value("key-0")
+	if err != nil || value != expected {
+		t.Fatalf("Inconsistent value: expected: %d, actual: %d (error: %v)", expected, value, err)
+	}
+	if err := m.Flush(); err != nil {
+		t.Fatalf("An error occurs when flushing counters: %s", err)
+	}
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if element := cm.Get(key); element != expected {
+			t.Fatalf("Inconsistent flushed value of %s: expected: %d, actual: %v", key, expected, element)
+		}
+	}
+	if value, err := m.Value("missing"); err != nil || value != 0 {
+		t.Fatalf("Inconsistent value: expected: %d, actual: %d (error: %v)", 0, value, err)
+	}
+
+	// 未达到阈值的增量在 Value 之前不会写入被包装的 map
+	m = NewCounterMap(cm, 0)
+	m.Add("lazy", 3)
+	if element := cm.Get("lazy"); element != nil {
+		t.Fatalf("Inconsistent element before flushing: expected: %v, actual: %v", nil, element)
+	}
+	if value, _ := m.Value("lazy"); value != 3 {
+		t.Fatalf("Inconsistent value: expected: %d, actual: %d", 3, value)
+	}
+}
+
+func TestCounterMapHotKeyFlush(t *testing.T) {
+	// 只累加一个键时也会在增量的个数达到阈值时写入被包装的 map
+	cm, _ := NewConcurrentMap(1, nil)
+	threshold := 8
+	m := NewCounterMap(cm, threshold)
+	number := threshold * len(m.shards) * 4
+	for i := 0; i < number; i++ {
+		if err := m.Add("hot", 1); err != nil {
+			t.Fatalf("An error occurs when adding to a counter: %s", err)
+		}
+	}
+	// 每个分片中最多暂存 threshold-1 个增量
+	element, _ := cm.Get("hot").(int64)
+	if lag := int64(number) - element; lag < 0 || lag >= int64(threshold*len(m.shards)) {
+		t.Fatalf("Inconsistent flushed value: expected: > %d, actual: %d",
+			number-threshold*len(m.shards), element)
+	}
+	if value, err := m.Value("hot"); err != nil || value != int64(number) {
+		t.Fatalf("Inconsistent value: expected: %d, actual: %d (error: %v)", number, value, err)
+	}
+}
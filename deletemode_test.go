@@ -0,0 +1,93 @@
+package cmap
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestOptionDeleteModeCopyFree(t *testing.T) {
+	// 所有键的散列值都相同，使删除总是发生在长链表的中间
+	cm, _ := NewConcurrentMap(1, nil, WithDeleteMode(DELETE_MODE_COPY_FREE),
+		WithHash(func(key string) uint64 { return 1 }))
+	stable := 50
+	for i := 0; i < stable; i++ {
+		cm.Put(fmt.Sprintf("stable-%d", i), i)
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 300; i++ {
+				key := fmt.Sprintf("churn-%d-%d", w, i%10)
+				cm.Put(key, i)
+				cm.Delete(key)
+			}
+		}(w)
+	}
+	for r := 0; r < 2; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 300; i++ {
+				key := fmt.Sprintf("stable-%d", i%stable)
+				if element := cm.Get(key); element != i%stable {
+					t.Errorf("Inconsistent element of %s: expected: %v, actual: %v", key, i%stable, element)
+					return
+				}
+				var count int
+				cm.Range(func(key string, element interface{}) bool {
+					count++
+					return true
+				})
+				if count < stable {
+					t.Errorf("Too few pairs in range: expected: >= %d, actual: %d", stable, count)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if cm.Len() != uint64(stable) {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", stable, cm.Len())
+	}
+	s := cm.(*myConcurrentMap).getSegments()[0]
+	if s.Size() != uint64(stable) || s.HasCycle() {
+		t.Fatalf("Inconsistent segment: size: %d, has cycle: %v", s.Size(), s.HasCycle())
+	}
+	for i := 0; i < stable; i += 2 {
+		cm.Delete(fmt.Sprintf("stable-%d", i))
+	}
+	for i := 0; i < stable; i++ {
+		element := cm.Get(fmt.Sprintf("stable-%d", i))
+		if (i%2 == 0 && element != nil) || (i%2 == 1 && element != i) {
+			t.Fatalf("Inconsistent element of stable-%d: %v", i, element)
+		}
+	}
+}
+
+func BenchmarkCmapDeleteMode(b *testing.B) {
+	number := 64
+	for _, mode := range []struct {
+		name string
+		mode DeleteMode
+	}{{"Copy", DELETE_MODE_COPY}, {"CopyFree", DELETE_MODE_COPY_FREE}} {
+		cm, _ := NewConcurrentMap(1, nil, WithDeleteMode(mode.mode),
+			WithHash(func(key string) uint64 { return 1 }))
+		keys := make([]string, number)
+		for i := range keys {
+			keys[i] = fmt.Sprintf("key-%d", i)
+			cm.Put(keys[i], i)
+		}
+		b.Run(mode.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				// 删除最早放入的键，它位于链表的末尾，需要拷贝的前置节点最多
+				key := keys[i%number]
+				cm.Delete(key)
+				cm.Put(key, i)
+			}
+		})
+	}
+}
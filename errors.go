@@ -49,3 +49,139 @@ func newPairRedistributorError(errMsg string) PairRedistributorError {
 		msg: fmt.Sprintf("concurrent map: failing pair redistribution: %s", errMsg),
 	}
 }
+
+// MapResizingError 代表正在调整并发量的错误类型。
+// 遇到该错误时可以稍后重试。
+type MapResizingError struct {
+	msg string
+}
+
+func (mre MapResizingError) Error() string {
+	return mre.msg
+}
+
+// newMapResizingError 会创建一个MapResizingError类型的实例。
+func newMapResizingError() MapResizingError {
+	return MapResizingError{
+		msg: "concurrent map: resizing in progress, please retry",
+	}
+}
+
+// CallbackPanicError 代表用户回调函数发生 panic 且已被捕获的错误类型。
+type CallbackPanicError struct {
+	msg string
+}
+
+func (cpe CallbackPanicError) Error() string {
+	return cpe.msg
+}
+
+// newCallbackPanicError 会创建一个CallbackPanicError类型的实例。
+func newCallbackPanicError() CallbackPanicError {
+	return CallbackPanicError{
+		msg: "concurrent map: callback panicked",
+	}
+}
+
+// CyclicChainError 代表散列桶的链表中存在环的错误类型。
+type CyclicChainError struct {
+	msg string
+}
+
+func (cce CyclicChainError) Error() string {
+	return cce.msg
+}
+
+// newCyclicChainError 会创建一个CyclicChainError类型的实例。
+func newCyclicChainError() CyclicChainError {
+	return CyclicChainError{
+		msg: "concurrent map: cyclic pair chain detected",
+	}
+}
+
+// ChainTooDeepError 代表查找键时访问的键值对数量达到了 WithMaxLookupDepth 设置的上限的错误类型。
+// 这通常意味着散列桶的链表因散列碰撞变得过长。
+type ChainTooDeepError struct {
+	msg string
+}
+
+func (ctde ChainTooDeepError) Error() string {
+	return ctde.msg
+}
+
+// newChainTooDeepError 会创建一个ChainTooDeepError类型的实例。
+func newChainTooDeepError(maxDepth int) ChainTooDeepError {
+	return ChainTooDeepError{
+		msg: fmt.Sprintf("concurrent map: lookup stopped after visiting %d pairs", maxDepth),
+	}
+}
+
+// CapacityExceededError 代表键值对数量已达到上限的错误类型。
+type CapacityExceededError struct {
+	msg string
+}
+
+func (cee CapacityExceededError) Error() string {
+	return cee.msg
+}
+
+// newCapacityExceededError 会创建一个CapacityExceededError类型的实例。
+func newCapacityExceededError(maxEntries uint64) CapacityExceededError {
+	return CapacityExceededError{
+		msg: fmt.Sprintf("concurrent map: capacity exceeded: max entries %d", maxEntries),
+	}
+}
+
+// ConcurrencyLimitError 代表并发量超过上限的错误类型。
+// Requested 是请求的并发量，Limit 是允许的最大并发量，可以据此换用合法的并发量重试。
+type ConcurrencyLimitError struct {
+	Requested int
+	Limit     int
+	msg       string
+}
+
+func (cle ConcurrencyLimitError) Error() string {
+	return cle.msg
+}
+
+// newConcurrencyLimitError 会创建一个ConcurrencyLimitError类型的实例。
+func newConcurrencyLimitError(requested, limit int) ConcurrencyLimitError {
+	return ConcurrencyLimitError{
+		Requested: requested,
+		Limit:     limit,
+		msg:       fmt.Sprintf("concurrent map: concurrency %d exceeds the limit %d", requested, limit),
+	}
+}
+
+// MisplacedPairError 代表键值对不在其散列值对应的散列段或散列桶中的错误类型。
+type MisplacedPairError struct {
+	msg string
+}
+
+func (mpe MisplacedPairError) Error() string {
+	return mpe.msg
+}
+
+// newMisplacedPairError 会创建一个MisplacedPairError类型的实例。
+func newMisplacedPairError(errMsg string) MisplacedPairError {
+	return MisplacedPairError{
+		msg: fmt.Sprintf("concurrent map: misplaced pair: %s", errMsg),
+	}
+}
+
+// ForeignPairError 代表键值对的散列值与当前 map 的散列函数不一致的错误类型。
+// 这通常意味着键值对是由另一个使用不同散列函数或种子的 map 创建的。
+type ForeignPairError struct {
+	msg string
+}
+
+func (fpe ForeignPairError) Error() string {
+	return fpe.msg
+}
+
+// newForeignPairError 会创建一个ForeignPairError类型的实例。
+func newForeignPairError(pair Pair) ForeignPairError {
+	return ForeignPairError{
+		msg: fmt.Sprintf("concurrent map: foreign pair: the hash of key %q doesn't match the hash function", pair.Key()),
+	}
+}
@@ -0,0 +1,15 @@
+package cmap
+
+// notifyEvicted 会为每个已离开 map 的键值对调用 WithOnEvict 设置的回调
+// 注意！必须在散列段的锁和 resizeLock 之外调用该方法
+func (c *myConcurrentMap) notifyEvicted(pairs []Pair) {
+	if c.opts.onEvict == nil {
+		return
+	}
+	for _, p := range pairs {
+		element, _ := c.decodeElement(p.Element())
+		c.opts.invokeCallback(func() {
+			c.opts.onEvict(p.Key(), element)
+		})
+	}
+}
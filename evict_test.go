@@ -0,0 +1,85 @@
+package cmap
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// evictRecorder 用于记录每个键触发回调的次数
+type evictRecorder struct {
+	lock   sync.Mutex
+	counts map[string]int
+}
+
+func (r *evictRecorder) record(key string, element interface{}) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.counts[key]++
+}
+
+func (r *evictRecorder) check(t *testing.T, keys ...string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.counts) != len(keys) {
+		t.Fatalf("Inconsistent evicted keys: expected: %v, actual: %v", keys, r.counts)
+	}
+	for _, key := range keys {
+		if r.counts[key] != 1 {
+			t.Fatalf("Inconsistent evict count of key %s: expected: %d, actual: %d", key, 1, r.counts[key])
+		}
+	}
+	r.counts = make(map[string]int)
+}
+
+func TestCmapOnEvict(t *testing.T) {
+	r := &evictRecorder{counts: make(map[string]int)}
+	var cm ConcurrentMap
+	cm, _ = NewConcurrentMap(2, nil, WithOnEvict(func(key string, element interface{}) {
+		r.record(key, element)
+		// 回调中可以访问 map
+		cm.Get(key)
+	}), WithSoftValues(true), WithSoftValuePolicy(time.Millisecond, 0))
+
+	cm.Put("a", 1)
+	cm.Put("b", 2)
+	cm.Delete("a")
+	cm.Delete("a")
+	cm.DeleteAndReturn("b")
+	cm.DeleteAndReturn("b")
+	r.check(t, "a", "b")
+
+	cm.PutWithTTL("c", 3, time.Millisecond)
+	cm.PutWithTTL("d", 4, time.Hour)
+	time.Sleep(5 * time.Millisecond)
+	cm.DeleteExpired()
+	r.check(t, "c")
+
+	// d 闲置超过了软引用元素的最长闲置时间
+	cm.ReclaimSoftValues()
+	r.check(t, "d")
+
+	cm.Put("e", 5)
+	cm.Put("f", 6)
+	cm.RangeMutable(func(key string, element interface{}) Action {
+		if key == "e" {
+			return ActionDelete
+		}
+		return ActionKeep
+	})
+	r.check(t, "e")
+
+	cm.ReplaceAll(map[string]interface{}{"g": 7})
+	r.check(t, "f")
+
+	keys, _ := genKeysInSegment(cm, 2)
+	for _, key := range keys {
+		cm.Put(key, 1)
+	}
+	if err := cm.TxSegment(keys, func(view map[string]interface{}) (map[string]interface{}, []string) {
+		return nil, keys[:1]
+	}); err != nil {
+		t.Fatalf("An error occurs when executing a transaction: %s", err)
+	}
+	r.check(t, keys[0])
+}
@@ -0,0 +1,66 @@
+package cmap
+
+import "time"
+
+// PutWithTTL 通过 Put 的同一路径放入键值对，
+// 替换已有的键时会同时替换其过期时间，因此用 Put 替换会使键永不过期
+func (c *myConcurrentMap) PutWithTTL(key string, element interface{}, ttl time.Duration) (bool, error) {
+	if ttl <= 0 {
+		return false, newIllegalParameterError("ttl must be positive")
+	}
+	p, err := c.newPair(key, element)
+	if err != nil {
+		return false, err
+	}
+	p.SetExpiry(time.Now().Add(ttl).UnixNano())
+	return c.putPair(p)
+}
+
+// GetWithTTL 在读取键值对之后根据其中存放的过期时间计算剩余的存活时间
+func (c *myConcurrentMap) GetWithTTL(key string) (interface{}, time.Duration, bool) {
+	key = c.normalizeKey(key)
+	keyHash := c.opts.hash(key)
+	pair := c.findSegment(keyHash).GetWithHash(key, keyHash)
+	if pair == nil {
+		return nil, 0, false
+	}
+	var ttl time.Duration
+	if expiry := pair.Expiry(); expiry != 0 {
+		ttl = time.Duration(expiry - time.Now().UnixNano())
+		if ttl == 0 {
+			ttl = -1
+		}
+	}
+	element, _ := c.decodeElement(pair.Element())
+	return element, ttl, true
+}
+
+// DeleteExpired 会逐个散列段地在其锁的保护下删除已过期的键值对
+// 不依赖后台清理，调用方可以自行决定在何时花费清理的开销
+func (c *myConcurrentMap) DeleteExpired() int {
+	var evicted []Pair
+	// 在释放 resizeLock 之后调用
+	defer func() {
+		c.notifyEvicted(evicted)
+	}()
+	if err := c.lockForWrite(); err != nil {
+		return 0
+	}
+	defer c.resizeLock.RUnlock()
+	now := time.Now().UnixNano()
+	for _, s := range c.getSegments() {
+		s.Atomic(func(tx SegmentTx) {
+			tx.Range(func(p Pair) bool {
+				if expiry := p.Expiry(); expiry == 0 || expiry > now {
+					return true
+				}
+				if deletedPair, ok := tx.Delete(p.Key()); ok {
+					decreaseUint64(&c.total)
+					evicted = append(evicted, deletedPair)
+				}
+				return true
+			})
+		})
+	}
+	return len(evicted)
+}
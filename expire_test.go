@@ -0,0 +1,74 @@
+package cmap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCmapDeleteExpired(t *testing.T) {
+	cm, _ := NewConcurrentMap(2, nil)
+	for _, key := range []string{"a", "b", "c"} {
+		if _, err := cm.PutWithTTL(key, 1, time.Millisecond); err != nil {
+			t.Fatalf("An error occurs when putting a key-element with ttl: %s", err)
+		}
+	}
+	for _, key := range []string{"d", "e"} {
+		cm.PutWithTTL(key, 1, time.Hour)
+	}
+	cm.Put("f", 1)
+	// 用 Put 替换后不再过期
+	cm.Put("c", 2)
+	if _, err := cm.PutWithTTL("g", 1, 0); err == nil {
+		t.Fatalf("Expected an error for non-positive ttl, but got nil")
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if n := cm.DeleteExpired(); n != 2 {
+		t.Fatalf("Inconsistent deleted count: expected: %d, actual: %d", 2, n)
+	}
+	for _, key := range []string{"a", "b"} {
+		if cm.Get(key) != nil {
+			t.Fatalf("Expired key %s has not been deleted", key)
+		}
+	}
+	for _, key := range []string{"c", "d", "e", "f"} {
+		if cm.Get(key) == nil {
+			t.Fatalf("Unexpired key %s has been deleted", key)
+		}
+	}
+	if cm.Len() != 4 {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", 4, cm.Len())
+	}
+	if n := cm.DeleteExpired(); n != 0 {
+		t.Fatalf("Inconsistent deleted count: expected: %d, actual: %d", 0, n)
+	}
+}
+
+func TestCmapGetWithTTL(t *testing.T) {
+	cm, _ := NewConcurrentMap(2, nil)
+	cm.PutWithTTL("a", 1, time.Hour)
+	cm.PutWithTTL("b", 2, time.Millisecond)
+	cm.Put("c", 3)
+
+	element, ttl1, ok := cm.GetWithTTL("a")
+	if !ok || element != 1 {
+		t.Fatalf("Inconsistent element: expected: %v true, actual: %v %v", 1, element, ok)
+	}
+	if ttl1 <= 0 || ttl1 > time.Hour {
+		t.Fatalf("Inconsistent ttl: expected: (0, %v], actual: %v", time.Hour, ttl1)
+	}
+	time.Sleep(5 * time.Millisecond)
+	_, ttl2, _ := cm.GetWithTTL("a")
+	if ttl2 >= ttl1 {
+		t.Fatalf("TTL does not decrease: before: %v, after: %v", ttl1, ttl2)
+	}
+	if _, ttl, ok := cm.GetWithTTL("b"); !ok || ttl >= 0 {
+		t.Fatalf("Inconsistent ttl of expired key: expected: < 0, actual: %v (%v)", ttl, ok)
+	}
+	if element, ttl, ok := cm.GetWithTTL("c"); !ok || element != 3 || ttl != 0 {
+		t.Fatalf("Inconsistent result for non-expiring key: expected: 3 0 true, actual: %v %v %v", element, ttl, ok)
+	}
+	if _, _, ok := cm.GetWithTTL("d"); ok {
+		t.Fatalf("Expected a missing key, but got it")
+	}
+}
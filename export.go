@@ -0,0 +1,98 @@
+package cmap
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+)
+
+// flusher 代表可以刷新缓冲区的写入器，例如 *bufio.Writer
+type flusher interface {
+	Flush() error
+}
+
+// StreamJSON 会逐个散列段地将键值对以 JSON 对象的形式写入 w
+// 每次只复制一个散列段的键值对，写入时不持有散列段的锁，因此内存峰值与单个散列段的大小相当
+// 若 w 实现了 Flush() error，每写完一个散列段都会刷新一次
+// 注意！这是弱一致的导出，不同散列段的内容不是同一时刻的快照
+func (c *myConcurrentMap) StreamJSON(w io.Writer) error {
+	if _, err := io.WriteString(w, "{"); err != nil {
+		return err
+	}
+	first := true
+	for _, s := range c.getSegments() {
+		for key, element := range s.Clone() {
+			element, err := c.decodeElement(element)
+			if err != nil {
+				return err
+			}
+			keyBytes, err := json.Marshal(key)
+			if err != nil {
+				return err
+			}
+			elementBytes, err := json.Marshal(element)
+			if err != nil {
+				return err
+			}
+			if !first {
+				if _, err := io.WriteString(w, ","); err != nil {
+					return err
+				}
+			}
+			first = false
+			if _, err := w.Write(keyBytes); err != nil {
+				return err
+			}
+			if _, err := io.WriteString(w, ":"); err != nil {
+				return err
+			}
+			if _, err := w.Write(elementBytes); err != nil {
+				return err
+			}
+		}
+		if f, ok := w.(flusher); ok {
+			if err := f.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := io.WriteString(w, "}"); err != nil {
+		return err
+	}
+	if f, ok := w.(flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// WriteCSV 会先写入表头 header（为空时不写），再为每个键值对写入 format 生成的一行
+// 与 StreamJSON 相同，每个散列段的内容是在其锁的保护下复制出来的，写入时不持有锁
+// 若 format 发生 panic 且被 WithCallbackRecovery 捕获，则返回 CallbackPanicError
+func (c *myConcurrentMap) WriteCSV(w io.Writer,
+	format func(key string, element interface{}) []string, header []string) error {
+	cw := csv.NewWriter(w)
+	if len(header) > 0 {
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+	}
+	for _, s := range c.getSegments() {
+		for key, element := range s.Clone() {
+			element, err := c.decodeElement(element)
+			if err != nil {
+				return err
+			}
+			var record []string
+			if !c.opts.invokeCallback(func() {
+				record = format(key, element)
+			}) {
+				return newCallbackPanicError()
+			}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
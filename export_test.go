@@ -0,0 +1,101 @@
+package cmap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestCmapStreamJSON(t *testing.T) {
+	cm, _ := NewConcurrentMap(8, nil)
+	expected := make(map[string]interface{})
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		var element interface{} = fmt.Sprintf("element-%d", i)
+		if i%2 == 0 {
+			element = float64(i)
+		}
+		cm.Put(key, element)
+		expected[key] = element
+	}
+	// 需要转义的键和元素
+	cm.Put("quote\"and\\slash\n", "<tag> & \"quote\"")
+	expected["quote\"and\\slash\n"] = "<tag> & \"quote\""
+
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	if err := cm.StreamJSON(w); err != nil {
+		t.Fatalf("An error occurs when streaming JSON: %s", err)
+	}
+	actual := make(map[string]interface{})
+	if err := json.Unmarshal(buf.Bytes(), &actual); err != nil {
+		t.Fatalf("An error occurs when decoding streamed JSON: %s", err)
+	}
+	if len(actual) != len(expected) {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d", len(expected), len(actual))
+	}
+	for key, element := range expected {
+		if actual[key] != element {
+			t.Fatalf("Inconsistent element: expected: %#v, actual: %#v (key: %q)",
+				element, actual[key], key)
+		}
+	}
+}
+
+func TestCmapStreamJSONEmpty(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	var buf bytes.Buffer
+	if err := cm.StreamJSON(&buf); err != nil {
+		t.Fatalf("An error occurs when streaming JSON: %s", err)
+	}
+	if buf.String() != "{}" {
+		t.Fatalf("Inconsistent JSON: expected: %s, actual: %s", "{}", buf.String())
+	}
+}
+
+func TestCmapStreamJSONError(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	cm.Put("func", func() {})
+	var buf bytes.Buffer
+	if err := cm.StreamJSON(&buf); err == nil {
+		t.Fatal("No error when streaming an unsupported element, but should not be the case!")
+	}
+}
+
+func TestCmapWriteCSV(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	expected := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		cm.Put(key, i)
+		expected[key] = fmt.Sprint(i)
+	}
+	cm.Put("comma,\"quote\"", "a,b")
+	expected["comma,\"quote\""] = "a,b"
+
+	var buf bytes.Buffer
+	err := cm.WriteCSV(&buf, func(key string, element interface{}) []string {
+		return []string{key, fmt.Sprint(element)}
+	}, []string{"key", "element"})
+	if err != nil {
+		t.Fatalf("An error occurs when writing CSV: %s", err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("An error occurs when reading CSV: %s", err)
+	}
+	if len(records) != len(expected)+1 {
+		t.Fatalf("Inconsistent row count: expected: %d, actual: %d", len(expected)+1, len(records))
+	}
+	if records[0][0] != "key" || records[0][1] != "element" {
+		t.Fatalf("Inconsistent header: expected: %v, actual: %v", []string{"key", "element"}, records[0])
+	}
+	for _, record := range records[1:] {
+		if expected[record[0]] != record[1] {
+			t.Fatalf("Inconsistent row: expected: %s,%s, actual: %v", record[0], expected[record[0]], record)
+		}
+	}
+}
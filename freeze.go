@@ -0,0 +1,15 @@
+package cmap
+
+// Freeze 获取的是 resizeLock 的写锁而不是各个散列段的锁：
+// 所有写操作都持有 resizeLock 的读锁，而读操作大多只需要散列段的锁，
+// 因此冻结只阻塞写操作，且只涉及一把锁，不会因加锁顺序而死锁
+// 例外的是 GetOrWait、Reserve（包括其返回的 commit 和 cancel）和 VerifyPlacement：
+// 它们需要 Resize 不在期间替换散列段，同样持有 resizeLock 的读锁，因此冻结期间也会被阻塞
+// 若写操作在冻结前已经开始，Freeze 会等待其完成
+func (c *myConcurrentMap) Freeze() {
+	c.resizeLock.Lock()
+}
+
+func (c *myConcurrentMap) Unfreeze() {
+	c.resizeLock.Unlock()
+}
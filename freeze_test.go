@@ -0,0 +1,66 @@
+package cmap
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCmapFreeze(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	cm.Put("key", 0)
+	cm.Freeze()
+	var wg sync.WaitGroup
+	written := make(chan string, 3)
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		cm.Put("new", 1)
+		written <- "put"
+	}()
+	go func() {
+		defer wg.Done()
+		cm.Delete("key")
+		written <- "delete"
+	}()
+	go func() {
+		defer wg.Done()
+		cm.GetOrPut("other", 1)
+		written <- "get or put"
+	}()
+	select {
+	case op := <-written:
+		t.Fatalf("The %s operation is not blocked during freezing!", op)
+	case <-time.After(50 * time.Millisecond):
+	}
+	// 读操作不受影响
+	if actual := cm.Get("key"); actual != 0 {
+		t.Fatalf("Inconsistent element: expected: %#v, actual: %#v", 0, actual)
+	}
+	var count int
+	cm.Range(func(key string, element interface{}) bool {
+		count++
+		return true
+	})
+	if count != 1 || cm.Len() != 1 {
+		t.Fatalf("Inconsistent size during freezing: expected: %d, actual: %d (len: %d)",
+			1, count, cm.Len())
+	}
+	cm.Unfreeze()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The write operations are still blocked after unfreezing!")
+	}
+	if cm.Get("new") != 1 || cm.Get("key") != nil || cm.Get("other") != 1 {
+		t.Fatal("The blocked write operations are not applied after unfreezing!")
+	}
+	// 可以再次冻结
+	cm.Freeze()
+	cm.Unfreeze()
+}
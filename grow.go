@@ -0,0 +1,101 @@
+package cmap
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// bucketNumberReserver 代表能够调整收缩下限的再分布器。
+// 散列段预先扩容后依赖它避免在键值对增长到预期数量之前又被收缩。
+type bucketNumberReserver interface {
+	// reserveBucketNumber 会把收缩时散列桶数量的下限提高到 bucketNumber。
+	reserveBucketNumber(bucketNumber uint64)
+}
+
+// reserveBucketNumber 只会提高下限，不会使其降低。
+func (pr *myPairRedistributor) reserveBucketNumber(bucketNumber uint64) {
+	for {
+		current := atomic.LoadUint64(&pr.minBucketNumber)
+		if bucketNumber <= current ||
+			atomic.CompareAndSwapUint64(&pr.minBucketNumber, current, bucketNumber) {
+			return
+		}
+	}
+}
+
+// Grow 会先完成进行中的后台再散列，再把所有键值对的副本放入新的散列桶中
+// 与后台再散列相同，旧散列桶保持不变，因此不加锁的读操作仍能完整地遍历旧链表
+func (s *segment) Grow(bucketNumber int) bool {
+	s.lock.Lock()
+	oldBuckets := s.bucketsLen
+	grown := s.grow(bucketNumber)
+	newBuckets := s.bucketsLen
+	s.lock.Unlock()
+	s.notifyRedistribute(oldBuckets, newBuckets)
+	return grown
+}
+
+// 注意！必须在互斥锁的保护下调用该方法
+func (s *segment) grow(bucketNumber int) bool {
+	if s.rehashTarget != nil {
+		s.rehashStep(s.bucketsLen)
+	}
+	if bucketNumber <= s.bucketsLen {
+		return false
+	}
+	start := time.Now()
+	buckets := make([]Bucket, bucketNumber)
+	for i := range buckets {
+		buckets[i] = newBucketOf(s.opts.bucketImpl)
+	}
+	var moved uint64
+	for _, b := range s.buckets {
+		for v, n := b.GetFirstPair(), 0; v != nil && n < MAX_CHAIN_LENGTH; v, n = v.Next(), n+1 {
+			p := v.Copy()
+			buckets[int(p.Hash()%uint64(bucketNumber))].Put(p, nil)
+			moved++
+		}
+	}
+	s.buckets = buckets
+	s.bucketsLen = bucketNumber
+	s.bucketsView.Store(buckets)
+	if reserver, ok := s.pairRedistributor.(bucketNumberReserver); ok {
+		reserver.reserveBucketNumber(uint64(bucketNumber))
+	}
+	s.pairRedistributor.UpdateThreshold(atomic.LoadUint64(&s.pairTotal), bucketNumber)
+	if s.opts.redistributionCounter != nil {
+		s.opts.redistributionCounter.record(moved, true, start)
+	}
+	atomic.AddUint64(&s.modCount, 1)
+	return true
+}
+
+// growBucketNumber 用于计算容纳 entries 个键值对所需的散列桶数量
+// 默认再分布器在散列桶的尺寸达到 100 与装载因子之积时扩容，
+// 这里使平均尺寸不超过其一半，使散列桶的尺寸在增长过程中几乎不会达到上阈限
+func growBucketNumber(entries uint64, loadFactor float64) int {
+	if loadFactor <= 0 {
+		loadFactor = DEFAULT_BUCKET_LOAD_FACTOR
+	}
+	n := math.Ceil(float64(entries) * 2 / (100 * loadFactor))
+	if n > float64(MAX_GROW_BUCKET_NUMBER) {
+		return MAX_GROW_BUCKET_NUMBER
+	}
+	return int(n)
+}
+
+// GrowTo 在 resizeLock 的读锁的保护下逐个扩容散列段，同一时刻只会阻塞一个散列段的写操作
+func (c *myConcurrentMap) GrowTo(expectedEntries uint64) error {
+	if err := c.lockForWrite(); err != nil {
+		return err
+	}
+	defer c.resizeLock.RUnlock()
+	segments := c.getSegments()
+	perSegment := (expectedEntries + uint64(len(segments)) - 1) / uint64(len(segments))
+	bucketNumber := growBucketNumber(perSegment, c.opts.loadFactor)
+	for _, s := range segments {
+		s.Grow(bucketNumber)
+	}
+	return nil
+}
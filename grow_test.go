@@ -0,0 +1,72 @@
+package cmap
+
+import (
+	"fmt"
+	"testing"
+)
+
+// countingRedistributor 会统计改变了散列桶数量的再分布次数
+type countingRedistributor struct {
+	*myPairRedistributor
+	count int
+}
+
+func (pr *countingRedistributor) Redistribe(
+	bucketStatus BucketStatus, buckets []Bucket) ([]Bucket, bool) {
+	newBuckets, changed := pr.myPairRedistributor.Redistribe(bucketStatus, buckets)
+	if changed {
+		pr.count++
+	}
+	return newBuckets, changed
+}
+
+func newCountingRedistributor() *countingRedistributor {
+	return &countingRedistributor{
+		myPairRedistributor: newDefaultPairRedistributor(
+			DEFAULT_BUCKET_LOAD_FACTOR, DEFAULT_BUCKET_NUMBER).(*myPairRedistributor),
+	}
+}
+
+func TestCmapGrowTo(t *testing.T) {
+	number := 20000
+	pr := newCountingRedistributor()
+	cm, _ := NewConcurrentMap(1, pr)
+	for i := 0; i < number; i++ {
+		cm.Put(fmt.Sprintf("key-%d", i), i)
+	}
+	if pr.count == 0 {
+		t.Fatal("No redistribution happens without GrowTo!")
+	}
+
+	pr = newCountingRedistributor()
+	cm, _ = NewConcurrentMap(1, pr)
+	cm.Put("before", 0)
+	if err := cm.GrowTo(uint64(number)); err != nil {
+		t.Fatalf("An error occurs when growing the map: %s", err)
+	}
+	s := cm.(*myConcurrentMap).getSegments()[0].(*segment)
+	grownBuckets := s.bucketsLen
+	if expected := growBucketNumber(uint64(number), DEFAULT_BUCKET_LOAD_FACTOR); grownBuckets != expected {
+		t.Fatalf("Inconsistent bucket number: expected: %d, actual: %d", expected, grownBuckets)
+	}
+	if cm.Get("before") != 0 {
+		t.Fatalf("Inconsistent element: expected: %v, actual: %v", 0, cm.Get("before"))
+	}
+	for i := 0; i < number; i++ {
+		cm.Put(fmt.Sprintf("key-%d", i), i)
+	}
+	if pr.count != 0 {
+		t.Fatalf("Inconsistent redistribution count: expected: %d, actual: %d", 0, pr.count)
+	}
+	if s.bucketsLen != grownBuckets {
+		t.Fatalf("Inconsistent bucket number: expected: %d, actual: %d", grownBuckets, s.bucketsLen)
+	}
+	for i := 0; i < number; i += 97 {
+		if element := cm.Get(fmt.Sprintf("key-%d", i)); element != i {
+			t.Fatalf("Inconsistent element: expected: %v, actual: %v", i, element)
+		}
+	}
+	if s.Grow(grownBuckets) {
+		t.Fatal("The segment grows to the same bucket number!")
+	}
+}
@@ -0,0 +1,21 @@
+package cmap
+
+import "sort"
+
+// ValueSizeHistogram 通过 Range 遍历所有元素，因此是弱一致的
+// bounds 不会被修改，未排序时会先复制再排序
+func (c *myConcurrentMap) ValueSizeHistogram(sizer func(element interface{}) int, bounds []int) []uint64 {
+	if !sort.IntsAreSorted(bounds) {
+		sorted := make([]int, len(bounds))
+		copy(sorted, bounds)
+		sort.Ints(sorted)
+		bounds = sorted
+	}
+	counts := make([]uint64, len(bounds)+1)
+	c.Range(func(key string, element interface{}) bool {
+		// 返回第一个不小于 size 的上界的索引
+		counts[sort.SearchInts(bounds, sizer(element))]++
+		return true
+	})
+	return counts
+}
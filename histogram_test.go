@@ -0,0 +1,33 @@
+package cmap
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCmapValueSizeHistogram(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	sizes := []int{0, 1, 5, 10, 11, 100, 1000}
+	for i, size := range sizes {
+		cm.Put(fmt.Sprintf("key-%d", i), strings.Repeat("x", size))
+	}
+	cm.Put("int", 42)
+	sizer := func(element interface{}) int {
+		if s, ok := element.(string); ok {
+			return len(s)
+		}
+		return 0
+	}
+	expected := []uint64{2, 2, 1, 2, 1}
+	for _, bounds := range [][]int{{0, 5, 10, 100}, {100, 10, 5, 0}} {
+		actual := cm.ValueSizeHistogram(sizer, bounds)
+		if fmt.Sprint(actual) != fmt.Sprint(expected) {
+			t.Fatalf("Inconsistent histogram: expected: %v, actual: %v (bounds: %v)",
+				expected, actual, bounds)
+		}
+	}
+	if actual := cm.ValueSizeHistogram(sizer, nil); len(actual) != 1 || actual[0] != 8 {
+		t.Fatalf("Inconsistent histogram: expected: %v, actual: %v", []uint64{8}, actual)
+	}
+}
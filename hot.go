@@ -0,0 +1,152 @@
+package cmap
+
+import (
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+)
+
+// hotCounterShard 代表热点计数器的一个分片
+// 每个分片独占一个缓存行，避免不同 CPU 上的累加互相使对方的缓存失效
+type hotCounterShard struct {
+	n int64
+	_ [56]byte
+}
+
+// hotCounter 代表分片存放的整数计数器，所有分片都以原子操作访问
+// 它会作为热点键的元素存放在散列段中，读取元素时返回各分片之和
+type hotCounter struct {
+	shards []hotCounterShard
+	mask   uintptr
+}
+
+// add 用于把 delta 累加到当前 goroutine 对应的分片上
+func (hc *hotCounter) add(delta int64) {
+	atomic.AddInt64(&hc.shards[goroutineShard(hc.mask)].n, delta)
+}
+
+// goroutineShard 用于为当前 goroutine 选择一个分片，mask 为分片数量减一
+// Go 无法获取当前所在的 CPU，这里以当前 goroutine 的栈地址选择分片，
+// 使并发的 goroutine 大概率落在不同的分片上
+// 注意！这并不保证一个 goroutine 独占一个分片：不同 goroutine 的栈可能落在同一个分片上，
+// 栈扩容后同一个 goroutine 也可能换到另一个分片，因此分片只能减少竞争，访问分片仍需加锁或使用原子操作
+func goroutineShard(mask uintptr) uintptr {
+	var marker byte
+	return (uintptr(unsafe.Pointer(&marker)) >> 12) & mask
+}
+
+// shardNumber 用于返回不小于 GOMAXPROCS 的最小的 2 的幂
+func shardNumber() int {
+	n := 1
+	for n < runtime.GOMAXPROCS(0) {
+		n <<= 1
+	}
+	return n
+}
+
+// sum 用于返回各分片之和，与并发的 add 之间不是原子的
+func (hc *hotCounter) sum() int64 {
+	var total int64
+	for i := range hc.shards {
+		total += atomic.LoadInt64(&hc.shards[i].n)
+	}
+	return total
+}
+
+func newHotCounter(initial int64) *hotCounter {
+	n := shardNumber()
+	hc := &hotCounter{
+		shards: make([]hotCounterShard, n),
+		mask:   uintptr(n - 1),
+	}
+	hc.shards[0].n = initial
+	return hc
+}
+
+// MarkHot 在散列段的锁的保护下把键的元素替换为热点计数器，并登记到 hotCounters 中
+// 之后 Increment 可以不加锁地找到计数器
+func (c *myConcurrentMap) MarkHot(key string) error {
+	if c.opts.elementEncoder != nil {
+		return newIllegalParameterError("hot keys are not supported with an element codec")
+	}
+	if err := c.lockForWrite(); err != nil {
+		return err
+	}
+	defer c.resizeLock.RUnlock()
+	key = c.normalizeKey(key)
+	var err error
+	c.findSegment(c.opts.hash(key)).Atomic(func(tx SegmentTx) {
+		var initial int64
+		if p := tx.Get(key); p != nil {
+			switch element := p.Element().(type) {
+			case *hotCounter:
+				c.hotCounters.Store(key, element)
+				return
+			case int64:
+				initial = element
+			default:
+				err = newIllegalParameterError("element of hot key is not int64")
+				return
+			}
+		}
+		hc := newHotCounter(initial)
+		var p Pair
+		if p, err = c.newPair(key, hc); err != nil {
+			return
+		}
+		if _, err = c.putInTx(tx, p); err == nil {
+			c.hotCounters.Store(key, hc)
+		}
+	})
+	return err
+}
+
+// Increment 对热点键只读取 hotCounters 和不加锁的散列桶快照，确认计数器仍是键的元素后以原子操作累加，
+// 因此既不获取散列段的锁也不获取 resizeLock，Freeze 和 Resize 期间也不会被阻塞
+// 代价是确认与累加之间计数器可能已被 Delete 或 SnapshotAndReset 等操作替换，
+// 这次累加会落在不再属于 map 的计数器上而丢失，且不会返回错误；需要精确计数时不要对该键 MarkHot
+// 其他情况下在散列段的锁的保护下累加 int64 类型的元素
+func (c *myConcurrentMap) Increment(key string, delta int64) error {
+	key = c.normalizeKey(key)
+	keyHash := c.opts.hash(key)
+	if v, ok := c.hotCounters.Load(key); ok {
+		hc := v.(*hotCounter)
+		// 键可能已被 Put 或 Delete 替换了计数器，此时走加锁的路径
+		if p := c.findSegment(keyHash).GetStaleWithHash(key, keyHash); p != nil && p.Element() == hc {
+			hc.add(delta)
+			return nil
+		}
+	}
+	if err := c.lockForWrite(); err != nil {
+		return err
+	}
+	defer c.resizeLock.RUnlock()
+	var err error
+	c.findSegment(keyHash).Atomic(func(tx SegmentTx) {
+		p := tx.Get(key)
+		var current int64
+		if p != nil {
+			if hc, ok := p.Element().(*hotCounter); ok {
+				hc.add(delta)
+				c.hotCounters.Store(key, hc)
+				return
+			}
+			var element interface{}
+			if element, err = c.decodeElement(p.Element()); err != nil {
+				return
+			}
+			n, ok := element.(int64)
+			if !ok {
+				err = newIllegalParameterError("element to increment is not int64")
+				return
+			}
+			current = n
+		}
+		c.hotCounters.Delete(key)
+		if p, err = c.newPair(key, current+delta); err != nil {
+			return
+		}
+		_, err = c.putInTx(tx, p)
+	})
+	return err
+}
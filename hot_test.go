@@ -0,0 +1,186 @@
+package cmap
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestCmapMarkHotIncrement(t *testing.T) {
+	cm, _ := NewConcurrentMap(2, nil)
+	cm.Put("hits", int64(5))
+	if err := cm.MarkHot("hits"); err != nil {
+		t.Fatalf("An error occurs when marking a hot key: %s", err)
+	}
+	if err := cm.MarkHot("hits"); err != nil {
+		t.Fatalf("An error occurs when marking a hot key twice: %s", err)
+	}
+	var wg sync.WaitGroup
+	workers, number := 8, 1000
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < number; i++ {
+				if err := cm.Increment("hits", 1); err != nil {
+					t.Errorf("An error occurs when incrementing a hot key: %s", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	expected := int64(5 + workers*number)
+	if element := cm.Get("hits"); element != expected {
+		t.Fatalf("Inconsistent element: expected: %v, actual: %v", expected, element)
+	}
+	var ranged interface{}
+	cm.Range(func(key string, element interface{}) bool {
+		ranged = element
+		return true
+	})
+	if ranged != expected {
+		t.Fatalf("Inconsistent ranged element: expected: %v, actual: %v", expected, ranged)
+	}
+	if cm.Len() != 1 {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", 1, cm.Len())
+	}
+
+	// Put 替换计数器之后，该键变回普通的 int64 元素
+	cm.Put("hits", int64(1))
+	if err := cm.Increment("hits", 2); err != nil {
+		t.Fatalf("An error occurs when incrementing a replaced hot key: %s", err)
+	}
+	if element := cm.Get("hits"); element != int64(3) {
+		t.Fatalf("Inconsistent element: expected: %v, actual: %v", int64(3), element)
+	}
+
+	if err := cm.Increment("fresh", 7); err != nil || cm.Get("fresh") != int64(7) {
+		t.Fatalf("Inconsistent element: expected: %v, actual: %v (error: %v)", int64(7), cm.Get("fresh"), err)
+	}
+	if err := cm.MarkHot("new"); err != nil || cm.Get("new") != int64(0) {
+		t.Fatalf("Inconsistent element: expected: %v, actual: %v (error: %v)", int64(0), cm.Get("new"), err)
+	}
+	cm.Put("name", "not a number")
+	if err := cm.MarkHot("name"); err == nil {
+		t.Fatal("No error when marking a non-int64 key as hot!")
+	}
+	if err := cm.Increment("name", 1); err == nil {
+		t.Fatal("No error when incrementing a non-int64 element!")
+	}
+}
+
+func BenchmarkCmapIncrement(b *testing.B) {
+	for _, hot := range []bool{false, true} {
+		name := "Locked"
+		if hot {
+			name = "Hot"
+		}
+		cm, _ := NewConcurrentMap(16, nil)
+		cm.Put("counter", int64(0))
+		if hot {
+			cm.MarkHot("counter")
+		}
+		b.Run(name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					cm.Increment("counter", 1)
+				}
+			})
+		})
+	}
+}
+
+// newSentinelMap 会创建一个同时包含已被取走的键和热点键的 map
+func newSentinelMap(t *testing.T) ConcurrentMap {
+	cm, _ := NewConcurrentMap(1, nil)
+	cm.Put("plain", 1)
+	cm.Put("taken", "x")
+	if _, ok := cm.TakeElement("taken"); !ok {
+		t.Fatalf("Can not take the element of key taken")
+	}
+	cm.Put("hot", int64(5))
+	if err := cm.MarkHot("hot"); err != nil {
+		t.Fatalf("An error occurs when marking a hot key: %s", err)
+	}
+	if err := cm.Increment("hot", 2); err != nil {
+		t.Fatalf("An error occurs when incrementing a hot key: %s", err)
+	}
+	return cm
+}
+
+// checkSentinelElements 用于检查取走的键和热点键的元素是调用方应该看到的元素
+func checkSentinelElements(t *testing.T, api string, m map[string]interface{}) {
+	if element, ok := m["taken"]; ok && element != nil {
+		t.Fatalf("Inconsistent element of taken key in %s: expected: %v, actual: %#v", api, nil, element)
+	}
+	if element, ok := m["hot"]; ok && element != int64(7) {
+		t.Fatalf("Inconsistent element of hot key in %s: expected: %v, actual: %#v", api, int64(7), element)
+	}
+}
+
+func TestCmapSentinelElements(t *testing.T) {
+	cm := newSentinelMap(t)
+
+	var buf bytes.Buffer
+	if err := cm.StreamJSON(&buf); err != nil {
+		t.Fatalf("An error occurs when streaming JSON: %s", err)
+	}
+	var streamed map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &streamed); err != nil {
+		t.Fatalf("An error occurs when parsing streamed JSON %s: %s", buf.String(), err)
+	}
+	if streamed["taken"] != nil || streamed["hot"] != float64(7) {
+		t.Fatalf("Inconsistent streamed JSON: %s", buf.String())
+	}
+
+	clone, err := cm.CloneSegment(0)
+	if err != nil {
+		t.Fatalf("An error occurs when cloning a segment: %s", err)
+	}
+	if _, ok := clone["taken"]; !ok || len(clone) != 3 {
+		t.Fatalf("Inconsistent clone: %v", clone)
+	}
+	checkSentinelElements(t, "CloneSegment", clone)
+
+	for i := 0; i < 50; i++ {
+		checkSentinelElements(t, "RandomEntries", cm.RandomEntries(2))
+	}
+
+	if element, ok := cm.GetOrWait("taken", 0); ok || element != nil {
+		t.Fatalf("Inconsistent GetOrWait of taken key: element: %#v, ok: %v", element, ok)
+	}
+	if element, ok := cm.GetOrWait("hot", 0); !ok || element != int64(7) {
+		t.Fatalf("Inconsistent GetOrWait of hot key: element: %#v, ok: %v", element, ok)
+	}
+
+	err = cm.TxSegment([]string{"taken", "hot"}, func(view map[string]interface{}) (map[string]interface{}, []string) {
+		if _, ok := view["taken"]; !ok || len(view) != 2 {
+			t.Errorf("Inconsistent transaction view: %v", view)
+		}
+		checkSentinelElements(t, "TxSegment", view)
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("An error occurs when running the transaction: %s", err)
+	}
+
+	ranged := make(map[string]interface{})
+	cm.RangeByHash(func(key string, element interface{}) bool {
+		ranged[key] = element
+		return true
+	})
+	if len(ranged) != 3 {
+		t.Fatalf("Inconsistent range by hash: %v", ranged)
+	}
+	checkSentinelElements(t, "RangeByHash", ranged)
+
+	if _, ok := cm.LoadPointer("hot"); ok {
+		t.Fatalf("The counter of a hot key is loaded as a pointer")
+	}
+	if tp, ok := cm.ElementType("hot"); !ok || tp != reflect.TypeOf(int64(0)) {
+		t.Fatalf("Inconsistent element type of hot key: expected: %v, actual: %v", reflect.TypeOf(int64(0)), tp)
+	}
+}
@@ -0,0 +1,68 @@
+package cmap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+// LoadFromLines 会逐行读取 r，使用 parse 解析每一行并放入 map
+// 遇到第一个解析错误或放入错误时停止，返回已成功放入的行数和该错误
+// 若 parse 发生 panic 且被 WithCallbackRecovery 捕获，则返回 CallbackPanicError
+// 注意！单行长度不能超过 bufio.MaxScanTokenSize
+func (c *myConcurrentMap) LoadFromLines(r io.Reader,
+	parse func(line string) (key string, element interface{}, err error)) (int, error) {
+	var count int
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var key string
+		var element interface{}
+		var err error
+		if !c.opts.invokeCallback(func() {
+			key, element, err = parse(scanner.Text())
+		}) {
+			return count, newCallbackPanicError()
+		}
+		if err != nil {
+			return count, err
+		}
+		if _, err := c.Put(key, element); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, scanner.Err()
+}
+
+// ImportJSONLines 使用 json.Decoder 逐个读取 r 中的 JSON 值，因此不会把整个输入读入内存，
+// 单行长度也不受 bufio.MaxScanTokenSize 的限制；值之间的空白和空行都会被忽略
+// 遇到第一个 JSON 语法错误、解码错误或放入错误时停止，返回已成功放入的数量和该错误
+// 若 decode 发生 panic 且被 WithCallbackRecovery 捕获，则返回 CallbackPanicError
+func (c *myConcurrentMap) ImportJSONLines(r io.Reader,
+	decode func(raw json.RawMessage) (key string, element interface{}, err error)) (int, error) {
+	var count int
+	dec := json.NewDecoder(r)
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			return count, nil
+		} else if err != nil {
+			return count, err
+		}
+		var key string
+		var element interface{}
+		var err error
+		if !c.opts.invokeCallback(func() {
+			key, element, err = decode(raw)
+		}) {
+			return count, newCallbackPanicError()
+		}
+		if err != nil {
+			return count, err
+		}
+		if _, err := c.Put(key, element); err != nil {
+			return count, err
+		}
+		count++
+	}
+}
@@ -0,0 +1,116 @@
+package cmap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// parseKeyValue 用于将形如 key=value 的行解析为键值对
+func parseKeyValue(line string) (string, interface{}, error) {
+	parts := strings.SplitN(line, "=", 2)
+	if len(parts) != 2 {
+		return "", nil, errors.New("missing '=' in line: " + line)
+	}
+	return parts[0], parts[1], nil
+}
+
+func TestCmapLoadFromLines(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	input := "a=1\nb=2\nc=x=y\n"
+	count, err := cm.LoadFromLines(bufio.NewReader(strings.NewReader(input)), parseKeyValue)
+	if err != nil {
+		t.Fatalf("An error occurs when loading from lines: %s", err)
+	}
+	if count != 3 || cm.Len() != 3 {
+		t.Fatalf("Inconsistent count: expected: %d, actual: %d (len: %d)",
+			3, count, cm.Len())
+	}
+	expected := map[string]string{"a": "1", "b": "2", "c": "x=y"}
+	for key, element := range expected {
+		if actual := cm.Get(key); actual != element {
+			t.Fatalf("Inconsistent element: expected: %#v, actual: %#v (key: %s)",
+				element, actual, key)
+		}
+	}
+}
+
+func TestCmapLoadFromLinesError(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	input := "a=1\nb=2\nbroken\nd=4\n"
+	count, err := cm.LoadFromLines(bufio.NewReader(strings.NewReader(input)), parseKeyValue)
+	if err == nil {
+		t.Fatal("No error when loading a broken line, but should not be the case!")
+	}
+	if count != 2 {
+		t.Fatalf("Inconsistent count: expected: %d, actual: %d", 2, count)
+	}
+	if cm.Get("d") != nil {
+		t.Fatal("Loaded lines after the broken one!")
+	}
+	count, err = cm.LoadFromLines(strings.NewReader("e=5\nf=6"),
+		func(line string) (string, interface{}, error) {
+			return line, nil, nil
+		})
+	if _, ok := err.(IllegalParameterError); !ok {
+		t.Fatalf("Inconsistent error type: expected: %T, actual: %T", IllegalParameterError{}, err)
+	}
+	if count != 0 {
+		t.Fatalf("Inconsistent count: expected: %d, actual: %d", 0, count)
+	}
+}
+
+// decodeRecord 用于将形如 {"id": ..., "value": ...} 的 JSON 对象解码为键值对
+func decodeRecord(raw json.RawMessage) (string, interface{}, error) {
+	var record struct {
+		ID    string `json:"id"`
+		Value int    `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return "", nil, err
+	}
+	if record.ID == "" {
+		return "", nil, errors.New("missing id in record: " + string(raw))
+	}
+	return record.ID, record.Value, nil
+}
+
+func TestCmapImportJSONLines(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	input := `{"id": "a", "value": 1}
+{"id": "b", "value": 2}
+
+{"id": "c", "value": 3, "extra": [1, 2, 3]}
+`
+	count, err := cm.ImportJSONLines(strings.NewReader(input), decodeRecord)
+	if err != nil {
+		t.Fatalf("An error occurs when importing JSON lines: %s", err)
+	}
+	if count != 3 || cm.Len() != 3 {
+		t.Fatalf("Inconsistent count: expected: %d, actual: %d (len: %d)", 3, count, cm.Len())
+	}
+	for key, expected := range map[string]int{"a": 1, "b": 2, "c": 3} {
+		if element := cm.Get(key); element != expected {
+			t.Fatalf("Inconsistent element: expected: %v, actual: %v", expected, element)
+		}
+	}
+
+	cm, _ = NewConcurrentMap(4, nil)
+	count, err = cm.ImportJSONLines(strings.NewReader(`{"id": "a", "value": 1}
+{"value": 2}
+{"id": "c", "value": 3}
+`), decodeRecord)
+	if err == nil || count != 1 || cm.Len() != 1 {
+		t.Fatalf("Inconsistent result: expected: 1 and an error, actual: %d %v (len: %d)", count, err, cm.Len())
+	}
+
+	cm, _ = NewConcurrentMap(4, nil)
+	count, err = cm.ImportJSONLines(strings.NewReader(`{"id": "a", "value": 1}
+{"id": "b", "value":
+`), decodeRecord)
+	if err == nil || count != 1 {
+		t.Fatalf("Inconsistent result: expected: 1 and an error, actual: %d %v", count, err)
+	}
+}
@@ -0,0 +1,115 @@
+package cmap
+
+import "sync"
+
+// internedKey 代表驻留表中的一个键及引用它的键值对的数量
+type internedKey struct {
+	key  string
+	refs int
+}
+
+// keyInterner 代表键的驻留表
+// 驻留后相等的键共享同一份底层字节，每个引用驻留键的键值对都会使其引用计数加一，
+// 计数归零即没有键值对引用它时会从表中移除
+// 它有自己的互斥锁，所有方法都是并发安全的
+type keyInterner struct {
+	keys map[string]*internedKey
+	// peak 代表上次压缩以来 keys 中键的最大数量
+	// 从 map 中删除键不会释放其已分配的空间，占用的空间取决于曾经达到的最大数量
+	peak int
+	lock sync.Mutex
+}
+
+// sharedKeyInterner 是所有启用了 WithKeyInterning 的 map 共用的驻留表
+// 单个 map 中同一个键只会有一个键值对，只有跨 map 共用驻留表才能使相等的键真正共享底层字节
+var sharedKeyInterner = newKeyInterner()
+
+// intern 用于返回与 key 相等的驻留字符串并将其引用计数加一，若不存在则将 key 驻留
+func (ki *keyInterner) intern(key string) string {
+	ki.lock.Lock()
+	defer ki.lock.Unlock()
+	if interned, ok := ki.keys[key]; ok {
+		interned.refs++
+		return interned.key
+	}
+	ki.keys[key] = &internedKey{key: key, refs: 1}
+	if len(ki.keys) > ki.peak {
+		ki.peak = len(ki.keys)
+	}
+	return key
+}
+
+// release 用于将键的引用计数减一，计数归零时将其移出驻留表
+func (ki *keyInterner) release(key string) {
+	ki.lock.Lock()
+	defer ki.lock.Unlock()
+	interned, ok := ki.keys[key]
+	if !ok {
+		return
+	}
+	if interned.refs--; interned.refs <= 0 {
+		delete(ki.keys, key)
+	}
+}
+
+// refs 用于返回键的引用计数，键未被驻留时返回 0
+func (ki *keyInterner) refs(key string) int {
+	ki.lock.Lock()
+	defer ki.lock.Unlock()
+	if interned, ok := ki.keys[key]; ok {
+		return interned.refs
+	}
+	return 0
+}
+
+// lookup 用于返回与 key 相等的驻留字符串，不会改变引用计数
+func (ki *keyInterner) lookup(key string) (string, bool) {
+	ki.lock.Lock()
+	defer ki.lock.Unlock()
+	if interned, ok := ki.keys[key]; ok {
+		return interned.key, true
+	}
+	return "", false
+}
+
+// compact 用于移除没有被引用的键，并在键的数量低于最大数量时重建驻留表以释放多余的空间
+// 返回移除的键的数量
+func (ki *keyInterner) compact() int {
+	ki.lock.Lock()
+	defer ki.lock.Unlock()
+	var pruned int
+	for key, interned := range ki.keys {
+		if interned.refs <= 0 {
+			delete(ki.keys, key)
+			pruned++
+		}
+	}
+	if len(ki.keys) < ki.peak {
+		keys := make(map[string]*internedKey, len(ki.keys))
+		for key, interned := range ki.keys {
+			keys[key] = interned
+		}
+		ki.keys = keys
+	}
+	ki.peak = len(ki.keys)
+	return pruned
+}
+
+// size 用于返回驻留表中的键的数量及上次压缩以来的最大数量
+func (ki *keyInterner) size() (keys int, peak int) {
+	ki.lock.Lock()
+	defer ki.lock.Unlock()
+	return len(ki.keys), ki.peak
+}
+
+func newKeyInterner() *keyInterner {
+	return &keyInterner{keys: make(map[string]*internedKey)}
+}
+
+// RunGC 压缩的是所有启用了 WithKeyInterning 的 map 共用的驻留表，期间这些 map 放入新键和删除键都会被阻塞
+// 键值对不会被池化复用，因此没有需要归还的键值对
+func (c *myConcurrentMap) RunGC() {
+	if c.opts.keyInterner != nil {
+		c.opts.keyInterner.compact()
+	}
+}
@@ -0,0 +1,143 @@
+package cmap
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+// stringData 用于返回字符串底层字节的地址
+func stringData(s string) uintptr {
+	return (*reflect.StringHeader)(unsafe.Pointer(&s)).Data
+}
+
+// storedKey 用于返回 map 中实际存放的与 key 相等的键
+func storedKey(cm ConcurrentMap, key string) string {
+	return cm.(*myConcurrentMap).findSegment(hash(key)).Get(key).Key()
+}
+
+func TestCmapKeyInterning(t *testing.T) {
+	cm1, _ := NewConcurrentMap(4, nil, WithKeyInterning(true))
+	cm2, _ := NewConcurrentMap(2, nil, WithKeyInterning(true))
+	interner := cm1.(*myConcurrentMap).opts.keyInterner
+	// 每次都构造一个新的字符串，使其底层字节不同
+	newKey := func() string {
+		return strings.Repeat("long/path/prefix/", 4) + "key"
+	}
+	first, second := newKey(), newKey()
+	if stringData(first) == stringData(second) {
+		t.Fatal("The keys for testing share memory!")
+	}
+	cm1.Put(first, 1)
+	cm2.Put(second, 1)
+	// 两次放入的是不同的字符串，存放的却是同一份底层字节
+	if stringData(storedKey(cm2, newKey())) != stringData(first) ||
+		stringData(storedKey(cm1, newKey())) != stringData(first) {
+		t.Fatal("The keys put into different maps don't share memory!")
+	}
+	// 反复放入已存在的键不会增加引用计数
+	for i := 0; i < 100; i++ {
+		cm1.Put(newKey(), i)
+		cm2.Put(newKey(), i)
+	}
+	if refs := interner.refs(first); refs != 2 {
+		t.Fatalf("Inconsistent reference count: expected: %d, actual: %d", 2, refs)
+	}
+	// 调整并发量和整体替换后引用计数保持不变
+	if err := cm1.Resize(8); err != nil {
+		t.Fatalf("An error occurs when resizing the map: %s", err)
+	}
+	if err := cm2.ReplaceAll(map[string]interface{}{newKey(): 2, "other-interned": 1}); err != nil {
+		t.Fatalf("An error occurs when replacing the map: %s", err)
+	}
+	if refs := interner.refs(first); refs != 2 {
+		t.Fatalf("Inconsistent reference count: expected: %d, actual: %d", 2, refs)
+	}
+	if stringData(storedKey(cm2, newKey())) != stringData(first) {
+		t.Fatal("The replaced key doesn't share memory with the intern table!")
+	}
+	// 只有最后一个键值对被删除后才会移出驻留表
+	cm1.Delete(newKey())
+	if refs := interner.refs(first); refs != 1 {
+		t.Fatalf("Inconsistent reference count: expected: %d, actual: %d", 1, refs)
+	}
+	cm1.Put(newKey(), 3)
+	if stringData(storedKey(cm1, newKey())) != stringData(first) {
+		t.Fatal("The key put again doesn't share memory with the other map!")
+	}
+	cm1.Delete(newKey())
+	cm2.Delete(newKey())
+	if _, ok := interner.lookup(first); ok {
+		t.Fatal("The deleted key is still in the intern table!")
+	}
+	for i := 0; i < 100; i++ {
+		cm1.Put(newKey(), i)
+		cm1.Delete(newKey())
+	}
+	if refs := interner.refs(first); refs != 0 {
+		t.Fatalf("Inconsistent reference count: expected: %d, actual: %d", 0, refs)
+	}
+	cm2.Delete("other-interned")
+	if refs := interner.refs("other-interned"); refs != 0 {
+		t.Fatalf("Inconsistent reference count: expected: %d, actual: %d", 0, refs)
+	}
+}
+
+func TestCmapRunGC(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil, WithKeyInterning(true))
+	interner := cm.(*myConcurrentMap).opts.keyInterner
+	baseKeys, _ := interner.size()
+	number, live := 10000, 10
+	for round := 0; round < 3; round++ {
+		for i := 0; i < number; i++ {
+			cm.Put(fmt.Sprintf("churn-%d-%d", round, i), i)
+		}
+		for i := live; i < number; i++ {
+			cm.Delete(fmt.Sprintf("churn-%d-%d", round, i))
+		}
+	}
+	keys, peak := interner.size()
+	if keys != baseKeys+3*live {
+		t.Fatalf("Inconsistent interned key count: expected: %d, actual: %d", baseKeys+3*live, keys)
+	}
+	if peak < baseKeys+number {
+		t.Fatalf("Inconsistent peak of interned keys: expected: >= %d, actual: %d", baseKeys+number, peak)
+	}
+	// 没有被引用的键会被移除
+	interner.lock.Lock()
+	interner.keys["orphan"] = &internedKey{key: "orphan"}
+	interner.lock.Unlock()
+
+	cm.RunGC()
+	keys, peak = interner.size()
+	if keys != baseKeys+3*live || peak != keys {
+		t.Fatalf("Inconsistent interned keys after GC: expected: %d/%d, actual: %d/%d",
+			baseKeys+3*live, baseKeys+3*live, keys, peak)
+	}
+	if _, ok := interner.lookup("orphan"); ok {
+		t.Fatal("The orphan key is still in the intern table after GC!")
+	}
+	// 仍然存在的键保持驻留
+	for round := 0; round < 3; round++ {
+		for i := 0; i < live; i++ {
+			key := fmt.Sprintf("churn-%d-%d", round, i)
+			interned, ok := interner.lookup(key)
+			if !ok || interner.refs(key) != 1 {
+				t.Fatalf("Inconsistent reference count of %s: expected: %d, actual: %d", key, 1, interner.refs(key))
+			}
+			if stringData(storedKey(cm, key)) != stringData(interned) {
+				t.Fatalf("The stored key %s doesn't share memory with the intern table after GC!", key)
+			}
+			cm.Delete(key)
+		}
+	}
+	if keys, _ := interner.size(); keys != baseKeys {
+		t.Fatalf("Inconsistent interned key count: expected: %d, actual: %d", baseKeys, keys)
+	}
+
+	// 未启用时什么也不做
+	cm, _ = NewConcurrentMap(1, nil)
+	cm.RunGC()
+}
@@ -0,0 +1,83 @@
+package cmap
+
+import (
+	"runtime"
+	"sync"
+)
+
+// segmentKeys 会不加锁地遍历散列段，返回其中所有的键
+func segmentKeys(s Segment) []string {
+	keys := make([]string, 0, s.Size())
+	s.Range(func(p Pair) bool {
+		keys = append(keys, p.Key())
+		return true
+	})
+	return keys
+}
+
+func (c *myConcurrentMap) Keys() []string {
+	keys := make([]string, 0, c.Len())
+	for _, s := range c.getSegments() {
+		keys = append(keys, segmentKeys(s)...)
+	}
+	return keys
+}
+
+// KeysParallel 中每个 goroutine 依次领取散列段，将其键收集到该散列段自己的切片中，
+// 最后按散列段的顺序拼接，因此不需要在 goroutine 之间同步结果
+func (c *myConcurrentMap) KeysParallel() []string {
+	segments := c.getSegments()
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(segments) {
+		workers = len(segments)
+	}
+	if workers <= 1 {
+		return c.Keys()
+	}
+	perSegment := make([][]string, len(segments))
+	indexes := make(chan int, len(segments))
+	for i := range segments {
+		indexes <- i
+	}
+	close(indexes)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				perSegment[i] = segmentKeys(segments[i])
+			}
+		}()
+	}
+	wg.Wait()
+	var total int
+	for _, keys := range perSegment {
+		total += len(keys)
+	}
+	keys := make([]string, 0, total)
+	for _, segmentKeys := range perSegment {
+		keys = append(keys, segmentKeys...)
+	}
+	return keys
+}
+
+// Difference 不加锁地遍历当前 map，对每个键调用 other.Contains，
+// 两个 map 在此期间的修改可能使结果包含或遗漏遍历时被修改的键
+func (c *myConcurrentMap) Difference(other ConcurrentMap) []string {
+	var keys []string
+	for _, s := range c.getSegments() {
+		s.Range(func(p Pair) bool {
+			if !other.Contains(p.Key()) {
+				keys = append(keys, p.Key())
+			}
+			return true
+		})
+	}
+	return keys
+}
+
+// SymmetricDifference 依次计算两个方向的 Difference 并拼接，先是当前 map 独有的键
+func (c *myConcurrentMap) SymmetricDifference(other ConcurrentMap) []string {
+	return append(c.Difference(other), other.Difference(c)...)
+}
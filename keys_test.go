@@ -0,0 +1,78 @@
+package cmap
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"testing"
+)
+
+func TestCmapKeys(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	cm, _ := NewConcurrentMap(16, nil)
+	var expected []string
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		cm.Put(key, i)
+		expected = append(expected, key)
+	}
+	sort.Strings(expected)
+	for name, keys := range map[string][]string{
+		"Keys":         cm.Keys(),
+		"KeysParallel": cm.KeysParallel(),
+	} {
+		sort.Strings(keys)
+		if len(keys) != len(expected) {
+			t.Fatalf("Inconsistent key count of %s: expected: %d, actual: %d", name, len(expected), len(keys))
+		}
+		for i := range keys {
+			if keys[i] != expected[i] {
+				t.Fatalf("Inconsistent key of %s: expected: %s, actual: %s", name, expected[i], keys[i])
+			}
+		}
+	}
+	cm, _ = NewConcurrentMap(4, nil)
+	if keys := cm.KeysParallel(); len(keys) != 0 {
+		t.Fatalf("Inconsistent key count: expected: %d, actual: %d", 0, len(keys))
+	}
+}
+
+// assertKeySet 用于断言 keys 与 expected 中的键相同且不重复
+func assertKeySet(t *testing.T, name string, keys []string, expected ...string) {
+	sort.Strings(keys)
+	sort.Strings(expected)
+	if len(keys) != len(expected) {
+		t.Fatalf("Inconsistent key count of %s: expected: %v, actual: %v", name, expected, keys)
+	}
+	for i := range keys {
+		if keys[i] != expected[i] {
+			t.Fatalf("Inconsistent keys of %s: expected: %v, actual: %v", name, expected, keys)
+		}
+	}
+}
+
+func TestCmapDifference(t *testing.T) {
+	a, _ := NewConcurrentMap(4, nil)
+	b, _ := NewConcurrentMap(2, nil)
+	for _, key := range []string{"both-1", "both-2", "only-a-1", "only-a-2"} {
+		a.Put(key, 1)
+	}
+	for _, key := range []string{"both-1", "both-2", "only-b"} {
+		b.Put(key, 2)
+	}
+	assertKeySet(t, "a - b", a.Difference(b), "only-a-1", "only-a-2")
+	assertKeySet(t, "b - a", b.Difference(a), "only-b")
+	assertKeySet(t, "a ^ b", a.SymmetricDifference(b), "only-a-1", "only-a-2", "only-b")
+	assertKeySet(t, "a - a", a.Difference(a))
+	if keys := a.SymmetricDifference(b); len(keys) != 3 || keys[2] != "only-b" {
+		t.Fatalf("Inconsistent order of symmetric difference: %v", keys)
+	}
+
+	// 不相交的键集
+	empty, _ := NewConcurrentMap(1, nil)
+	c, _ := NewConcurrentMap(1, nil)
+	c.Put("other", 3)
+	assertKeySet(t, "a - empty", a.Difference(empty), a.Keys()...)
+	assertKeySet(t, "empty - a", empty.Difference(a))
+	assertKeySet(t, "b ^ c", b.SymmetricDifference(c), "both-1", "both-2", "only-b", "other")
+}
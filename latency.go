@@ -0,0 +1,129 @@
+package cmap
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// LatencyStats 代表一种操作的耗时统计
+// 分位数是近似值：耗时按 2 的幂分组，分位数取所在分组的上界（不超过 Max）
+type LatencyStats struct {
+	Count uint64
+	Min   time.Duration
+	Max   time.Duration
+	Mean  time.Duration
+	P50   time.Duration
+	P99   time.Duration
+}
+
+// 用于表示被统计耗时的操作
+const (
+	opPut    = "put"
+	opGet    = "get"
+	opDelete = "delete"
+)
+
+// latencyHistogram 代表以 2 的幂为分组的耗时直方图
+// 第 i 个分组统计耗时在 [2^(i-1), 2^i) 纳秒内的操作，所有字段都以原子操作访问
+type latencyHistogram struct {
+	buckets [64]uint64
+	count   uint64
+	sum     uint64
+	min     uint64
+	max     uint64
+}
+
+// record 用于记录一次操作的耗时
+func (h *latencyHistogram) record(d time.Duration) {
+	ns := uint64(d)
+	if d < 0 {
+		ns = 0
+	}
+	atomic.AddUint64(&h.buckets[bits.Len64(ns)%64], 1)
+	atomic.AddUint64(&h.sum, ns)
+	// min 以加一后的值存放，0 表示尚无记录
+	for {
+		old := atomic.LoadUint64(&h.min)
+		if (old != 0 && old-1 <= ns) || atomic.CompareAndSwapUint64(&h.min, old, ns+1) {
+			break
+		}
+	}
+	for {
+		old := atomic.LoadUint64(&h.max)
+		if old >= ns || atomic.CompareAndSwapUint64(&h.max, old, ns) {
+			break
+		}
+	}
+	atomic.AddUint64(&h.count, 1)
+}
+
+// stats 用于计算统计结果
+// 各字段是分别读取的，并发记录时结果可能略有出入
+func (h *latencyHistogram) stats() LatencyStats {
+	var counts [64]uint64
+	var total uint64
+	for i := range h.buckets {
+		counts[i] = atomic.LoadUint64(&h.buckets[i])
+		total += counts[i]
+	}
+	stats := LatencyStats{Count: total}
+	if total == 0 {
+		return stats
+	}
+	stats.Max = time.Duration(atomic.LoadUint64(&h.max))
+	if min := atomic.LoadUint64(&h.min); min > 0 {
+		stats.Min = time.Duration(min - 1)
+	}
+	stats.Mean = time.Duration(atomic.LoadUint64(&h.sum) / total)
+	percentile := func(p uint64) time.Duration {
+		// 需要覆盖的操作数量，向上取整
+		target := (total*p + 99) / 100
+		var seen uint64
+		for i, n := range counts {
+			if seen += n; seen >= target {
+				upper := time.Duration(uint64(1)<<uint(i) - 1)
+				if i == 63 || upper > stats.Max {
+					return stats.Max
+				}
+				return upper
+			}
+		}
+		return stats.Max
+	}
+	stats.P50 = percentile(50)
+	stats.P99 = percentile(99)
+	return stats
+}
+
+// latencyTracker 代表各种操作的耗时统计
+type latencyTracker struct {
+	histograms map[string]*latencyHistogram
+}
+
+// record 用于记录自 start 以来某种操作的耗时
+func (lt *latencyTracker) record(op string, start time.Time) {
+	lt.histograms[op].record(time.Since(start))
+}
+
+func newLatencyTracker() *latencyTracker {
+	return &latencyTracker{
+		histograms: map[string]*latencyHistogram{
+			opPut:    {},
+			opGet:    {},
+			opDelete: {},
+		},
+	}
+}
+
+// OperationLatencies 返回的键是操作名称，即 "put"、"get" 和 "delete"
+func (c *myConcurrentMap) OperationLatencies() map[string]LatencyStats {
+	if c.opts.latencyTracker == nil {
+		return nil
+	}
+	latencies := make(map[string]LatencyStats, len(c.opts.latencyTracker.histograms))
+	for op, h := range c.opts.latencyTracker.histograms {
+		latencies[op] = h.stats()
+	}
+	return latencies
+}
@@ -0,0 +1,63 @@
+package cmap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCmapOperationLatencies(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	if latencies := cm.OperationLatencies(); latencies != nil {
+		t.Fatalf("Inconsistent latencies: expected: %v, actual: %v", nil, latencies)
+	}
+	number := 1000
+	testCases := genNoRepetitiveTestingPairs(number)
+	cm, _ = NewConcurrentMap(4, nil, WithLatencyTracking(true))
+	for _, p := range testCases {
+		cm.Put(p.Key(), p.Element())
+		cm.Get(p.Key())
+		cm.Get(p.Key())
+	}
+	for _, p := range testCases[:number/2] {
+		cm.Delete(p.Key())
+	}
+	latencies := cm.OperationLatencies()
+	expectedCounts := map[string]uint64{"put": uint64(number), "get": uint64(number * 2), "delete": uint64(number / 2)}
+	for op, count := range expectedCounts {
+		stats, ok := latencies[op]
+		if !ok {
+			t.Fatalf("Not found latencies of operation %s!", op)
+		}
+		if stats.Count != count {
+			t.Fatalf("Inconsistent count of %s: expected: %d, actual: %d", op, count, stats.Count)
+		}
+		if stats.Max <= 0 || stats.Mean <= 0 || stats.P99 <= 0 {
+			t.Fatalf("Implausible latencies of %s: %+v", op, stats)
+		}
+		if stats.Min > stats.P50 || stats.P50 > stats.P99 || stats.P99 > stats.Max ||
+			stats.Mean < stats.Min || stats.Mean > stats.Max {
+			t.Fatalf("Inconsistent latencies of %s: %+v", op, stats)
+		}
+	}
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	h := &latencyHistogram{}
+	for i := 0; i < 98; i++ {
+		h.record(100 * time.Nanosecond)
+	}
+	h.record(10 * time.Microsecond)
+	h.record(time.Millisecond)
+	stats := h.stats()
+	if stats.Count != 100 || stats.Min != 100*time.Nanosecond || stats.Max != time.Millisecond {
+		t.Fatalf("Inconsistent stats: %+v", stats)
+	}
+	// 100ns 位于 [64ns, 128ns) 分组
+	if stats.P50 != 127*time.Nanosecond {
+		t.Fatalf("Inconsistent p50: expected: %v, actual: %v", 127*time.Nanosecond, stats.P50)
+	}
+	// 10µs 位于 [8192ns, 16384ns) 分组
+	if stats.P99 != 16383*time.Nanosecond {
+		t.Fatalf("Inconsistent p99: expected: %v, actual: %v", 16383*time.Nanosecond, stats.P99)
+	}
+}
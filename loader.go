@@ -0,0 +1,58 @@
+package cmap
+
+// loadCall 代表一次正在进行中的 GetWithLoader 加载
+type loadCall struct {
+	// 在加载结束后关闭
+	done    chan struct{}
+	element interface{}
+	err     error
+}
+
+// GetWithLoader 会先无锁地读取键，未命中时才登记加载
+// 同一时刻每个键最多只有一个加载在进行，其他调用者会等待并共享其结果
+// 若 loader 发生 panic，等待者会得到 CallbackPanicError
+func (c *myConcurrentMap) GetWithLoader(key string,
+	loader func(key string) (interface{}, error)) (interface{}, error) {
+	key = c.normalizeKey(key)
+	if element, _, _ := c.getLocal(key); element != nil {
+		return element, nil
+	}
+	c.loadLock.Lock()
+	if call, ok := c.loads[key]; ok {
+		c.loadLock.Unlock()
+		<-call.done
+		return call.element, call.err
+	}
+	// 上一次加载可能刚刚结束，因此需要重新检查
+	if element, _, _ := c.getLocal(key); element != nil {
+		c.loadLock.Unlock()
+		return element, nil
+	}
+	call := &loadCall{
+		done: make(chan struct{}),
+		err:  newCallbackPanicError(),
+	}
+	c.loads[key] = call
+	c.loadLock.Unlock()
+	defer func() {
+		c.loadLock.Lock()
+		delete(c.loads, key)
+		c.loadLock.Unlock()
+		close(call.done)
+	}()
+
+	if !c.opts.invokeCallback(func() {
+		call.element, call.err = loader(key)
+	}) {
+		call.element = nil
+		return nil, call.err
+	}
+	if call.err != nil {
+		call.element = nil
+		return nil, call.err
+	}
+	if _, err := c.Put(key, call.element); err != nil {
+		call.element, call.err = nil, err
+	}
+	return call.element, call.err
+}
@@ -0,0 +1,78 @@
+package cmap
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCmapGetWithLoader(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	var calls int32
+	loader := func(key string) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		// 让并发的调用者有机会等待同一次加载
+		time.Sleep(20 * time.Millisecond)
+		return key + "-loaded", nil
+	}
+	number := 50
+	var wg sync.WaitGroup
+	wg.Add(number)
+	for i := 0; i < number; i++ {
+		go func() {
+			defer wg.Done()
+			element, err := cm.GetWithLoader("key", loader)
+			if err != nil {
+				t.Errorf("An error occurs when loading: %s", err)
+				return
+			}
+			if element != "key-loaded" {
+				t.Errorf("Inconsistent element: expected: %#v, actual: %#v", "key-loaded", element)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Fatalf("Inconsistent loader calls: expected: %d, actual: %d", 1, calls)
+	}
+	if actual := cm.Get("key"); actual != "key-loaded" {
+		t.Fatalf("Inconsistent element: expected: %#v, actual: %#v", "key-loaded", actual)
+	}
+	// 命中时不应再调用 loader
+	cm.GetWithLoader("key", loader)
+	if calls != 1 {
+		t.Fatalf("Inconsistent loader calls: expected: %d, actual: %d", 1, calls)
+	}
+}
+
+func TestCmapGetWithLoaderError(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	loadErr := errors.New("load failed")
+	var calls int
+	loader := func(key string) (interface{}, error) {
+		calls++
+		if calls == 1 {
+			return nil, loadErr
+		}
+		return "element", nil
+	}
+	if _, err := cm.GetWithLoader("key", loader); err != loadErr {
+		t.Fatalf("Inconsistent error: expected: %v, actual: %v", loadErr, err)
+	}
+	if cm.Len() != 0 {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d", 0, cm.Len())
+	}
+	element, err := cm.GetWithLoader("key", loader)
+	if err != nil || element != "element" || calls != 2 {
+		t.Fatalf("The loader error is cached! (element: %#v, error: %v, calls: %d)",
+			element, err, calls)
+	}
+	// loader 返回 nil 元素时放入失败，也不会缓存
+	if _, err := cm.GetWithLoader("nil", func(key string) (interface{}, error) {
+		return nil, nil
+	}); err == nil {
+		t.Fatal("No error when loading a nil element, but should not be the case!")
+	}
+}
@@ -0,0 +1,47 @@
+package cmap
+
+// EntryMeta 代表一次读取时键值对所在位置的元数据
+type EntryMeta struct {
+	// Hash 代表键的散列值
+	Hash uint64
+	// SegmentIndex 代表键所在散列段的索引
+	SegmentIndex int
+	// BucketIndex 代表键所在散列桶的索引，等于 Hash 对 BucketNumber 取模
+	BucketIndex int
+	// BucketNumber 代表读取时散列段中散列桶的数量
+	BucketNumber int
+	// Depth 代表键值对在散列桶链表中的位置，表头为 0
+	Depth int
+	// AccessCount 代表键值对被访问的次数，只有启用了访问计数时才会统计
+	AccessCount uint64
+}
+
+// LoadWithMeta 与 Get 一样会统计访问次数和记录使用时间，
+// 它在确定散列桶之后自己遍历链表，因此可以得到键值对在链表中的位置
+func (c *myConcurrentMap) LoadWithMeta(key string) (interface{}, EntryMeta, bool) {
+	key = c.normalizeKey(key)
+	keyHash := c.opts.hash(key)
+	segments := c.getSegments()
+	meta := EntryMeta{Hash: keyHash, SegmentIndex: segmentIndex(keyHash, len(segments))}
+	b, index, bucketNumber := segments[meta.SegmentIndex].LocateBucketWithHash(keyHash)
+	meta.BucketIndex, meta.BucketNumber = index, bucketNumber
+	for v, n := b.GetFirstPair(), 0; v != nil && n < MAX_CHAIN_LENGTH; v, n = v.Next(), n+1 {
+		if v.Key() != key {
+			continue
+		}
+		meta.Depth = n
+		if c.opts.accessCounting {
+			v.IncrAccessCount()
+			meta.AccessCount = v.AccessCount()
+		}
+		if c.opts.softValues {
+			v.Touch()
+		}
+		element, err := c.decodeElement(v.Element())
+		if err != nil {
+			return nil, meta, false
+		}
+		return element, meta, true
+	}
+	return nil, meta, false
+}
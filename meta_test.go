@@ -0,0 +1,54 @@
+package cmap
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCmapLoadWithMeta(t *testing.T) {
+	cm, _ := NewConcurrentMap(1, nil, WithAccessCounting(true))
+	number := 500
+	for i := 0; i < number; i++ {
+		cm.Put(fmt.Sprintf("key-%d", i), i)
+	}
+	s := cm.(*myConcurrentMap).getSegments()[0].(*segment)
+	for i := 0; i < number; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		element, meta, ok := cm.LoadWithMeta(key)
+		if !ok || element != i {
+			t.Fatalf("Inconsistent element: expected: %v, actual: %v (ok: %v)", i, element, ok)
+		}
+		if meta.Hash != hash(key) || meta.SegmentIndex != 0 {
+			t.Fatalf("Inconsistent hash or segment: expected: %d %d, actual: %d %d",
+				hash(key), 0, meta.Hash, meta.SegmentIndex)
+		}
+		if meta.BucketNumber != s.bucketsLen || meta.BucketIndex != int(meta.Hash%uint64(s.bucketsLen)) {
+			t.Fatalf("Inconsistent bucket index: expected: %d, actual: %d",
+				meta.Hash%uint64(s.bucketsLen), meta.BucketIndex)
+		}
+		depth := 0
+		for v := s.buckets[meta.BucketIndex].GetFirstPair(); v.Key() != key; v = v.Next() {
+			depth++
+		}
+		if meta.Depth != depth {
+			t.Fatalf("Inconsistent depth: expected: %d, actual: %d", depth, meta.Depth)
+		}
+		if meta.AccessCount != 1 {
+			t.Fatalf("Inconsistent access count: expected: %d, actual: %d", 1, meta.AccessCount)
+		}
+	}
+	if _, meta, ok := cm.LoadWithMeta("missing"); ok || meta.Hash != hash("missing") {
+		t.Fatalf("Inconsistent result for a missing key: %+v %v", meta, ok)
+	}
+
+	// 所有键的散列值都相同时，后放入的键位于链表的前部
+	collide, _ := NewConcurrentMap(1, nil, WithHash(func(key string) uint64 { return 7 }))
+	for i := 0; i < 5; i++ {
+		collide.Put(fmt.Sprintf("key-%d", i), i)
+	}
+	for i := 0; i < 5; i++ {
+		if _, meta, _ := collide.LoadWithMeta(fmt.Sprintf("key-%d", i)); meta.Depth != 4-i {
+			t.Fatalf("Inconsistent depth: expected: %d, actual: %d", 4-i, meta.Depth)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package cmap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+)
+
+// metricNamePattern 代表合法的 Prometheus 指标名称
+var metricNamePattern = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// metricsWriter 用于以 Prometheus 文本格式逐个写入指标
+// 写入出错后不再写入，错误由 flush 返回
+type metricsWriter struct {
+	w      *bufio.Writer
+	prefix string
+	err    error
+}
+
+// family 用于写入一个指标的 HELP 和 TYPE 注释
+func (mw *metricsWriter) family(name, kind, help string) {
+	if mw.err == nil {
+		_, mw.err = fmt.Fprintf(mw.w, "# HELP %s_%s %s\n# TYPE %s_%s %s\n",
+			mw.prefix, name, help, mw.prefix, name, kind)
+	}
+}
+
+// sample 用于写入一个不带标签的样本
+func (mw *metricsWriter) sample(name string, value float64) {
+	if mw.err == nil {
+		_, mw.err = fmt.Fprintf(mw.w, "%s_%s %s\n",
+			mw.prefix, name, strconv.FormatFloat(value, 'g', -1, 64))
+	}
+}
+
+// segmentSample 用于写入一个以散列段索引为标签的样本
+func (mw *metricsWriter) segmentSample(name string, index int, value float64) {
+	if mw.err == nil {
+		_, mw.err = fmt.Fprintf(mw.w, "%s_%s{segment=\"%d\"} %s\n",
+			mw.prefix, name, index, strconv.FormatFloat(value, 'g', -1, 64))
+	}
+}
+
+func (mw *metricsWriter) flush() error {
+	if mw.err != nil {
+		return mw.err
+	}
+	return mw.w.Flush()
+}
+
+// WriteMetrics 只读取各个计数，不加全局锁，因此不同指标不是同一时刻的值
+// 指标名称都以前缀加下划线开头，未启用的统计不会输出对应的指标
+func (c *myConcurrentMap) WriteMetrics(w io.Writer) error {
+	if !metricNamePattern.MatchString(c.opts.metricsPrefix) {
+		return newIllegalParameterError(
+			fmt.Sprintf("metrics prefix %q is not a valid metric name", c.opts.metricsPrefix))
+	}
+	mw := &metricsWriter{w: bufio.NewWriter(w), prefix: c.opts.metricsPrefix}
+	segments := c.getSegments()
+
+	mw.family("entries", "gauge", "Number of pairs in the map.")
+	mw.sample("entries", float64(c.Len()))
+	mw.family("segments", "gauge", "Number of segments in the map.")
+	mw.sample("segments", float64(len(segments)))
+	mw.family("segment_entries", "gauge", "Number of pairs in each segment.")
+	for i, s := range segments {
+		mw.segmentSample("segment_entries", i, float64(s.Size()))
+	}
+	mw.family("segment_buckets", "gauge", "Number of buckets in each segment.")
+	for i, s := range segments {
+		mw.segmentSample("segment_buckets", i, float64(s.BucketNumber()))
+	}
+
+	if lc := c.opts.lookupCounter; lc != nil {
+		mw.family("lookup_hits_total", "counter", "Number of Get calls that found the key.")
+		mw.sample("lookup_hits_total", float64(atomic.LoadUint64(&lc.hits)))
+		mw.family("lookup_misses_total", "counter", "Number of Get calls that missed the key.")
+		mw.sample("lookup_misses_total", float64(atomic.LoadUint64(&lc.misses)))
+	}
+	if c.opts.redistributionCounter != nil {
+		stats := c.RedistributionStats()
+		mw.family("redistributions_total", "counter", "Number of redistributions that changed the bucket number.")
+		mw.sample("redistributions_total", float64(stats.Count))
+		mw.family("redistributed_pairs_total", "counter", "Number of pairs moved by redistributions.")
+		mw.sample("redistributed_pairs_total", float64(stats.PairsMoved))
+		mw.family("redistribution_seconds_total", "counter", "Time spent on redistributions under segment locks.")
+		mw.sample("redistribution_seconds_total", stats.Duration.Seconds())
+	}
+	return mw.flush()
+}
@@ -0,0 +1,124 @@
+package cmap
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var (
+	metricCommentPattern = regexp.MustCompile(`^# (HELP|TYPE) ([a-zA-Z_:][a-zA-Z0-9_:]*) (.+)$`)
+	metricSamplePattern  = regexp.MustCompile(
+		`^([a-zA-Z_:][a-zA-Z0-9_:]*)(\{[a-zA-Z_][a-zA-Z0-9_]*="[^"]*"(,[a-zA-Z_][a-zA-Z0-9_]*="[^"]*")*\})? (\S+)$`)
+)
+
+// parseMetrics 用于按 Prometheus 文本格式解析 WriteMetrics 的输出
+// 返回以带标签的名称为键的样本值，格式不合法时使测试失败
+func parseMetrics(t *testing.T, text string) map[string]float64 {
+	samples := make(map[string]float64)
+	types := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		if strings.HasPrefix(line, "#") {
+			m := metricCommentPattern.FindStringSubmatch(line)
+			if m == nil {
+				t.Fatalf("Invalid comment line: %q", line)
+			}
+			if m[1] == "TYPE" {
+				switch m[3] {
+				case "counter", "gauge":
+				default:
+					t.Fatalf("Invalid metric type: %q", line)
+				}
+				if _, ok := types[m[2]]; ok {
+					t.Fatalf("Duplicate TYPE line: %q", line)
+				}
+				types[m[2]] = m[3]
+			}
+			continue
+		}
+		m := metricSamplePattern.FindStringSubmatch(line)
+		if m == nil {
+			t.Fatalf("Invalid sample line: %q", line)
+		}
+		if _, ok := types[m[1]]; !ok {
+			t.Fatalf("Sample without TYPE line: %q", line)
+		}
+		value, err := strconv.ParseFloat(m[4], 64)
+		if err != nil {
+			t.Fatalf("Invalid sample value: %q", line)
+		}
+		name := m[1] + m[2]
+		if _, ok := samples[name]; ok {
+			t.Fatalf("Duplicate sample: %q", line)
+		}
+		samples[name] = value
+	}
+	return samples
+}
+
+func TestCmapWriteMetrics(t *testing.T) {
+	cm, _ := NewConcurrentMap(2, nil, WithStats(true), WithLookupStats(true))
+	number := 5000
+	for i := 0; i < number; i++ {
+		cm.Put(fmt.Sprintf("key-%d", i), i)
+	}
+	cm.Get("key-1")
+	cm.Get("key-2")
+	cm.Get("missing")
+	var buf bytes.Buffer
+	if err := cm.WriteMetrics(&buf); err != nil {
+		t.Fatalf("An error occurs when writing metrics: %s", err)
+	}
+	samples := parseMetrics(t, buf.String())
+	expected := map[string]float64{
+		"cmap_entries":             float64(number),
+		"cmap_segments":            2,
+		"cmap_lookup_hits_total":   2,
+		"cmap_lookup_misses_total": 1,
+	}
+	for name, value := range expected {
+		if actual, ok := samples[name]; !ok || actual != value {
+			t.Fatalf("Inconsistent metric %s: expected: %v, actual: %v (found: %v)", name, value, actual, ok)
+		}
+	}
+	var entries float64
+	segments := cm.(*myConcurrentMap).getSegments()
+	for i, s := range segments {
+		name := fmt.Sprintf(`cmap_segment_entries{segment="%d"}`, i)
+		if samples[name] != float64(s.Size()) {
+			t.Fatalf("Inconsistent metric %s: expected: %v, actual: %v", name, s.Size(), samples[name])
+		}
+		entries += samples[name]
+		name = fmt.Sprintf(`cmap_segment_buckets{segment="%d"}`, i)
+		if samples[name] != float64(s.BucketNumber()) {
+			t.Fatalf("Inconsistent metric %s: expected: %v, actual: %v", name, s.BucketNumber(), samples[name])
+		}
+	}
+	if entries != float64(number) {
+		t.Fatalf("Inconsistent sum of segment entries: expected: %d, actual: %v", number, entries)
+	}
+	if samples["cmap_redistributions_total"] == 0 || samples["cmap_redistributed_pairs_total"] == 0 {
+		t.Fatalf("No redistribution in metrics: %s", buf.String())
+	}
+
+	// 未启用的统计不输出，前缀可以配置
+	cm, _ = NewConcurrentMap(1, nil, WithMetricsPrefix("app_cache"))
+	buf.Reset()
+	if err := cm.WriteMetrics(&buf); err != nil {
+		t.Fatalf("An error occurs when writing metrics: %s", err)
+	}
+	samples = parseMetrics(t, buf.String())
+	if len(samples) != 4 || samples["app_cache_entries"] != 0 || samples[`app_cache_segment_buckets{segment="0"}`] == 0 {
+		t.Fatalf("Inconsistent metrics with prefix: %s", buf.String())
+	}
+
+	cm, _ = NewConcurrentMap(1, nil, WithMetricsPrefix("bad-prefix"))
+	if err := cm.WriteMetrics(&buf); err == nil {
+		t.Fatal("No error when writing metrics with an invalid prefix!")
+	} else if _, ok := err.(IllegalParameterError); !ok {
+		t.Fatalf("Inconsistent error type: expected: %T, actual: %T", IllegalParameterError{}, err)
+	}
+}
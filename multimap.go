@@ -0,0 +1,95 @@
+package cmap
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// ConcurrentMultiMap 是基于 ConcurrentMap 的一键多值 map
+// 每个键对应的元素是一个内部的加锁切片，因此对同一个键的并发 Add 是安全的
+// 注意！值必须是可比较的，否则 RemoveValue 会 panic
+// 被包装的 ConcurrentMap 不应再被直接修改
+type ConcurrentMultiMap struct {
+	cm ConcurrentMap
+	// 所有键的值的总数
+	total uint64
+}
+
+// valueList 代表一个键对应的全部值
+type valueList struct {
+	lock   sync.Mutex
+	values []interface{}
+	// 为 true 表示已从 map 中删除，不能再添加值
+	removed bool
+}
+
+// NewConcurrentMultiMap 会创建一个包装了给定 ConcurrentMap 的 ConcurrentMultiMap
+func NewConcurrentMultiMap(cm ConcurrentMap) *ConcurrentMultiMap {
+	return &ConcurrentMultiMap{cm: cm}
+}
+
+// Add 会为键追加一个值，同一个值可以被追加多次
+// 若值列表恰好在删除最后一个值时被移除，则会重新获取
+func (m *ConcurrentMultiMap) Add(key string, value interface{}) error {
+	for {
+		actual, _, err := m.cm.GetOrPut(key, &valueList{})
+		if err != nil {
+			return err
+		}
+		list := actual.(*valueList)
+		list.lock.Lock()
+		if list.removed {
+			list.lock.Unlock()
+			continue
+		}
+		list.values = append(list.values, value)
+		list.lock.Unlock()
+		atomic.AddUint64(&m.total, 1)
+		return nil
+	}
+}
+
+// GetAll 会按添加顺序返回键的所有值的副本，键不存在时返回 nil
+func (m *ConcurrentMultiMap) GetAll(key string) []interface{} {
+	list, ok := m.cm.Get(key).(*valueList)
+	if !ok {
+		return nil
+	}
+	list.lock.Lock()
+	defer list.lock.Unlock()
+	if list.removed {
+		return nil
+	}
+	values := make([]interface{}, len(list.values))
+	copy(values, list.values)
+	return values
+}
+
+// RemoveValue 会删除键的第一个等于 value 的值，返回值表示是否删除
+// 删除最后一个值时会同时删除键，删除失败（如正在调整并发量）时键保留一个空的值列表
+func (m *ConcurrentMultiMap) RemoveValue(key string, value interface{}) bool {
+	list, ok := m.cm.Get(key).(*valueList)
+	if !ok {
+		return false
+	}
+	list.lock.Lock()
+	defer list.lock.Unlock()
+	for i, v := range list.values {
+		if v != value {
+			continue
+		}
+		list.values = append(list.values[:i], list.values[i+1:]...)
+		decreaseUint64(&m.total)
+		// 只有成功删除键后才标记为已删除，否则 Add 会一直拿到这个不能再添加值的列表
+		if len(list.values) == 0 && m.cm.Delete(key) {
+			list.removed = true
+		}
+		return true
+	}
+	return false
+}
+
+// Len 会返回所有键的值的总数
+func (m *ConcurrentMultiMap) Len() uint64 {
+	return atomic.LoadUint64(&m.total)
+}
@@ -0,0 +1,105 @@
+package cmap
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConcurrentMultiMapAddInParallel(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	mm := NewConcurrentMultiMap(cm)
+	number := 100
+	var wg sync.WaitGroup
+	wg.Add(number)
+	for i := 0; i < number; i++ {
+		go func(i int) {
+			defer wg.Done()
+			if err := mm.Add("key", i); err != nil {
+				t.Errorf("An error occurs when adding a value: %s", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	values := mm.GetAll("key")
+	if len(values) != number {
+		t.Fatalf("Inconsistent value count: expected: %d, actual: %d", number, len(values))
+	}
+	seen := make(map[interface{}]bool)
+	for _, v := range values {
+		seen[v] = true
+	}
+	if len(seen) != number {
+		t.Fatalf("Inconsistent distinct value count: expected: %d, actual: %d", number, len(seen))
+	}
+	if mm.Len() != uint64(number) {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d", number, mm.Len())
+	}
+}
+
+func TestConcurrentMultiMapRemoveValue(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	mm := NewConcurrentMultiMap(cm)
+	for _, v := range []string{"a", "b", "a"} {
+		mm.Add("key", v)
+	}
+	mm.Add("other", "a")
+	if !mm.RemoveValue("key", "a") {
+		t.Fatal("Couldn't remove value a!")
+	}
+	if mm.RemoveValue("key", "c") || mm.RemoveValue("nonexistent", "a") {
+		t.Fatal("Removed a nonexistent value!")
+	}
+	values := mm.GetAll("key")
+	if len(values) != 2 || values[0] != "b" || values[1] != "a" {
+		t.Fatalf("Inconsistent values: expected: %v, actual: %v", []interface{}{"b", "a"}, values)
+	}
+	mm.RemoveValue("key", "a")
+	mm.RemoveValue("key", "b")
+	if values := mm.GetAll("key"); values != nil {
+		t.Fatalf("Inconsistent values: expected: %v, actual: %v", nil, values)
+	}
+	if cm.Contains("key") {
+		t.Fatal("The key is not deleted after removing all values!")
+	}
+	if mm.Len() != 1 {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d", 1, mm.Len())
+	}
+	// 删除后可以重新添加
+	mm.Add("key", "c")
+	if values := mm.GetAll("key"); len(values) != 1 || values[0] != "c" {
+		t.Fatalf("Inconsistent values: expected: %v, actual: %v", []interface{}{"c"}, values)
+	}
+}
+
+func TestConcurrentMultiMapRemoveValueDeleteFailed(t *testing.T) {
+	cm, _ := NewConcurrentMap(1, nil)
+	mm := NewConcurrentMultiMap(cm)
+	mm.Add("key", "a")
+	// 模拟正在调整并发量，此时删除键会失败
+	c := cm.(*myConcurrentMap)
+	atomic.StoreInt32(&c.resizing, 1)
+	if !mm.RemoveValue("key", "a") {
+		t.Fatal("Couldn't remove the value!")
+	}
+	atomic.StoreInt32(&c.resizing, 0)
+	if !cm.Contains("key") {
+		t.Fatal("The key is deleted while the map is resizing!")
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- mm.Add("key", "b")
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("An error occurs when adding the value: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Add doesn't return after the failed delete!")
+	}
+	if values := mm.GetAll("key"); len(values) != 1 || values[0] != "b" {
+		t.Fatalf("Inconsistent values: expected: %v, actual: %v", []interface{}{"b"}, values)
+	}
+}
@@ -0,0 +1,113 @@
+package cmap
+
+// actionOp 代表 Action 的操作类型
+type actionOp uint8
+
+const (
+	actionKeep actionOp = iota
+	actionDelete
+	actionUpdate
+)
+
+// Action 代表 RangeMutable 的回调函数对当前键值对的处理方式
+type Action struct {
+	op      actionOp
+	element interface{}
+}
+
+var (
+	// ActionKeep 代表保留当前键值对
+	ActionKeep = Action{op: actionKeep}
+	// ActionDelete 代表删除当前键值对
+	ActionDelete = Action{op: actionDelete}
+)
+
+// ActionUpdate 代表将当前键值对的元素更新为 element
+// element 为 nil 时等同于 ActionKeep
+func ActionUpdate(element interface{}) Action {
+	if element == nil {
+		return ActionKeep
+	}
+	return Action{op: actionUpdate, element: element}
+}
+
+// pendingAction 代表回调函数返回之后等待执行的 Action
+type pendingAction struct {
+	key     string
+	version uint64
+	action  Action
+}
+
+// RangeMutable 会逐个散列段地先不加锁地遍历并调用 f，
+// 再在散列段的锁的保护下执行返回的 Action，因此 f 中可以安全地访问当前 map
+// 执行前会确认键仍然存在且其版本号未变，否则忽略该 Action
+// 删除引起的收缩会把键值对替换为保留版本号的副本，因此按键和版本号而不是按键值对本身确认
+func (c *myConcurrentMap) RangeMutable(f func(key string, element interface{}) Action) {
+	for i, s := range c.getSegments() {
+		var pending []pendingAction
+		goOn := s.Range(func(p Pair) bool {
+			version := p.Version()
+			element, err := c.decodeElement(p.Element())
+			if err != nil {
+				return true
+			}
+			var action Action
+			if !c.opts.invokeCallback(func() {
+				action = f(p.Key(), element)
+			}) {
+				return false
+			}
+			if action.op != actionKeep {
+				pending = append(pending, pendingAction{key: p.Key(), version: version, action: action})
+			}
+			return true
+		})
+		c.applyActions(i, s, pending)
+		if !goOn {
+			return
+		}
+	}
+}
+
+// applyActions 会在散列段的锁的保护下执行等待中的 Action
+// 若遍历期间散列段已被 Resize 或 ReplaceAll 替换，或者正在调整并发量，则放弃执行
+func (c *myConcurrentMap) applyActions(index int, s Segment, pending []pendingAction) {
+	if len(pending) == 0 {
+		return
+	}
+	var evicted []Pair
+	// 在释放 resizeLock 之后调用
+	defer func() {
+		c.notifyEvicted(evicted)
+	}()
+	if err := c.lockForWrite(); err != nil {
+		return
+	}
+	defer c.resizeLock.RUnlock()
+	if segments := c.getSegments(); index >= len(segments) || segments[index] != s {
+		return
+	}
+	s.Atomic(func(tx SegmentTx) {
+		for _, pa := range pending {
+			p := tx.Get(pa.key)
+			if p == nil || p.Version() != pa.version {
+				continue
+			}
+			switch pa.action.op {
+			case actionDelete:
+				if deleted, ok := tx.Delete(pa.key); ok {
+					decreaseUint64(&c.total)
+					evicted = append(evicted, deleted)
+				}
+			case actionUpdate:
+				if element, err := c.encodeElement(pa.action.element); err == nil {
+					p.SetElement(element)
+					if c.opts.elementChecksum != nil {
+						p.SetChecksum(c.opts.elementChecksum(element))
+					}
+					c.opts.recordMutation(p.Key(), MUTATION_OP_UPDATE)
+				}
+			}
+		}
+	})
+}
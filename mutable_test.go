@@ -0,0 +1,102 @@
+package cmap
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCmapRangeMutable(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	number := 100
+	for i := 0; i < number; i++ {
+		cm.Put(fmt.Sprintf("key-%d", i), i)
+	}
+	var visited int
+	cm.RangeMutable(func(key string, element interface{}) Action {
+		visited++
+		i := element.(int)
+		if i%2 == 0 {
+			return ActionDelete
+		}
+		if i%5 == 0 {
+			// 回调函数中可以访问 map
+			cm.Get(key)
+			return ActionKeep
+		}
+		return ActionUpdate(i * 10)
+	})
+	if visited != number {
+		t.Fatalf("Inconsistent visited count: expected: %d, actual: %d", number, visited)
+	}
+	if cm.Len() != uint64(number/2) {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", number/2, cm.Len())
+	}
+	for i := 0; i < number; i++ {
+		actual := cm.Get(fmt.Sprintf("key-%d", i))
+		var expected interface{}
+		switch {
+		case i%2 == 0:
+			expected = nil
+		case i%5 == 0:
+			expected = i
+		default:
+			expected = i * 10
+		}
+		if actual != expected {
+			t.Fatalf("Inconsistent element of key-%d: expected: %v, actual: %v", i, expected, actual)
+		}
+	}
+}
+
+func TestCmapRangeMutableConcurrentUpdate(t *testing.T) {
+	cm, _ := NewConcurrentMap(1, nil)
+	cm.Put("a", 1)
+	cm.Put("b", 2)
+	cm.RangeMutable(func(key string, element interface{}) Action {
+		// 回调返回之前被修改过的键值对不会被删除
+		cm.Put(key, 3)
+		return ActionDelete
+	})
+	if cm.Len() != 2 || cm.Get("a") != 3 || cm.Get("b") != 3 {
+		t.Fatalf("Actions on modified pairs are applied: length: %d, a: %v, b: %v", cm.Len(), cm.Get("a"), cm.Get("b"))
+	}
+}
+
+func TestCmapRangeMutableShrink(t *testing.T) {
+	// 删除会使单个散列段逐步收缩，收缩后键值对都被替换为副本
+	cm, _ := NewConcurrentMap(1, nil)
+	number := 20000
+	for i := 0; i < number; i++ {
+		cm.Put(fmt.Sprintf("key-%d", i), i)
+	}
+	s := cm.(*myConcurrentMap).getSegments()[0]
+	grown := s.BucketNumber()
+	cm.RangeMutable(func(key string, element interface{}) Action {
+		if element.(int)%8 == 0 {
+			return ActionUpdate(-1)
+		}
+		return ActionDelete
+	})
+	if s.BucketNumber() >= grown {
+		t.Fatalf("The segment doesn't shrink: before: %d, after: %d", grown, s.BucketNumber())
+	}
+	if cm.Len() != uint64(number/8) {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", number/8, cm.Len())
+	}
+	for i := 0; i < number; i++ {
+		var expected interface{}
+		if i%8 == 0 {
+			expected = -1
+		}
+		if actual := cm.Get(fmt.Sprintf("key-%d", i)); actual != expected {
+			t.Fatalf("Inconsistent element of key-%d: expected: %v, actual: %v", i, expected, actual)
+		}
+	}
+
+	cm.RangeMutable(func(key string, element interface{}) Action {
+		return ActionDelete
+	})
+	if cm.Len() != 0 {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", 0, cm.Len())
+	}
+}
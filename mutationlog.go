@@ -0,0 +1,119 @@
+package cmap
+
+import (
+	"sync"
+	"time"
+)
+
+// MutationOp 代表 WithMutationLog 记录的修改的类型。
+type MutationOp uint8
+
+const (
+	// MUTATION_OP_INSERT 代表放入了一个新键。
+	MUTATION_OP_INSERT MutationOp = 0
+	// MUTATION_OP_UPDATE 代表替换了已有键的元素。
+	MUTATION_OP_UPDATE MutationOp = 1
+	// MUTATION_OP_DELETE 代表删除了一个键。
+	MUTATION_OP_DELETE MutationOp = 2
+)
+
+func (op MutationOp) String() string {
+	switch op {
+	case MUTATION_OP_INSERT:
+		return "insert"
+	case MUTATION_OP_UPDATE:
+		return "update"
+	case MUTATION_OP_DELETE:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// Mutation 代表一次对键的修改
+type Mutation struct {
+	Key  string
+	Op   MutationOp
+	Time time.Time
+}
+
+// mutationLog 代表保存最近若干次修改的环形缓冲区
+// 它有自己的互斥锁，只在追加和复制时短暂持有，所有方法都是并发安全的
+type mutationLog struct {
+	entries []Mutation
+	// next 代表下一次修改写入的位置，full 代表缓冲区是否已经写满过一轮
+	next int
+	full bool
+	lock sync.Mutex
+}
+
+// record 用于追加一次修改，缓冲区已满时覆盖最早的修改
+func (ml *mutationLog) record(key string, op MutationOp) {
+	now := time.Now()
+	ml.lock.Lock()
+	defer ml.lock.Unlock()
+	ml.entries[ml.next] = Mutation{Key: key, Op: op, Time: now}
+	if ml.next++; ml.next == len(ml.entries) {
+		ml.next = 0
+		ml.full = true
+	}
+}
+
+// snapshot 用于按从早到晚的顺序返回缓冲区中所有修改的副本
+func (ml *mutationLog) snapshot() []Mutation {
+	ml.lock.Lock()
+	defer ml.lock.Unlock()
+	if !ml.full {
+		return append([]Mutation(nil), ml.entries[:ml.next]...)
+	}
+	mutations := make([]Mutation, 0, len(ml.entries))
+	mutations = append(mutations, ml.entries[ml.next:]...)
+	return append(mutations, ml.entries[:ml.next]...)
+}
+
+// migrationMuter 代表能够暂停记录修改的散列段。
+// Resize 把键值对的副本放入新的散列段时用它避免把迁移记录为修改。
+type migrationMuter interface {
+	// muteMutations 会设置是否暂停记录修改。
+	muteMutations(muted bool)
+}
+
+func (s *segment) muteMutations(muted bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.mutationsMuted = muted
+}
+
+// muteMutations 用于设置 segments 中的散列段是否暂停记录修改
+func muteMutations(segments []Segment, muted bool) {
+	for _, s := range segments {
+		if muter, ok := s.(migrationMuter); ok {
+			muter.muteMutations(muted)
+		}
+	}
+}
+
+// recordMutation 用于在启用了 WithMutationLog 且未暂停记录时记录一次修改
+// 注意！必须在互斥锁的保护下调用该方法
+func (s *segment) recordMutation(key string, op MutationOp) {
+	if !s.mutationsMuted {
+		s.opts.recordMutation(key, op)
+	}
+}
+
+// recordMutation 用于在启用了 WithMutationLog 时记录一次修改
+func (opts *options) recordMutation(key string, op MutationOp) {
+	if opts.mutationLog != nil {
+		opts.mutationLog.record(key, op)
+	}
+}
+
+func newMutationLog(size int) *mutationLog {
+	return &mutationLog{entries: make([]Mutation, size)}
+}
+
+func (c *myConcurrentMap) RecentMutations() []Mutation {
+	if c.opts.mutationLog == nil {
+		return nil
+	}
+	return c.opts.mutationLog.snapshot()
+}
@@ -0,0 +1,75 @@
+package cmap
+
+import (
+	"fmt"
+	"testing"
+)
+
+// assertMutations 用于断言 mutations 的键和操作类型依次与 expected 一致，且时间不递减
+func assertMutations(t *testing.T, mutations []Mutation, expected []Mutation) {
+	if len(mutations) != len(expected) {
+		t.Fatalf("Inconsistent mutation number: expected: %d, actual: %d (%v)", len(expected), len(mutations), mutations)
+	}
+	for i, m := range mutations {
+		if m.Key != expected[i].Key || m.Op != expected[i].Op {
+			t.Fatalf("Inconsistent mutation #%d: expected: %s %s, actual: %s %s",
+				i, expected[i].Op, expected[i].Key, m.Op, m.Key)
+		}
+		if m.Time.IsZero() || (i > 0 && m.Time.Before(mutations[i-1].Time)) {
+			t.Fatalf("Inconsistent time of mutation #%d: %v", i, m.Time)
+		}
+	}
+}
+
+func TestCmapRecentMutations(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil, WithMutationLog(8))
+	cm.Put("a", 1)
+	cm.Put("b", 2)
+	cm.Put("a", 3)
+	cm.Delete("b")
+	cm.Delete("missing")
+	if _, ok := cm.TakeElement("a"); !ok {
+		t.Fatal("Not found the element to take!")
+	}
+	assertMutations(t, cm.RecentMutations(), []Mutation{
+		{Key: "a", Op: MUTATION_OP_INSERT},
+		{Key: "b", Op: MUTATION_OP_INSERT},
+		{Key: "a", Op: MUTATION_OP_UPDATE},
+		{Key: "b", Op: MUTATION_OP_DELETE},
+		{Key: "a", Op: MUTATION_OP_UPDATE},
+	})
+
+	// 迁移不算修改
+	if err := cm.Resize(2); err != nil {
+		t.Fatalf("An error occurs when resizing the map: %s", err)
+	}
+	if actual := len(cm.RecentMutations()); actual != 5 {
+		t.Fatalf("Inconsistent mutation number after resizing: expected: %d, actual: %d", 5, actual)
+	}
+
+	// 超出容量后只保留最近的修改
+	var expected []Mutation
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		cm.Put(key, i)
+		if i >= 12 {
+			expected = append(expected, Mutation{Key: key, Op: MUTATION_OP_INSERT})
+		}
+	}
+	mutations := cm.RecentMutations()
+	assertMutations(t, mutations, expected)
+	// 返回的是副本
+	mutations[0].Key = "changed"
+	assertMutations(t, cm.RecentMutations(), expected)
+
+	cm, _ = NewConcurrentMap(1, nil)
+	cm.Put("a", 1)
+	if mutations := cm.RecentMutations(); mutations != nil {
+		t.Fatalf("Inconsistent mutations when disabled: expected: %v, actual: %v", nil, mutations)
+	}
+	cm, _ = NewConcurrentMap(1, nil, WithMutationLog(0))
+	cm.Put("a", 1)
+	if mutations := cm.RecentMutations(); mutations != nil {
+		t.Fatalf("Inconsistent mutations when disabled: expected: %v, actual: %v", nil, mutations)
+	}
+}
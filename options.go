@@ -0,0 +1,515 @@
+package cmap
+
+import "time"
+
+// Option 代表并发安全 map 的可选配置项
+type Option func(opts *options)
+
+// options 代表并发安全 map 的全部可选配置
+// 在 map 创建完成后只读，由所有散列段共享
+type options struct {
+	// hash 代表用于计算键的散列值的函数
+	hash func(key string) uint64
+	// bucketNumber 代表每个散列段初始的散列桶数量
+	bucketNumber int
+	// loadFactor 代表默认再分布器的装载因子
+	loadFactor float64
+	// redistributeHook 会在散列段的散列桶数量变化后被调用
+	redistributeHook func(segmentIndex int, oldBuckets, newBuckets int)
+	// collisionObserver 会在新键被放入非空的散列桶后被调用
+	collisionObserver func(key string, bucketIndex int, chainLenBefore int)
+	// prefixIndex 代表键的前缀索引，为 nil 表示未启用
+	// 散列段会在其锁的保护下更新索引，以保证索引与散列段一致
+	prefixIndex *prefixIndex
+	// keyInterner 代表键的驻留表，为 nil 表示未启用
+	// 散列段会在其锁的保护下更新驻留表，与 prefixIndex 相同
+	keyInterner *keyInterner
+	// insertionOrder 代表键的插入顺序，为 nil 表示未启用
+	// 散列段会在其锁的保护下更新插入顺序，与 prefixIndex 相同
+	insertionOrder *insertionOrder
+	// accessCounting 代表是否在 Get 时统计键值对的访问次数
+	accessCounting bool
+	// softValues 代表是否启用软引用元素
+	softValues bool
+	// softMaxAge 代表软引用元素的最长闲置时间
+	softMaxAge time.Duration
+	// softMaxEntries 代表开始回收软引用元素时键值对数量的阈值
+	softMaxEntries uint64
+	// keyNormalizer 会在计算散列值之前对键进行规范化，为 nil 表示不规范化
+	keyNormalizer func(key string) string
+	// keyEncoder 用于将非 string 类型的键编码为字符串，为 nil 表示不支持
+	keyEncoder func(key interface{}) (string, error)
+	// backgroundRehash 代表是否在后台逐步进行再散列
+	backgroundRehash bool
+	// latencyTracker 代表操作耗时统计，为 nil 表示未启用
+	latencyTracker *latencyTracker
+	// autoTune 代表是否启用并发量的自动调整
+	autoTune bool
+	// autoTunePolicy 代表自动调整的策略
+	autoTunePolicy AutoTunePolicy
+	// autoTuneInterval 代表自动调整的统计周期
+	autoTuneInterval time.Duration
+	// callbackRecovery 会接收用户回调函数中发生的 panic，为 nil 表示不捕获
+	callbackRecovery func(recovered interface{})
+	// elementEncoder 和 elementDecoder 代表元素的编解码函数，为 nil 表示不编码
+	elementEncoder func(element interface{}) (interface{}, error)
+	elementDecoder func(element interface{}) (interface{}, error)
+	// backingStore 代表未命中时读取的后备存储，为 nil 表示没有
+	backingStore BackingStore
+	// onEvict 会在键值对离开 map 后被调用，为 nil 表示不调用
+	onEvict func(key string, element interface{})
+	// elementChecksum 用于计算元素的校验和，为 nil 表示不记录
+	elementChecksum func(element interface{}) uint64
+	// maxEntries 代表键值对数量的上限，为 0 表示不限制
+	maxEntries uint64
+	// parallelInit 代表是否并行地初始化散列段
+	parallelInit bool
+	// hashSeeded 代表是否使用带种子的散列函数，hashSeed 代表其种子
+	hashSeeded bool
+	hashSeed   uint64
+	// redistributionCounter 代表再分布的累计统计，为 nil 表示未启用
+	redistributionCounter *redistributionCounter
+	// rejectPairElements 代表是否拒绝放入本身就是 Pair 的元素
+	rejectPairElements bool
+	// deleteMode 代表删除键值对的方式
+	deleteMode DeleteMode
+	// bucketImpl 代表散列桶的实现方式
+	bucketImpl BucketImpl
+	// lookupCounter 代表 Get 命中和未命中的累计次数，为 nil 表示未启用
+	lookupCounter *lookupCounter
+	// metricsPrefix 代表 WriteMetrics 输出的指标名称的前缀
+	metricsPrefix string
+	// getIntoReset 代表 GetInto 是否在填充前清空 dst
+	getIntoReset bool
+	// mutationLog 代表最近修改的记录，为 nil 表示未启用
+	mutationLog *mutationLog
+	// maxConcurrency 代表 NewConcurrentMap 和 Resize 允许的最大并发量
+	maxConcurrency int
+	// maxLookupDepth 代表 Get 在一个散列桶中最多访问的键值对数量，为 0 表示不限制
+	maxLookupDepth int
+}
+
+// WithRedistributeHook 用于设置再分布回调
+// 当某个散列段的再分布改变了散列桶数量后，hook 会在散列段的锁之外被调用
+func WithRedistributeHook(hook func(segmentIndex int, oldBuckets, newBuckets int)) Option {
+	return func(opts *options) {
+		opts.redistributeHook = hook
+	}
+}
+
+// WithPrefixIndex 用于启用键的前缀索引
+// 启用后 Put 和 Delete 会同时更新索引，RangePrefix 只会访问匹配的键
+// 这会增加写操作的开销和内存占用
+func WithPrefixIndex(enabled bool) Option {
+	return func(opts *options) {
+		if enabled {
+			opts.prefixIndex = newPrefixIndex()
+		} else {
+			opts.prefixIndex = nil
+		}
+	}
+}
+
+// WithInsertionOrder 用于记录键的插入顺序，使 RangeInOrder 可以按插入顺序遍历
+// 启用后新键会被追加到顺序表的末尾，删除键时会将其移出，替换已有键的元素不改变其顺序
+// 每个键会额外占用一个链表节点和一个索引项，每次新增和删除也都要获取顺序表的锁
+func WithInsertionOrder(enabled bool) Option {
+	return func(opts *options) {
+		if enabled {
+			opts.insertionOrder = newInsertionOrder()
+		} else {
+			opts.insertionOrder = nil
+		}
+	}
+}
+
+// WithHash 用于设置自定义的散列函数，nil 会被忽略
+func WithHash(fn func(key string) uint64) Option {
+	return func(opts *options) {
+		if fn != nil {
+			opts.hash = fn
+		}
+	}
+}
+
+// WithBucketNumber 用于设置每个散列段初始的散列桶数量
+// 默认为 DEFAULT_BUCKET_NUMBER，不大于 0 的值会被忽略
+func WithBucketNumber(n int) Option {
+	return func(opts *options) {
+		if n > 0 {
+			opts.bucketNumber = n
+		}
+	}
+}
+
+// WithLoadFactor 用于设置默认再分布器的装载因子
+// 默认为 DEFAULT_BUCKET_LOAD_FACTOR，不大于 0 的值会被忽略
+// 注意！若创建 map 时传入了再分布器，该配置不生效
+func WithLoadFactor(f float64) Option {
+	return func(opts *options) {
+		if f > 0 {
+			opts.loadFactor = f
+		}
+	}
+}
+
+// WithHashAlgorithm 用于选择内置的散列算法，默认使用 HASH_ALGO_BKDR
+// 未知的算法会被忽略
+func WithHashAlgorithm(algo HashAlgo) Option {
+	return func(opts *options) {
+		if fn := hashFuncOf(algo); fn != nil {
+			opts.hash = fn
+		}
+	}
+}
+
+// WithKeyInterning 用于启用键的驻留
+// 所有启用了驻留的 map 共用一张驻留表，新放入的键会被替换为表中相等的字符串，
+// 使不同 map 中相等的键共享底层字节，适用于多个 map 存放同一批键的场景
+// 驻留表按引用计数管理，键的最后一个键值对被删除时才会将其移出，因此驻留表的大小不会超过各 map 键值对数量之和
+// 注意！启用后 Segment.Put 会替换传入的新键值对的键，传入的键值对不能同时被其他 goroutine 使用
+func WithKeyInterning(enabled bool) Option {
+	return func(opts *options) {
+		if enabled {
+			opts.keyInterner = sharedKeyInterner
+		} else {
+			opts.keyInterner = nil
+		}
+	}
+}
+
+// WithAccessCounting 用于启用访问次数统计
+// 启用后每次 Get 命中都会以原子操作将键值对的访问次数加一，可配合 LeastFrequent 实现 LFU 淘汰
+func WithAccessCounting(enabled bool) Option {
+	return func(opts *options) {
+		opts.accessCounting = enabled
+	}
+}
+
+// WithSoftValues 用于启用软引用元素
+// Go 没有真正的软引用，因此这里按“闲置时间+数量”近似：
+// 启用后放入和命中的 Get 会记录键值对最近的使用时间，
+// ReclaimSoftValues 会在键值对数量超过阈值时删除闲置过久的键值对，被删除的键在 Get 时不存在
+// 注意！回收只在调用 ReclaimSoftValues 时发生，并不感知真实的内存压力
+func WithSoftValues(enabled bool) Option {
+	return func(opts *options) {
+		opts.softValues = enabled
+	}
+}
+
+// WithSoftValuePolicy 用于设置软引用元素的回收策略
+// 只有在键值对数量超过 maxEntries 时，闲置超过 maxAge 的键值对才会被回收；maxEntries 为 0 表示不限制数量
+// maxAge 小于等于 0 时会被忽略
+func WithSoftValuePolicy(maxAge time.Duration, maxEntries uint64) Option {
+	return func(opts *options) {
+		if maxAge > 0 {
+			opts.softMaxAge = maxAge
+		}
+		opts.softMaxEntries = maxEntries
+	}
+}
+
+// WithKeyNormalizer 用于设置键的规范化函数，例如使用 strings.ToLower 使键不区分大小写
+// 所有接收键的方法都会先规范化键，存储和遍历时得到的也是规范化后的键
+// 注意！normalizer 必须是幂等的
+func WithKeyNormalizer(normalizer func(key string) string) Option {
+	return func(opts *options) {
+		opts.keyNormalizer = normalizer
+	}
+}
+
+// WithKeyEncoder 用于设置 PutAny、GetAny 和 DeleteAny 使用的键编码函数
+// encoder 必须保证相等的键得到相同的字符串，不相等的键得到不同的字符串
+func WithKeyEncoder(encoder func(key interface{}) (string, error)) Option {
+	return func(opts *options) {
+		opts.keyEncoder = encoder
+	}
+}
+
+// WithBackgroundRehash 用于启用后台再散列
+// 启用后触发再分布的写操作不再同步重建散列桶，而是由后台 goroutine 在散列段的锁的保护下
+// 每次迁移少量散列桶，避免单次写操作承担全部的再分布开销
+// 注意！只对默认的再分布器有效，使用自定义再分布器时仍会同步再分布
+func WithBackgroundRehash(enabled bool) Option {
+	return func(opts *options) {
+		opts.backgroundRehash = enabled
+	}
+}
+
+// WithStats 用于启用再分布统计，可通过 RedistributionStats 获取
+// 只有再分布时才会多出取时间和几次原子操作的开销，不影响普通的读写操作
+func WithStats(enabled bool) Option {
+	return func(opts *options) {
+		if enabled {
+			opts.redistributionCounter = &redistributionCounter{}
+		} else {
+			opts.redistributionCounter = nil
+		}
+	}
+}
+
+// WithCollisionObserver 用于观察散列碰撞
+// 每当新键被放入已有键值对的散列桶时，observer 会以键、散列桶在散列段中的索引和放入前的链表长度被调用，
+// 替换已有键的元素以及再分布时的重新放入都不算碰撞
+// 注意！observer 在放入时已持有的散列段的锁的保护下被调用，不会额外加锁，
+// 但会阻塞同一散列段的其他操作，因此应尽快返回，也不能在其中访问当前 map
+func WithCollisionObserver(observer func(key string, bucketIndex int, chainLenBefore int)) Option {
+	return func(opts *options) {
+		opts.collisionObserver = observer
+	}
+}
+
+// WithGetIntoReset 用于使 GetInto 在填充 dst 之前先将其清空
+// 清空整个 map 不会释放其已分配的空间，因此复用 dst 时仍然不需要重新分配
+func WithGetIntoReset(enabled bool) Option {
+	return func(opts *options) {
+		opts.getIntoReset = enabled
+	}
+}
+
+// WithMaxConcurrency 用于设置允许的最大并发量，默认为 MAX_CONCURRENCY
+// 超过上限时 NewConcurrentMap 和 Resize 会返回 ConcurrencyLimitError
+// n 小于等于 0 或大于 MAX_CONCURRENCY 时使用 MAX_CONCURRENCY
+func WithMaxConcurrency(n int) Option {
+	return func(opts *options) {
+		if n <= 0 || n > MAX_CONCURRENCY {
+			n = MAX_CONCURRENCY
+		}
+		opts.maxConcurrency = n
+	}
+}
+
+// WithMaxLookupDepth 用于限制 Get 和 GetWithError 在一个散列桶的链表中最多访问的键值对数量
+// 达到上限仍未找到键时 Get 返回 nil，GetWithError 返回 ChainTooDeepError，从而限制恶意构造的散列碰撞造成的最坏耗时
+// 与 WithRandomSeed 一起使用时，攻击者难以构造出会落入同一散列桶的键；n 小于等于 0 时不限制
+// 注意！写操作和 Contains 等其他读操作不受该限制
+func WithMaxLookupDepth(n int) Option {
+	return func(opts *options) {
+		if n < 0 {
+			n = 0
+		}
+		opts.maxLookupDepth = n
+	}
+}
+
+// WithMutationLog 用于启用最近修改的记录，以便调试
+// 启用后每次放入、替换和删除都会把键、操作类型和时间追加到容量为 size 的环形缓冲区中，
+// 可通过 RecentMutations 获取最近的 size 次修改；size 小于等于 0 时不启用
+// 缓冲区有自己的互斥锁，但所有写操作都会争用它，因此只应在调试时启用
+// 注意！Resize 的迁移不算修改，热点键的原子递增也不会被记录
+func WithMutationLog(size int) Option {
+	return func(opts *options) {
+		if size > 0 {
+			opts.mutationLog = newMutationLog(size)
+		} else {
+			opts.mutationLog = nil
+		}
+	}
+}
+
+// WithLookupStats 用于启用 Get 命中和未命中次数的统计，结果由 WriteMetrics 输出
+// 启用后每次 Get 都会多一次原子操作，与 WithStats 分开也是为了不影响未启用时的读操作
+func WithLookupStats(enabled bool) Option {
+	return func(opts *options) {
+		if enabled {
+			opts.lookupCounter = &lookupCounter{}
+		} else {
+			opts.lookupCounter = nil
+		}
+	}
+}
+
+// WithMetricsPrefix 用于设置 WriteMetrics 输出的指标名称的前缀，默认为 DEFAULT_METRICS_PREFIX
+// prefix 必须是合法的 Prometheus 指标名称，否则 WriteMetrics 会返回 IllegalParameterError
+func WithMetricsPrefix(prefix string) Option {
+	return func(opts *options) {
+		opts.metricsPrefix = prefix
+	}
+}
+
+// WithLatencyTracking 用于启用操作耗时统计
+// 启用后 Put、Get 和 Delete 会将耗时记录到按 2 的幂分组的直方图中，可通过 OperationLatencies 获取
+// 每次操作会多出两次取时间和几次原子操作的开销
+func WithLatencyTracking(enabled bool) Option {
+	return func(opts *options) {
+		if enabled {
+			opts.latencyTracker = newLatencyTracker()
+		} else {
+			opts.latencyTracker = nil
+		}
+	}
+}
+
+// WithAutoTune 用于启用并发量的自动调整
+// 启用后散列段会统计被访问的次数，后台 goroutine 会周期性地根据策略调用 Resize
+// 默认使用 NewHotSegmentPolicy 创建的策略，统计周期为 DEFAULT_AUTO_TUNE_INTERVAL
+// 注意！启用后需要调用 StopAutoTune 来结束后台 goroutine
+func WithAutoTune(enabled bool) Option {
+	return func(opts *options) {
+		opts.autoTune = enabled
+	}
+}
+
+// WithAutoTunePolicy 用于设置自动调整的策略和统计周期
+// policy 为 nil 或 interval 小于等于 0 时对应的设置会被忽略
+func WithAutoTunePolicy(policy AutoTunePolicy, interval time.Duration) Option {
+	return func(opts *options) {
+		if policy != nil {
+			opts.autoTunePolicy = policy
+		}
+		if interval > 0 {
+			opts.autoTuneInterval = interval
+		}
+	}
+}
+
+// WithCallbackRecovery 用于捕获用户回调函数（如 Range 的 f）中发生的 panic
+// 捕获后 handler 会收到 recover 的结果，发生 panic 的操作会提前结束
+// 未设置时 panic 会继续向上传播，但散列段的锁总会先被释放
+func WithCallbackRecovery(handler func(recovered interface{})) Option {
+	return func(opts *options) {
+		opts.callbackRecovery = handler
+	}
+}
+
+// WithElementCodec 用于设置元素的编解码函数，如对元素进行压缩
+// 放入时会存放 encode 的结果，Get 等读取单个元素的方法会返回 decode 的结果
+// Range、Clone 等遍历键值对的方法访问的是编码后的元素
+func WithElementCodec(encode, decode func(element interface{}) (interface{}, error)) Option {
+	return func(opts *options) {
+		opts.elementEncoder = encode
+		opts.elementDecoder = decode
+	}
+}
+
+// WithBackingStore 用于设置后备存储，使 map 成为其前面的缓存
+// Get 未命中时会读取 store，读到的元素会被放入 map 后返回，对同一个键的并发读取会被合并
+func WithBackingStore(store BackingStore) Option {
+	return func(opts *options) {
+		opts.backingStore = store
+	}
+}
+
+// WithOnEvict 用于设置键值对离开 map 时的回调，可用于关闭存放在元素中的文件或连接
+// Delete、DeleteAndReturn、DeleteMatching、DeleteExpired、ReclaimSoftValues、RangeMutable、TxSegment 删除的键值对，
+// 以及被 ReplaceAll 丢弃的键值对都会触发回调，每个键值对只会触发一次
+// 回调在散列段的锁和 resizeLock 之外被调用，因此其中可以安全地访问当前 map
+func WithOnEvict(f func(key string, element interface{})) Option {
+	return func(opts *options) {
+		opts.onEvict = f
+	}
+}
+
+// WithElementChecksum 用于在放入元素时记录其校验和，以便 VerifyChecksums 发现被外部修改过的元素
+// 这是用于排查元素被共享和修改的诊断功能，每次放入都会额外调用一次 checksum
+// 设置了 WithElementCodec 时计算的是编码后的元素的校验和
+func WithElementChecksum(checksum func(element interface{}) uint64) Option {
+	return func(opts *options) {
+		opts.elementChecksum = checksum
+	}
+}
+
+// WithMaxEntries 用于设置键值对数量的上限，为 0 表示不限制
+// 达到上限后放入新键会返回 CapacityExceededError，替换已有键的元素不受影响
+// 名额在散列段的锁的保护下以原子操作占用，因此并发放入也不会超出上限
+// 注意！Reserve 预留的键在提交时不检查上限
+func WithMaxEntries(n uint64) Option {
+	return func(opts *options) {
+		opts.maxEntries = n
+	}
+}
+
+// WithParallelInit 用于在创建散列段时由多个 goroutine 并行地初始化散列段及其散列桶
+// 每个 goroutine 在初始化期间会锁定到一个系统线程上，使其分配的内存尽量靠近该线程所在的节点
+// Go 运行时无法把线程绑定到指定的 NUMA 节点，因此这只是一种提示，主要作用是加快大 map 的创建
+func WithParallelInit(enabled bool) Option {
+	return func(opts *options) {
+		opts.parallelInit = enabled
+	}
+}
+
+// WithBucketImpl 用于选择散列桶的实现方式，默认使用 BUCKET_IMPL_LIST
+// BUCKET_IMPL_SLICE 在每次放入新键和删除时都会复制整个散列桶的快照，
+// 换来查找时对连续内存的扫描，适合散列桶较小且读多写少的场景
+func WithBucketImpl(impl BucketImpl) Option {
+	return func(opts *options) {
+		opts.bucketImpl = impl
+	}
+}
+
+// WithRejectPairElements 用于拒绝放入实现了 Pair 接口的元素，放入时返回 IllegalParameterError
+// 键值对作为元素时其 String 和序列化结果会包含整条链表，通常是在转发值的通用代码中误传了键值对
+// 检查在编码元素时进行，对所有放入或替换元素的方法都有效
+func WithRejectPairElements(enabled bool) Option {
+	return func(opts *options) {
+		opts.rejectPairElements = enabled
+	}
+}
+
+// WithDeleteMode 用于选择删除键值对的方式，默认使用 DELETE_MODE_COPY
+// DELETE_MODE_COPY_FREE 在锁的保护下直接修改前一个节点的 next，删除时不再为每个前置节点分配副本，
+// 作为代价，Get 等读操作需要在散列段的读锁的保护下遍历链表，读操作之间互不阻塞，但会与写操作互相阻塞；
+// Range 等不加锁的遍历仍是安全的，但可能读到刚被删除的键值对
+func WithDeleteMode(mode DeleteMode) Option {
+	return func(opts *options) {
+		opts.deleteMode = mode
+	}
+}
+
+// WithHashSeed 用于以 seed 作为种子计算键的散列值
+// 不同种子下发生碰撞的键不同，因此无法预先构造出能使所有键落入同一散列桶的键集合
+// 设置后会忽略 WithHash 和 WithHashAlgorithm，与配置项的顺序无关
+func WithHashSeed(seed uint64) Option {
+	return func(opts *options) {
+		opts.hashSeeded = true
+		opts.hashSeed = seed
+	}
+}
+
+// WithRandomSeed 与 WithHashSeed 相同，但种子是随机生成的
+// 每个 map 的种子都不同，重启之后也会改变，因此散列值不能持久化
+// 种子在应用配置项时才生成，因此复用同一个 Option 创建的多个 map 也各有各的种子
+func WithRandomSeed() Option {
+	return func(opts *options) {
+		WithHashSeed(randomSeed())(opts)
+	}
+}
+
+// invokeCallback 会调用用户回调函数 f，若设置了 callbackRecovery 则捕获其中的 panic
+// 返回值表示 f 是否正常返回
+func (o *options) invokeCallback(f func()) (ok bool) {
+	if o.callbackRecovery != nil {
+		defer func() {
+			if !ok {
+				o.callbackRecovery(recover())
+			}
+		}()
+	}
+	f()
+	return true
+}
+
+// newOptions 会根据给定的配置项创建一个 options 实例
+func newOptions(opts ...Option) *options {
+	o := &options{
+		hash:         hash,
+		bucketNumber: DEFAULT_BUCKET_NUMBER,
+		loadFactor:   DEFAULT_BUCKET_LOAD_FACTOR,
+		softMaxAge:   DEFAULT_SOFT_VALUE_MAX_AGE,
+
+		metricsPrefix: DEFAULT_METRICS_PREFIX,
+
+		maxConcurrency: MAX_CONCURRENCY,
+
+		autoTuneInterval: DEFAULT_AUTO_TUNE_INTERVAL,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(o)
+		}
+	}
+	if o.hashSeeded {
+		o.hash = seededHash(o.hashSeed)
+	}
+	return o
+}
@@ -0,0 +1,367 @@
+package cmap
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestOptionRedistributeHook(t *testing.T) {
+	var mu sync.Mutex
+	var bucketCounts []int
+	var cm ConcurrentMap
+	hook := func(segmentIndex int, oldBuckets, newBuckets int) {
+		// 若回调在散列段的锁内被调用，这里会发生死锁
+		cm.Get("")
+		if segmentIndex != 0 {
+			t.Errorf("Inconsistent segment index: expected: %d, actual: %d",
+				0, segmentIndex)
+		}
+		mu.Lock()
+		bucketCounts = append(bucketCounts, newBuckets)
+		mu.Unlock()
+	}
+	cm, _ = NewConcurrentMap(1, nil, WithRedistributeHook(hook))
+	for _, p := range genNoRepetitiveTestingPairs(20000) {
+		cm.Put(p.Key(), p.Element())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bucketCounts) == 0 {
+		t.Fatal("Redistribute hook is never called!")
+	}
+	prev := DEFAULT_BUCKET_NUMBER
+	for _, n := range bucketCounts {
+		if n <= prev {
+			t.Fatalf("Bucket number is not increasing: previous: %d, current: %d",
+				prev, n)
+		}
+		prev = n
+	}
+}
+
+func TestOptionKeyNormalizer(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil, WithKeyNormalizer(strings.ToLower))
+	if ok, _ := cm.Put("Foo", 1); !ok {
+		t.Fatal("Couldn't put pair {Foo: 1}!")
+	}
+	if ok, _ := cm.Put("foo", 2); ok {
+		t.Fatal("Put a duplicate pair {foo: 2}!")
+	}
+	if cm.Len() != 1 {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d", 1, cm.Len())
+	}
+	for _, key := range []string{"foo", "Foo", "FOO"} {
+		if actual := cm.Get(key); actual != 2 {
+			t.Fatalf("Inconsistent element: expected: %#v, actual: %#v (key: %s)", 2, actual, key)
+		}
+		if !cm.Contains(key) {
+			t.Fatalf("Not found key %s!", key)
+		}
+	}
+	if keys := cm.SortedKeys(); len(keys) != 1 || keys[0] != "foo" {
+		t.Fatalf("Inconsistent keys: expected: %v, actual: %v", []string{"foo"}, keys)
+	}
+	if !cm.Delete("FoO") || cm.Contains("foo") {
+		t.Fatal("Couldn't delete key foo by FoO!")
+	}
+
+	// 未设置时区分大小写
+	cm, _ = NewConcurrentMap(4, nil)
+	cm.Put("Foo", 1)
+	if cm.Contains("foo") {
+		t.Fatal("Found key foo without a normalizer!")
+	}
+}
+
+func TestOptionKeyNormalizerIfAbsent(t *testing.T) {
+	for name, withMaxEntries := range map[string]bool{"unbounded": false, "bounded": true} {
+		opts := []Option{WithKeyNormalizer(strings.ToLower)}
+		if withMaxEntries {
+			// 设置了上限时走另一条放入路径
+			opts = append(opts, WithMaxEntries(10))
+		}
+		cm, _ := NewConcurrentMap(4, nil, opts...)
+		if loaded, err := cm.PutIfAbsent("Foo", 1); loaded || err != nil {
+			t.Fatalf("Inconsistent result of %s: expected: false <nil>, actual: %v %v", name, loaded, err)
+		}
+		if loaded, err := cm.PutIfAbsent("foo", 2); !loaded || err != nil {
+			t.Fatalf("Inconsistent result of %s: expected: true <nil>, actual: %v %v", name, loaded, err)
+		}
+		if element, loaded, err := cm.GetOrPut("FOO", 3); element != 1 || !loaded || err != nil {
+			t.Fatalf("Inconsistent result of %s: expected: 1 true <nil>, actual: %v %v %v", name, element, loaded, err)
+		}
+		if cm.Len() != 1 || cm.Get("fOO") != 1 {
+			t.Fatalf("Inconsistent map of %s: length: %d, element: %v", name, cm.Len(), cm.Get("foo"))
+		}
+		if keys := cm.Keys(); len(keys) != 1 || keys[0] != "foo" {
+			t.Fatalf("Inconsistent keys of %s: expected: %v, actual: %v", name, []string{"foo"}, keys)
+		}
+	}
+}
+
+func TestOptionHashSeed(t *testing.T) {
+	cm1, _ := NewConcurrentMap(1, nil, WithHashSeed(1))
+	cm2, _ := NewConcurrentMap(1, nil, WithHashSeed(2), WithHashAlgorithm(HASH_ALGO_CRC64))
+	cm3, _ := NewConcurrentMap(1, nil, WithRandomSeed())
+	c1, c2 := cm1.(*myConcurrentMap), cm2.(*myConcurrentMap)
+	bucketNumber := uint64(DEFAULT_BUCKET_NUMBER)
+	var moved int
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if c1.opts.hash(key)%bucketNumber != c2.opts.hash(key)%bucketNumber {
+			moved++
+		}
+		for _, cm := range []ConcurrentMap{cm1, cm2, cm3} {
+			cm.Put(key, i)
+		}
+	}
+	if moved == 0 {
+		t.Fatal("Maps with different seeds place all keys into the same buckets!")
+	}
+	if c1.opts.hash("key") != seededHash(1)("key") {
+		t.Fatal("Inconsistent hash for the same seed!")
+	}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		for _, cm := range []ConcurrentMap{cm1, cm2, cm3} {
+			if actual := cm.Get(key); actual != i {
+				t.Fatalf("Inconsistent element: expected: %#v, actual: %#v (key: %s)", i, actual, key)
+			}
+		}
+	}
+
+	// 复用同一个 Option 创建的 map 也使用不同的种子
+	option := WithRandomSeed()
+	cm4, _ := NewConcurrentMap(1, nil, option)
+	cm5, _ := NewConcurrentMap(1, nil, option)
+	if seed4, seed5 := cm4.(*myConcurrentMap).opts.hashSeed, cm5.(*myConcurrentMap).opts.hashSeed; seed4 == seed5 {
+		t.Fatalf("Maps created with the same option share the seed %d!", seed4)
+	}
+}
+
+func TestOptionParallelInit(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	cm, err := NewConcurrentMap(37, nil, WithParallelInit(true), WithBucketNumber(4))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	for i, s := range cm.(*myConcurrentMap).getSegments() {
+		if s == nil || s.(*segment).index != i || s.(*segment).bucketsLen != 4 {
+			t.Fatalf("Segment %d is not initialized correctly!", i)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		cm.Put(fmt.Sprintf("key-%d", i), i)
+	}
+	if cm.Len() != 100 {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", 100, cm.Len())
+	}
+}
+
+func TestOptionMaxEntries(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil, WithMaxEntries(10))
+	for i := 0; i < 10; i++ {
+		if _, err := cm.Put(fmt.Sprintf("key-%d", i), i); err != nil {
+			t.Fatalf("An error occurs when putting a key-element: %s", err)
+		}
+	}
+	if _, err := cm.Put("key-10", 10); err == nil {
+		t.Fatal("Put a new key beyond the capacity!")
+	} else if _, ok := err.(CapacityExceededError); !ok {
+		t.Fatalf("Inconsistent error type: expected: %T, actual: %T", CapacityExceededError{}, err)
+	}
+	if _, _, err := cm.GetOrPut("key-10", 10); err == nil {
+		t.Fatal("GetOrPut a new key beyond the capacity!")
+	}
+	if element, loaded, err := cm.GetOrPut("key-1", 100); err != nil || !loaded || element != 1 {
+		t.Fatalf("Inconsistent GetOrPut result: expected: 1 true <nil>, actual: %v %v %v", element, loaded, err)
+	}
+	if ok, err := cm.Put("key-0", 100); ok || err != nil {
+		t.Fatalf("Couldn't update an existing key at the capacity: %v %v", ok, err)
+	}
+	if cm.Get("key-0") != 100 || cm.Len() != 10 {
+		t.Fatalf("Inconsistent state: element: %v, length: %d", cm.Get("key-0"), cm.Len())
+	}
+	cm.Delete("key-0")
+	if _, err := cm.Put("key-10", 10); err != nil {
+		t.Fatalf("Couldn't put a new key after deleting: %s", err)
+	}
+
+	// 并发放入不会超出上限
+	cm, _ = NewConcurrentMap(4, nil, WithMaxEntries(50))
+	var wg sync.WaitGroup
+	var succeeded int32
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if ok, _ := cm.Put(fmt.Sprintf("key-%d", i), i); ok {
+				atomic.AddInt32(&succeeded, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if succeeded != 50 || cm.Len() != 50 {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d (succeeded: %d)", 50, cm.Len(), succeeded)
+	}
+}
+
+func TestOptionRejectPairElements(t *testing.T) {
+	p, _ := newPair("inner", 1)
+	cm, _ := NewConcurrentMap(2, nil, WithRejectPairElements(true))
+	if _, err := cm.Put("a", p); err == nil {
+		t.Fatal("No error when putting a pair as an element!")
+	} else if _, ok := err.(IllegalParameterError); !ok {
+		t.Fatalf("Inconsistent error type: expected: %T, actual: %T", IllegalParameterError{}, err)
+	}
+	if _, _, err := cm.GetOrPut("a", p); err == nil {
+		t.Fatal("No error when putting a pair as an element with GetOrPut!")
+	}
+	if cm.Len() != 0 {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", 0, cm.Len())
+	}
+	if _, err := cm.Put("a", 1); err != nil {
+		t.Fatalf("An error occurs when putting a normal element: %s", err)
+	}
+
+	cm, _ = NewConcurrentMap(2, nil)
+	if _, err := cm.Put("a", p); err != nil {
+		t.Fatalf("An error occurs when putting a pair without the option: %s", err)
+	}
+}
+
+func TestOptionCollisionObserver(t *testing.T) {
+	type collision struct {
+		key            string
+		bucketIndex    int
+		chainLenBefore int
+	}
+	var collisions []collision
+	// 所有键的散列值都相同，使每个新键都与之前的键碰撞
+	cm, _ := NewConcurrentMap(1, nil, WithHash(func(key string) uint64 { return 3 }),
+		WithCollisionObserver(func(key string, bucketIndex int, chainLenBefore int) {
+			collisions = append(collisions, collision{key, bucketIndex, chainLenBefore})
+		}))
+	number := 50
+	for i := 0; i < number; i++ {
+		cm.Put(fmt.Sprintf("key-%d", i), i)
+	}
+	// 替换已有键的元素不算碰撞
+	cm.Put("key-0", 100)
+	if len(collisions) != number-1 {
+		t.Fatalf("Inconsistent collision count: expected: %d, actual: %d", number-1, len(collisions))
+	}
+	for i, c := range collisions {
+		if c.key != fmt.Sprintf("key-%d", i+1) || c.chainLenBefore != i+1 {
+			t.Fatalf("Inconsistent collision: expected: key-%d with chain length %d, actual: %+v", i+1, i+1, c)
+		}
+	}
+	_, index, _ := cm.(*myConcurrentMap).getSegments()[0].LocateBucketWithHash(3)
+	if last := collisions[len(collisions)-1]; last.bucketIndex != index {
+		t.Fatalf("Inconsistent bucket of the last collision: expected: %d, actual: %d", index, last.bucketIndex)
+	}
+
+	// 散列值各不相同的键不会发生碰撞
+	collisions = nil
+	cm, _ = NewConcurrentMap(1, nil, WithBucketNumber(64), WithHash(func(key string) uint64 { return uint64(len(key)) }),
+		WithCollisionObserver(func(key string, bucketIndex int, chainLenBefore int) {
+			collisions = append(collisions, collision{key, bucketIndex, chainLenBefore})
+		}))
+	for i := 1; i <= 10; i++ {
+		cm.Put(strings.Repeat("k", i), i)
+	}
+	if len(collisions) != 0 {
+		t.Fatalf("Inconsistent collisions of distinct hashes: %+v", collisions)
+	}
+}
+
+func TestOptionMaxConcurrency(t *testing.T) {
+	assertLimitError := func(err error, requested, limit int) {
+		if err == nil {
+			t.Fatalf("No error when the concurrency %d exceeds the limit %d!", requested, limit)
+		}
+		cle, ok := err.(ConcurrencyLimitError)
+		if !ok {
+			t.Fatalf("Inconsistent error type: expected: %T, actual: %T", ConcurrencyLimitError{}, err)
+		}
+		if cle.Requested != requested || cle.Limit != limit {
+			t.Fatalf("Inconsistent error fields: expected: %d/%d, actual: %d/%d",
+				requested, limit, cle.Requested, cle.Limit)
+		}
+	}
+	_, err := NewConcurrentMap(MAX_CONCURRENCY+1, nil)
+	assertLimitError(err, MAX_CONCURRENCY+1, MAX_CONCURRENCY)
+
+	_, err = NewConcurrentMap(9, nil, WithMaxConcurrency(8))
+	assertLimitError(err, 9, 8)
+	// 按错误中的上限重试
+	cm, err := NewConcurrentMap(err.(ConcurrencyLimitError).Limit, nil, WithMaxConcurrency(8))
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map at the limit: %s", err)
+	}
+	assertLimitError(cm.Resize(16), 16, 8)
+	if err := cm.Resize(4); err != nil {
+		t.Fatalf("An error occurs when resizing the map: %s", err)
+	}
+
+	// 不合法的上限使用 MAX_CONCURRENCY
+	for _, n := range []int{0, MAX_CONCURRENCY + 1} {
+		if _, err := NewConcurrentMap(MAX_CONCURRENCY, nil, WithMaxConcurrency(n)); err != nil {
+			t.Fatalf("An error occurs when new a concurrent map: %s (max concurrency: %d)", err, n)
+		}
+	}
+}
+
+func TestOptionMaxLookupDepth(t *testing.T) {
+	maxDepth, number := 10, 100
+	// 所有键都落入同一个散列桶
+	constantHash := WithHash(func(key string) uint64 { return 0 })
+	cm, _ := NewConcurrentMap(1, nil, constantHash, WithMaxLookupDepth(maxDepth))
+	unbounded, _ := NewConcurrentMap(1, nil, constantHash)
+	for i := 0; i < number; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		cm.Put(key, i)
+		unbounded.Put(key, i)
+	}
+	// 再分布可能改变链表中的顺序，因此按实际的链表计算每个键的深度
+	depths := make(map[string]int)
+	b := cm.(*myConcurrentMap).getSegments()[0].GetBucketWithHash(0)
+	for v, n := b.GetFirstPair(), 0; v != nil; v, n = v.Next(), n+1 {
+		depths[v.Key()] = n
+	}
+	if len(depths) != number {
+		t.Fatalf("Inconsistent chain length: expected: %d, actual: %d", number, len(depths))
+	}
+	for key, depth := range depths {
+		element, err := cm.GetWithError(key)
+		if depth < maxDepth {
+			if element == nil || err != nil {
+				t.Fatalf("Couldn't get key %s at depth %d: %v", key, depth, err)
+			}
+			continue
+		}
+		if element != nil || cm.Get(key) != nil {
+			t.Fatalf("Got key %s beyond the max lookup depth %d: %v", key, depth, element)
+		}
+		if _, ok := err.(ChainTooDeepError); !ok {
+			t.Fatalf("Inconsistent error type: expected: %T, actual: %T", ChainTooDeepError{}, err)
+		}
+		if unbounded.Get(key) == nil {
+			t.Fatalf("Couldn't get key %s without the max lookup depth!", key)
+		}
+	}
+	if _, err := cm.GetWithError("missing"); err == nil {
+		t.Fatal("No error when looking up a missing key in a deep chain!")
+	}
+
+	// 链表不超过上限时，不存在的键不会返回错误
+	cm, _ = NewConcurrentMap(1, nil, WithMaxLookupDepth(maxDepth))
+	cm.Put("a", 1)
+	if element, err := cm.GetWithError("missing"); element != nil || err != nil {
+		t.Fatalf("Inconsistent result of a missing key: expected: <nil> <nil>, actual: %v %v", element, err)
+	}
+}
@@ -0,0 +1,134 @@
+package cmap
+
+import (
+	"container/list"
+	"sync"
+)
+
+// insertionOrder 代表以双向链表记录的键的插入顺序
+// 它有自己的互斥锁，所有方法都是并发安全的
+type insertionOrder struct {
+	keys     *list.List
+	elements map[string]*list.Element
+	lock     sync.Mutex
+}
+
+// append 用于将键追加到末尾，已存在的键保持原来的位置
+func (ord *insertionOrder) append(key string) {
+	ord.lock.Lock()
+	defer ord.lock.Unlock()
+	if _, ok := ord.elements[key]; ok {
+		return
+	}
+	ord.elements[key] = ord.keys.PushBack(key)
+}
+
+// remove 用于移除一个键
+func (ord *insertionOrder) remove(key string) {
+	ord.lock.Lock()
+	defer ord.lock.Unlock()
+	if e, ok := ord.elements[key]; ok {
+		ord.keys.Remove(e)
+		delete(ord.elements, key)
+	}
+}
+
+// snapshot 用于按插入顺序返回当前所有键的副本
+func (ord *insertionOrder) snapshot() []string {
+	ord.lock.Lock()
+	defer ord.lock.Unlock()
+	keys := make([]string, 0, ord.keys.Len())
+	for e := ord.keys.Front(); e != nil; e = e.Next() {
+		keys = append(keys, e.Value.(string))
+	}
+	return keys
+}
+
+// neighbor 用于返回插入顺序中 key 之后（back 为 true 时为之前）的键
+// started 为 false 或 key 已被移除时，从头部（back 为 true 时从尾部）开始
+func (ord *insertionOrder) neighbor(key string, started bool, back bool) (string, bool) {
+	ord.lock.Lock()
+	defer ord.lock.Unlock()
+	var e *list.Element
+	if current, ok := ord.elements[key]; started && ok {
+		if back {
+			e = current.Prev()
+		} else {
+			e = current.Next()
+		}
+	} else if back {
+		e = ord.keys.Back()
+	} else {
+		e = ord.keys.Front()
+	}
+	if e == nil {
+		return "", false
+	}
+	return e.Value.(string), true
+}
+
+func newInsertionOrder() *insertionOrder {
+	return &insertionOrder{
+		keys:     list.New(),
+		elements: make(map[string]*list.Element),
+	}
+}
+
+// RangeInOrder 先复制一份插入顺序，再逐个读取键值对并调用 f，调用期间不持有任何锁
+// 遍历期间新增的键不会被访问，已被删除的键会被跳过
+func (c *myConcurrentMap) RangeInOrder(f func(key string, element interface{}) bool) {
+	if c.opts.insertionOrder == nil {
+		return
+	}
+	for _, key := range c.opts.insertionOrder.snapshot() {
+		keyHash := c.opts.hash(key)
+		p := c.findSegment(keyHash).GetWithHash(key, keyHash)
+		if p == nil {
+			continue
+		}
+		element, err := c.decodeElement(p.Element())
+		if err != nil {
+			continue
+		}
+		goOn := true
+		if !c.opts.invokeCallback(func() {
+			goOn = f(key, element)
+		}) || !goOn {
+			return
+		}
+	}
+}
+
+func (c *myConcurrentMap) Oldest() (string, interface{}, bool) {
+	return c.endOfOrder(false)
+}
+
+func (c *myConcurrentMap) Newest() (string, interface{}, bool) {
+	return c.endOfOrder(true)
+}
+
+// endOfOrder 用于返回插入顺序的头部（back 为 true 时为尾部）且仍然存在的键值对
+// 插入顺序在散列段的锁的保护下更新，而读取键值对时不持有插入顺序的锁，
+// 因此读到的键可能刚被删除，此时沿插入顺序前进到下一个键，该键也已被移出时从头部重新开始
+func (c *myConcurrentMap) endOfOrder(back bool) (string, interface{}, bool) {
+	if c.opts.insertionOrder == nil {
+		return "", nil, false
+	}
+	var key string
+	var started bool
+	for {
+		next, ok := c.opts.insertionOrder.neighbor(key, started, back)
+		if !ok {
+			return "", nil, false
+		}
+		key, started = next, true
+		keyHash := c.opts.hash(key)
+		p := c.findSegment(keyHash).GetWithHash(key, keyHash)
+		if p == nil {
+			continue
+		}
+		if element, err := c.decodeElement(p.Element()); err == nil {
+			return key, element, true
+		}
+	}
+}
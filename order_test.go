@@ -0,0 +1,115 @@
+package cmap
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestCmapRangeInOrder(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil, WithInsertionOrder(true))
+	var expected []string
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("key-%d", 49-i)
+		cm.Put(key, i)
+		expected = append(expected, key)
+	}
+	// 替换已有键的元素不改变其顺序
+	cm.Put("key-49", 100)
+	// 删除后再放入的键排在末尾
+	cm.Delete("key-30")
+	cm.Put("key-30", 200)
+	cm.Delete("key-10")
+	var ordered []string
+	for _, key := range expected {
+		if key != "key-30" && key != "key-10" {
+			ordered = append(ordered, key)
+		}
+	}
+	ordered = append(ordered, "key-30")
+
+	var actual []string
+	cm.RangeInOrder(func(key string, element interface{}) bool {
+		actual = append(actual, key)
+		return true
+	})
+	if !reflect.DeepEqual(actual, ordered) {
+		t.Fatalf("Inconsistent order: expected: %v, actual: %v", ordered, actual)
+	}
+	if err := cm.Resize(2); err != nil {
+		t.Fatalf("An error occurs when resizing the map: %s", err)
+	}
+	actual = actual[:0]
+	cm.RangeInOrder(func(key string, element interface{}) bool {
+		actual = append(actual, key)
+		return len(actual) < 3
+	})
+	if !reflect.DeepEqual(actual, ordered[:3]) {
+		t.Fatalf("Inconsistent order after resizing: expected: %v, actual: %v", ordered[:3], actual)
+	}
+
+	cm, _ = NewConcurrentMap(4, nil)
+	cm.Put("a", 1)
+	cm.RangeInOrder(func(key string, element interface{}) bool {
+		t.Fatal("f is called without insertion order!")
+		return true
+	})
+}
+
+func TestCmapOldestNewest(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	if _, _, ok := cm.Oldest(); ok {
+		t.Fatal("Found the oldest entry without insertion order!")
+	}
+	cm, _ = NewConcurrentMap(4, nil, WithInsertionOrder(true))
+	if _, _, ok := cm.Newest(); ok {
+		t.Fatal("Found the newest entry in an empty map!")
+	}
+	check := func(oldestKey string, oldestElement interface{}, newestKey string, newestElement interface{}) {
+		if key, element, ok := cm.Oldest(); !ok || key != oldestKey || element != oldestElement {
+			t.Fatalf("Inconsistent oldest entry: expected: %s=%v, actual: %s=%v (ok: %v)",
+				oldestKey, oldestElement, key, element, ok)
+		}
+		if key, element, ok := cm.Newest(); !ok || key != newestKey || element != newestElement {
+			t.Fatalf("Inconsistent newest entry: expected: %s=%v, actual: %s=%v (ok: %v)",
+				newestKey, newestElement, key, element, ok)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		cm.Put(fmt.Sprintf("key-%d", i), i)
+	}
+	check("key-0", 0, "key-9", 9)
+	// 替换元素不改变顺序
+	cm.Put("key-0", 100)
+	check("key-0", 100, "key-9", 9)
+	// 删除最早和最晚的键后前进到下一个键
+	cm.Delete("key-0")
+	cm.Delete("key-9")
+	check("key-1", 1, "key-8", 8)
+	// 删除后再放入的键成为最晚的键
+	cm.Delete("key-1")
+	cm.Put("key-1", 1)
+	check("key-2", 2, "key-1", 1)
+	// 插入顺序中已被删除但尚未移出的键会被跳过
+	cm.(*myConcurrentMap).opts.insertionOrder.append("ghost")
+	check("key-2", 2, "key-1", 1)
+	cm.(*myConcurrentMap).opts.insertionOrder.remove("ghost")
+
+	// 当作先进先出的队列使用
+	var popped []string
+	for {
+		key, _, ok := cm.Oldest()
+		if !ok {
+			break
+		}
+		cm.Delete(key)
+		popped = append(popped, key)
+	}
+	expected := []string{"key-2", "key-3", "key-4", "key-5", "key-6", "key-7", "key-8", "key-1"}
+	if !reflect.DeepEqual(popped, expected) {
+		t.Fatalf("Inconsistent popped keys: expected: %v, actual: %v", expected, popped)
+	}
+	if _, _, ok := cm.Newest(); ok || cm.Len() != 0 {
+		t.Fatalf("Inconsistent map after popping all keys: length: %d", cm.Len())
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"sync/atomic"
+	"time"
+	"unicode/utf8"
 	"unsafe"
 )
 
@@ -27,18 +29,54 @@ type Pair interface {
 	Element() interface{}
 	// 设置元素的值
 	SetElement(element interface{}) error
+	// 以当前元素和 incoming 调用 merge，并把元素设置为其返回值，成功时同样使版本号加一
+	// merge 返回 nil 时不修改元素并返回 IllegalParameterError
+	MergeElement(incoming interface{}, merge func(existing, incoming interface{}) interface{}) error
+	// 返回元素的版本号
+	// 每次成功调用 SetElement 都会使版本号加一
+	Version() uint64
+	// 返回键值对被访问的次数
+	AccessCount() uint64
+	// 将访问次数加一并返回新值
+	IncrAccessCount() uint64
+	// 返回最近一次被标记为使用的时间（Unix 纳秒），0 表示从未标记
+	Touched() int64
+	// 将最近使用时间标记为当前时间
+	Touch()
+	// 返回放入元素时记录的校验和
+	Checksum() uint64
+	// 设置元素的校验和
+	SetChecksum(checksum uint64)
+	// 返回过期时间（Unix 纳秒），0 表示永不过期
+	Expiry() int64
+	// 设置过期时间，0 表示永不过期
+	SetExpiry(expiry int64)
 	// 生成一个当前键值对的副本并返回
 	Copy() Pair
 	// 返回当前键-元素对的字符串表示形式
 	String() string
 }
 
+// emptyElement 代表已被 TakeElement 取走的元素
+// 由于键值对中不能存放 nil，使用它来表示键存在但没有元素
+type emptyElement struct{}
+
 type pair struct {
 	key  string
 	hash uint64
 	// 使用 unsafe.Pointer 便于后面使用原子操作
 	element unsafe.Pointer
 	next    unsafe.Pointer
+	// 元素的版本号
+	version uint64
+	// 被访问的次数
+	accessCount uint64
+	// 最近一次被标记为使用的时间
+	touched int64
+	// 过期时间
+	expiry int64
+	// 元素的校验和
+	checksum uint64
 }
 
 func (p *pair) Key() string {
@@ -62,9 +100,69 @@ func (p *pair) SetElement(element interface{}) error {
 		return newIllegalParameterError("element is nil")
 	}
 	atomic.StorePointer(&p.element, unsafe.Pointer(&element))
+	atomic.AddUint64(&p.version, 1)
 	return nil
 }
 
+// MergeElement 不加锁，以比较并交换的方式设置元素
+// 若 merge 执行期间元素被其他 goroutine 修改，则以新的元素重新调用 merge，因此 merge 不应有副作用
+func (p *pair) MergeElement(incoming interface{}, merge func(existing, incoming interface{}) interface{}) error {
+	if merge == nil {
+		return newIllegalParameterError("merge function is nil")
+	}
+	for {
+		current := atomic.LoadPointer(&p.element)
+		var existing interface{}
+		if current != nil {
+			existing = *(*interface{})(current)
+		}
+		merged := merge(existing, incoming)
+		if merged == nil {
+			return newIllegalParameterError("merged element is nil")
+		}
+		if atomic.CompareAndSwapPointer(&p.element, current, unsafe.Pointer(&merged)) {
+			atomic.AddUint64(&p.version, 1)
+			return nil
+		}
+	}
+}
+
+func (p *pair) Version() uint64 {
+	return atomic.LoadUint64(&p.version)
+}
+
+func (p *pair) AccessCount() uint64 {
+	return atomic.LoadUint64(&p.accessCount)
+}
+
+func (p *pair) IncrAccessCount() uint64 {
+	return atomic.AddUint64(&p.accessCount, 1)
+}
+
+func (p *pair) Touched() int64 {
+	return atomic.LoadInt64(&p.touched)
+}
+
+func (p *pair) Touch() {
+	atomic.StoreInt64(&p.touched, time.Now().UnixNano())
+}
+
+func (p *pair) Checksum() uint64 {
+	return atomic.LoadUint64(&p.checksum)
+}
+
+func (p *pair) SetChecksum(checksum uint64) {
+	atomic.StoreUint64(&p.checksum, checksum)
+}
+
+func (p *pair) Expiry() int64 {
+	return atomic.LoadInt64(&p.expiry)
+}
+
+func (p *pair) SetExpiry(expiry int64) {
+	atomic.StoreInt64(&p.expiry, expiry)
+}
+
 func (p *pair) Next() Pair {
 	pointer := atomic.LoadPointer(&p.next)
 	if pointer == nil {
@@ -87,8 +185,16 @@ func (p *pair) SetNext(nextPair Pair) error {
 }
 
 // Copy 会生成一个当前键-元素对的副本并返回。
+// 副本会保留当前的散列值、版本号、访问次数和最近使用时间。
 func (p *pair) Copy() Pair {
-	pCopy, _ := newPair(p.Key(), p.Element())
+	pCopy, _ := newPairWithHash(p.Key(), p.Hash(), p.Element())
+	if pp, ok := pCopy.(*pair); ok {
+		pp.version = p.Version()
+		pp.accessCount = p.AccessCount()
+		pp.touched = p.Touched()
+		pp.expiry = p.Expiry()
+		pp.checksum = p.Checksum()
+	}
 	return pCopy
 }
 
@@ -96,6 +202,29 @@ func (p *pair) String() string {
 	return p.genString(false)
 }
 
+// maxElementStringLength 代表字符串形式中元素部分的最大字节数，以原子操作访问
+var maxElementStringLength = int64(DEFAULT_MAX_ELEMENT_STRING_LENGTH)
+
+// SetMaxElementStringLength 用于设置键值对和散列桶的字符串形式中元素部分的最大字节数，
+// 超出的部分会被省略并以 "..." 结尾，n 小于等于 0 表示不限制
+// 该设置对整个包生效，默认为 DEFAULT_MAX_ELEMENT_STRING_LENGTH
+func SetMaxElementStringLength(n int) {
+	atomic.StoreInt64(&maxElementStringLength, int64(n))
+}
+
+// truncateElementString 用于按 maxElementStringLength 截断元素的字符串形式
+// 截断位置会退回到 UTF-8 字符的边界，避免产生不完整的字符
+func truncateElementString(s string) string {
+	max := int(atomic.LoadInt64(&maxElementStringLength))
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max] + "..."
+}
+
 // genString 用于生成并返回当前键-元素对的字符串形式。
 func (p *pair) genString(nextDetail bool) string {
 	var buf bytes.Buffer
@@ -104,7 +233,7 @@ func (p *pair) genString(nextDetail bool) string {
 	buf.WriteString(", hash:")
 	buf.WriteString(fmt.Sprintf("%d", p.Hash()))
 	buf.WriteString(", element:")
-	buf.WriteString(fmt.Sprintf("%+v", p.Element()))
+	buf.WriteString(truncateElementString(fmt.Sprintf("%+v", p.Element())))
 	if nextDetail {
 		buf.WriteString(", next:")
 		if next := p.Next(); next != nil {
@@ -125,9 +254,15 @@ func (p *pair) genString(nextDetail bool) string {
 }
 
 func newPair(key string, element interface{}) (Pair, error) {
+	return newPairWithHash(key, hash(key), element)
+}
+
+// newPairWithHash 会使用给定的散列值创建键值对
+// 注意！参数 keyHash 必须是使用所属 map 的散列函数基于 key 计算出的
+func newPairWithHash(key string, keyHash uint64, element interface{}) (Pair, error) {
 	p := &pair{
 		key:  key,
-		hash: hash(key),
+		hash: keyHash,
 	}
 	if element == nil {
 		return nil, newIllegalParameterError("element is nil")
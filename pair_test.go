@@ -6,6 +6,8 @@ import (
 	"encoding/hex"
 	"fmt"
 	"math/rand"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -163,3 +165,91 @@ func TestPairCopy(t *testing.T) {
 		})
 	}
 }
+
+func TestPairVersion(t *testing.T) {
+	p, _ := newPair(randString(), randElement())
+	if p.Version() != 0 {
+		t.Fatalf("Inconsistent version: expected: %d, actual: %d", 0, p.Version())
+	}
+	for i := uint64(1); i <= 10; i++ {
+		p.SetElement(randElement())
+		if p.Version() != i {
+			t.Fatalf("Inconsistent version: expected: %d, actual: %d", i, p.Version())
+		}
+	}
+	p.SetElement(nil)
+	if p.Version() != 10 {
+		t.Fatalf("Version changed after a failing set: expected: %d, actual: %d", 10, p.Version())
+	}
+	if pCopy := p.Copy(); pCopy.Version() != p.Version() {
+		t.Fatalf("Inconsistent version of copy: expected: %d, actual: %d", p.Version(), pCopy.Version())
+	}
+}
+
+func TestPairMergeElement(t *testing.T) {
+	p, _ := newPair(randString(), 0)
+	sum := func(existing, incoming interface{}) interface{} {
+		return existing.(int) + incoming.(int)
+	}
+	// 不加锁地并发合并也不会丢失修改
+	var wg sync.WaitGroup
+	number := 100
+	for i := 0; i < number; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p.MergeElement(1, sum); err != nil {
+				t.Errorf("An error occurs when merging the element: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if p.Element() != number {
+		t.Fatalf("Inconsistent element: expected: %v, actual: %v", number, p.Element())
+	}
+	if p.Version() != uint64(number) {
+		t.Fatalf("Inconsistent version: expected: %d, actual: %d", number, p.Version())
+	}
+	err := p.MergeElement(1, func(existing, incoming interface{}) interface{} {
+		return nil
+	})
+	if _, ok := err.(IllegalParameterError); !ok {
+		t.Fatalf("Inconsistent error type: expected: %T, actual: %T", IllegalParameterError{}, err)
+	}
+	if p.Element() != number || p.Version() != uint64(number) {
+		t.Fatalf("The element is changed by a failing merge: %v (version: %d)", p.Element(), p.Version())
+	}
+}
+
+func TestPairStringTruncation(t *testing.T) {
+	large := strings.Repeat("x", DEFAULT_MAX_ELEMENT_STRING_LENGTH*4)
+	p, _ := newPair("large", large)
+	expected := "element:" + large[:DEFAULT_MAX_ELEMENT_STRING_LENGTH] + "..., "
+	if s := p.String(); !strings.Contains(s, expected) || strings.Contains(s, large) {
+		t.Fatalf("Inconsistent truncation: expected: %d bytes with ellipsis, actual: %d bytes",
+			DEFAULT_MAX_ELEMENT_STRING_LENGTH, len(s))
+	}
+	b := newBucket()
+	b.Put(p, nil)
+	if s := b.String(); !strings.Contains(s, expected) || strings.Contains(s, large) {
+		t.Fatalf("Inconsistent truncation of bucket: expected: %d bytes with ellipsis, actual: %d bytes",
+			DEFAULT_MAX_ELEMENT_STRING_LENGTH, len(s))
+	}
+
+	small, _ := newPair("small", "tiny element")
+	if s := small.String(); !strings.Contains(s, "element:tiny element, ") {
+		t.Fatalf("Inconsistent string: expected: %q in it, actual: %s", "element:tiny element, ", s)
+	}
+
+	defer SetMaxElementStringLength(DEFAULT_MAX_ELEMENT_STRING_LENGTH)
+	SetMaxElementStringLength(5)
+	// 截断位置不能落在多字节字符的中间
+	multibyte, _ := newPair("utf8", "ab中文")
+	if s := multibyte.String(); !strings.Contains(s, "element:ab中...") {
+		t.Fatalf("Inconsistent string: expected: %q in it, actual: %s", "element:ab中...", s)
+	}
+	SetMaxElementStringLength(0)
+	if s := p.String(); !strings.Contains(s, large) {
+		t.Fatalf("Element is truncated without a limit: %d bytes", len(s))
+	}
+}
@@ -1,6 +1,9 @@
 package cmap
 
-import "sync/atomic"
+import (
+	"math/bits"
+	"sync/atomic"
+)
 
 // BucketStatus 代表散列桶状态的类型。
 type BucketStatus uint8
@@ -16,12 +19,15 @@ const (
 
 // PairRedistributor 代表针对键-元素对的再分布器。
 // 用于当散列段内的键-元素对分布不均时进行重新分布。
+// 传给 NewConcurrentMap 的再分布器被所有散列段共用，各散列段只持有自己的锁调用它，
+// 因此它必须是并发安全的，且一个散列段两次调用之间可能穿插着其他散列段的调用。
 type PairRedistributor interface {
 	//  UpdateThreshold 会根据键-元素对总数和散列桶总数计算并更新阈值。
 	UpdateThreshold(pairTotal uint64, bucketNumber int)
 	// CheckBucketStatus 用于检查散列桶的状态。
 	CheckBucketStatus(pairTotal uint64, bucketSize uint64) (bucketStatus BucketStatus)
 	// Redistribe 用于实施键-元素对的再分布。
+	// 新的散列桶中放入的应是键-元素对的副本，以免修改旧链表中键-元素对的 next。
 	Redistribe(bucketStatus BucketStatus, buckets []Bucket) (newBuckets []Bucket, changed bool)
 }
 
@@ -36,6 +42,10 @@ type myPairRedistributor struct {
 	overweightBucketCount uint64
 	// emptyBucketCount 代表空的散列桶的计数。
 	emptyBucketCount uint64
+	// bucketNumber 代表最近一次更新阈值时的散列桶数量。
+	bucketNumber uint64
+	// minBucketNumber 代表收缩时散列桶数量的下限，即初始的散列桶数量。
+	minBucketNumber uint64
 }
 
 // bucketCountTemplate 代表调试用散列桶状态信息模板。
@@ -62,6 +72,7 @@ func (pr *myPairRedistributor) UpdateThreshold(pairTotal uint64, bucketNumber in
 	// 		atomic.LoadUint64(&pr.emptyBucketCount))
 	// }()
 	atomic.StoreUint64(&pr.upperThreshold, uint64(average*pr.loadFactor))
+	atomic.StoreUint64(&pr.bucketNumber, uint64(bucketNumber))
 }
 
 // bucketStatusTemplate 代表调试用散列桶状态信息模板。
@@ -94,9 +105,23 @@ func (pr *myPairRedistributor) CheckBucketStatus(pairTotal uint64, bucketSize ui
 	if bucketSize == 0 {
 		atomic.AddUint64(&pr.emptyBucketCount, 1)
 	}
+	// 键值对总数不足上阈限与散列桶数量之积的四分之一时收缩，
+	// 与扩容的条件之间留有余地，避免在阈值附近反复扩容和收缩
+	bucketNumber := atomic.LoadUint64(&pr.bucketNumber)
+	if bucketNumber > atomic.LoadUint64(&pr.minBucketNumber) &&
+		lessProduct(pairTotal, 4, atomic.LoadUint64(&pr.upperThreshold), bucketNumber) {
+		bucketStatus = BUCKET_STATUS_UNDERWEIGHT
+	}
 	return
 }
 
+// lessProduct 用于判断 a*b 是否小于 c*d，以 128 位计算乘积，因此不会溢出
+func lessProduct(a, b, c, d uint64) bool {
+	hi1, lo1 := bits.Mul64(a, b)
+	hi2, lo2 := bits.Mul64(c, d)
+	return hi1 < hi2 || (hi1 == hi2 && lo1 < lo2)
+}
+
 // redistributionTemplate 代表重新分配信息模板。
 var redistributionTemplate = `Redistributing: 
     bucketStatus: %d
@@ -104,10 +129,18 @@ var redistributionTemplate = `Redistributing:
     newNumber: %d
 `
 
-func (pr *myPairRedistributor) Redistribe(
-	bucketStatus BucketStatus, buckets []Bucket) (newBuckets []Bucket, changed bool) {
-	currentNumber := uint64(len(buckets))
-	newNumber := currentNumber
+// redistributionPlanner 代表能够只计算再分布后的散列桶数量的再分布器。
+// 后台再散列依赖它来决定目标数量，再由散列段自己逐步迁移键-元素对。
+type redistributionPlanner interface {
+	// planRedistribution 会根据散列桶状态计算再分布后的散列桶数量。
+	// 第二个返回值为 false 表示不需要再分布。
+	planRedistribution(bucketStatus BucketStatus, currentNumber uint64) (newNumber uint64, changed bool)
+}
+
+// planRedistribution 在决定再分布时会重置计数，与 Redistribe 完成再分布后的状态一致。
+func (pr *myPairRedistributor) planRedistribution(
+	bucketStatus BucketStatus, currentNumber uint64) (newNumber uint64, changed bool) {
+	newNumber = currentNumber
 	// defer func() {
 	// 	fmt.Printf(redistributionTemplate,
 	// 		bucketStatus,
@@ -117,54 +150,56 @@ func (pr *myPairRedistributor) Redistribe(
 	switch bucketStatus {
 	case BUCKET_STATUS_OVERWEIGHT:
 		if atomic.LoadUint64(&pr.overweightBucketCount)*4 < currentNumber {
-			return nil, false
+			return currentNumber, false
 		}
 		newNumber = currentNumber << 1
 	case BUCKET_STATUS_UNDERWEIGHT:
-		if currentNumber < 100 ||
-			atomic.LoadUint64(&pr.emptyBucketCount)*4 < currentNumber {
-			return nil, false
+		minBucketNumber := atomic.LoadUint64(&pr.minBucketNumber)
+		if currentNumber <= minBucketNumber {
+			return currentNumber, false
 		}
 		newNumber = currentNumber >> 1
+		if newNumber < minBucketNumber {
+			newNumber = minBucketNumber
+		}
 		if newNumber < 2 {
 			newNumber = 2
 		}
 	default:
-		return nil, false
+		return currentNumber, false
 	}
-	if newNumber == currentNumber {
-		atomic.StoreUint64(&pr.overweightBucketCount, 0)
-		atomic.StoreUint64(&pr.emptyBucketCount, 0)
+	atomic.StoreUint64(&pr.overweightBucketCount, 0)
+	atomic.StoreUint64(&pr.emptyBucketCount, 0)
+	return newNumber, newNumber != currentNumber
+}
+
+func (pr *myPairRedistributor) Redistribe(
+	bucketStatus BucketStatus, buckets []Bucket) (newBuckets []Bucket, changed bool) {
+	currentNumber := uint64(len(buckets))
+	newNumber, changed := pr.planRedistribution(bucketStatus, currentNumber)
+	if !changed {
 		return nil, false
 	}
 	var pairs []Pair
 	for _, b := range buckets {
-		for e := b.GetFirstPair(); e != nil; e = e.Next() {
+		for e, n := b.GetFirstPair(), 0; e != nil && n < MAX_CHAIN_LENGTH; e, n = e.Next(), n+1 {
 			pairs = append(pairs, e)
 		}
 	}
-	if newNumber > currentNumber {
-		for i := uint64(0); i < currentNumber; i++ {
-			buckets[i].Clear(nil)
-		}
-		for j := newNumber - currentNumber; j > 0; j-- {
-			buckets = append(buckets, newBucket())
-		}
-	} else {
-		buckets = make([]Bucket, newNumber)
-		for i := uint64(0); i < newNumber; i++ {
-			buckets[i] = newBucket()
-		}
+	// 扩容和收缩都放入新的散列桶，旧散列桶保持不变，
+	// 因此不加锁的读操作和遍历仍能完整地访问旧链表
+	oldBuckets := buckets
+	buckets = make([]Bucket, newNumber)
+	for i := uint64(0); i < newNumber; i++ {
+		buckets[i] = newBucketLike(oldBuckets)
 	}
-	var count int
+	// 放入的是键值对的副本：原键值对的 next 仍指向旧的链表，
+	// 直接放入会把旧链表接到新的散列桶中，使已删除的键重新出现，
+	// 而修改原键值对的 next 又会使不加锁的读操作在遍历旧链表时跳到新链表中。
+	// 副本保留了版本号，持有原键值对的调用方应按键和版本号重新查找
 	for _, p := range pairs {
-		index := int(p.Hash() % newNumber)
-		b := buckets[index]
-		b.Put(p, nil)
-		count++
+		buckets[int(p.Hash()%newNumber)].Put(p.Copy(), nil)
 	}
-	atomic.StoreUint64(&pr.overweightBucketCount, 0)
-	atomic.StoreUint64(&pr.emptyBucketCount, 0)
 	return buckets, true
 }
 
@@ -177,6 +212,7 @@ func newDefaultPairRedistributor(loadFactor float64, bucketNumber int) PairRedis
 	}
 	pr := &myPairRedistributor{}
 	pr.loadFactor = loadFactor
+	pr.minBucketNumber = uint64(bucketNumber)
 	pr.UpdateThreshold(0, bucketNumber)
 	return pr
 }
@@ -0,0 +1,94 @@
+package cmap
+
+import "sync"
+
+// prefixIndex 代表以前缀树实现的键的二级索引
+// 用于在按前缀查询时避免遍历所有散列段
+// 它有自己的读写锁，所有方法都是并发安全的
+type prefixIndex struct {
+	root *prefixNode
+	lock sync.RWMutex
+}
+
+// prefixNode 代表前缀树中的节点
+type prefixNode struct {
+	children map[byte]*prefixNode
+	// 表示是否有键在当前节点结束
+	end bool
+}
+
+// insert 用于向索引中添加一个键
+func (pi *prefixIndex) insert(key string) {
+	pi.lock.Lock()
+	defer pi.lock.Unlock()
+	node := pi.root
+	for i := 0; i < len(key); i++ {
+		child, ok := node.children[key[i]]
+		if !ok {
+			child = &prefixNode{}
+			if node.children == nil {
+				node.children = make(map[byte]*prefixNode)
+			}
+			node.children[key[i]] = child
+		}
+		node = child
+	}
+	node.end = true
+}
+
+// remove 用于从索引中删除一个键，并清理不再需要的节点
+func (pi *prefixIndex) remove(key string) {
+	pi.lock.Lock()
+	defer pi.lock.Unlock()
+	path := make([]*prefixNode, 0, len(key)+1)
+	node := pi.root
+	for i := 0; i < len(key); i++ {
+		path = append(path, node)
+		child, ok := node.children[key[i]]
+		if !ok {
+			return
+		}
+		node = child
+	}
+	node.end = false
+	for i := len(key) - 1; i >= 0; i-- {
+		if node.end || len(node.children) > 0 {
+			break
+		}
+		delete(path[i].children, key[i])
+		node = path[i]
+	}
+}
+
+// keysWithPrefix 用于返回索引中所有以 prefix 开头的键
+func (pi *prefixIndex) keysWithPrefix(prefix string) []string {
+	pi.lock.RLock()
+	defer pi.lock.RUnlock()
+	node := pi.root
+	for i := 0; i < len(prefix); i++ {
+		child, ok := node.children[prefix[i]]
+		if !ok {
+			return nil
+		}
+		node = child
+	}
+	var keys []string
+	buf := []byte(prefix)
+	var walk func(n *prefixNode)
+	walk = func(n *prefixNode) {
+		if n.end {
+			keys = append(keys, string(buf))
+		}
+		for c, child := range n.children {
+			buf = append(buf, c)
+			walk(child)
+			buf = buf[:len(buf)-1]
+		}
+	}
+	walk(node)
+	return keys
+}
+
+func newPrefixIndex() *prefixIndex {
+	return &prefixIndex{root: &prefixNode{}}
+}
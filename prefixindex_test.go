@@ -0,0 +1,117 @@
+package cmap
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestPrefixIndexInsertAndRemove(t *testing.T) {
+	pi := newPrefixIndex()
+	keys := []string{"", "a", "ab", "abc", "abd", "b", "ba"}
+	for _, key := range keys {
+		pi.insert(key)
+	}
+	actual := pi.keysWithPrefix("ab")
+	sort.Strings(actual)
+	expected := []string{"ab", "abc", "abd"}
+	if fmt.Sprint(actual) != fmt.Sprint(expected) {
+		t.Fatalf("Inconsistent keys: expected: %v, actual: %v", expected, actual)
+	}
+	if n := len(pi.keysWithPrefix("")); n != len(keys) {
+		t.Fatalf("Inconsistent key count: expected: %d, actual: %d", len(keys), n)
+	}
+	pi.remove("ab")
+	pi.remove("abc")
+	pi.remove("not exist")
+	actual = pi.keysWithPrefix("ab")
+	if fmt.Sprint(actual) != fmt.Sprint([]string{"abd"}) {
+		t.Fatalf("Inconsistent keys: expected: %v, actual: %v", []string{"abd"}, actual)
+	}
+	for _, key := range keys {
+		pi.remove(key)
+	}
+	if len(pi.root.children) != 0 || pi.root.end {
+		t.Fatalf("Nodes are not pruned after removing all keys: %#v", pi.root)
+	}
+}
+
+// genPrefixTestingKeys 用于生成测试用的带有若干公共前缀的键
+func genPrefixTestingKeys(number int) []string {
+	prefixes := []string{"user:", "user:admin:", "order:", "item:"}
+	keys := make([]string, number)
+	for i := 0; i < number; i++ {
+		keys[i] = fmt.Sprintf("%s%d", prefixes[i%len(prefixes)], i)
+	}
+	return keys
+}
+
+// collectPrefix 用于收集 RangePrefix 访问到的键并排序
+func collectPrefix(cm ConcurrentMap, prefix string) []string {
+	var keys []string
+	cm.RangePrefix(prefix, func(key string, element interface{}) bool {
+		keys = append(keys, key)
+		return true
+	})
+	sort.Strings(keys)
+	return keys
+}
+
+func TestCmapRangePrefix(t *testing.T) {
+	indexed, _ := NewConcurrentMap(8, nil, WithPrefixIndex(true))
+	scanned, _ := NewConcurrentMap(8, nil)
+	keys := genPrefixTestingKeys(1000)
+	for i, key := range keys {
+		indexed.Put(key, i)
+		scanned.Put(key, i)
+	}
+	for i, key := range keys {
+		if i%3 == 0 {
+			indexed.Delete(key)
+			scanned.Delete(key)
+		}
+	}
+	for _, prefix := range []string{"", "user:", "user:admin:", "order:1", "none"} {
+		expected := collectPrefix(scanned, prefix)
+		actual := collectPrefix(indexed, prefix)
+		if fmt.Sprint(actual) != fmt.Sprint(expected) {
+			t.Fatalf("Inconsistent keys with prefix %q: expected: %d keys, actual: %d keys",
+				prefix, len(expected), len(actual))
+		}
+	}
+}
+
+func TestCmapRangePrefixInParallel(t *testing.T) {
+	cm, _ := NewConcurrentMap(8, nil, WithPrefixIndex(true))
+	keys := genPrefixTestingKeys(1000)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j, key := range keys {
+				if j%4 != i {
+					continue
+				}
+				cm.Put(key, j)
+				cm.Put(key, j)
+				if j%2 == 0 {
+					cm.Delete(key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	index := cm.(*myConcurrentMap).opts.prefixIndex
+	indexedKeys := index.keysWithPrefix("")
+	if uint64(len(indexedKeys)) != cm.Len() {
+		t.Fatalf("Inconsistent index size: expected: %d, actual: %d",
+			cm.Len(), len(indexedKeys))
+	}
+	for _, key := range indexedKeys {
+		if cm.Get(key) == nil {
+			t.Fatalf("Indexed key %s doesn't exist in the cmap!", key)
+		}
+	}
+}
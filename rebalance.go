@@ -0,0 +1,82 @@
+package cmap
+
+// misroutedPair 代表一个需要移动的键值对及其重新计算的散列值
+type misroutedPair struct {
+	p    Pair
+	hash uint64
+}
+
+// hashDeleter 代表能够按给定散列值删除键值对的 SegmentTx。
+// 错位的键值对存放在其原有散列值对应的散列桶中，按重新计算的散列值无法找到它们。
+type hashDeleter interface {
+	deleteWithHash(key string, keyHash uint64) (Pair, bool)
+}
+
+// RebalanceSegments 持有 resizeLock 的写锁，与 Freeze 一样会阻塞所有写操作
+// 它先逐个散列段地在其锁的保护下取出错位的键值对，再逐一放入正确的散列段，
+// 同一时刻只持有一个散列段的锁，因此不会因加锁顺序而死锁
+// 若正确的散列段中已经存在同一个键，则保留已有的键值对，丢弃错位的那个
+func (c *myConcurrentMap) RebalanceSegments() int {
+	var evicted []Pair
+	// 在释放 resizeLock 之后调用
+	defer func() {
+		c.notifyEvicted(evicted)
+	}()
+	c.resizeLock.Lock()
+	defer c.resizeLock.Unlock()
+	segments := c.getSegments()
+	var moves []misroutedPair
+	for i, s := range segments {
+		s.Atomic(func(tx SegmentTx) {
+			var misrouted []misroutedPair
+			tx.Range(func(p Pair) bool {
+				keyHash := c.opts.hash(p.Key())
+				if keyHash != p.Hash() || segmentIndex(keyHash, len(segments)) != i {
+					misrouted = append(misrouted, misroutedPair{p, keyHash})
+				}
+				return true
+			})
+			deleter, _ := tx.(hashDeleter)
+			for _, m := range misrouted {
+				var p Pair
+				var ok bool
+				if deleter != nil {
+					p, ok = deleter.deleteWithHash(m.p.Key(), m.p.Hash())
+				} else {
+					p, ok = tx.Delete(m.p.Key())
+				}
+				if ok {
+					moves = append(moves, misroutedPair{p, m.hash})
+				}
+			}
+		})
+	}
+	var moved int
+	for _, m := range moves {
+		p := rehashedPair(m.p, m.hash)
+		if _, loaded, err := c.findSegment(m.hash).GetOrPut(p); err != nil || loaded {
+			decreaseUint64(&c.total)
+			evicted = append(evicted, m.p)
+			continue
+		}
+		moved++
+	}
+	return moved
+}
+
+// rehashedPair 用于返回散列值为 keyHash 的 p 的副本
+// 副本保留元素的版本号、过期时间和校验和
+func rehashedPair(p Pair, keyHash uint64) Pair {
+	pCopy := p.Copy()
+	if pp, ok := pCopy.(*pair); ok {
+		pp.hash = keyHash
+		return pp
+	}
+	rehashed, err := newPairWithHash(p.Key(), keyHash, p.Element())
+	if err != nil {
+		return pCopy
+	}
+	rehashed.SetExpiry(p.Expiry())
+	rehashed.SetChecksum(p.Checksum())
+	return rehashed
+}
@@ -0,0 +1,63 @@
+package cmap
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCmapRebalanceSegments(t *testing.T) {
+	concurrency := 8
+	cm, _ := NewConcurrentMap(concurrency, nil)
+	c := cm.(*myConcurrentMap)
+	segments := c.getSegments()
+	number := 200
+	// 把所有键值对都以错误的散列值直接放入第一个散列段
+	// 散列段会拒绝散列值不一致的键值对，因此绕过它直接放入散列桶
+	first := segments[0].(*segment)
+	for i := 0; i < number; i++ {
+		p, _ := newPairWithHash(fmt.Sprintf("key-%d", i), 0, i)
+		first.bucketOf(p.Hash()).Put(p, nil)
+		atomic.AddUint64(&first.pairTotal, 1)
+	}
+	atomic.AddUint64(&c.total, uint64(number))
+	// 正确的散列段中已存在的键会被保留
+	cm.Put("key-0", "kept")
+	if err := cm.VerifyPlacement(); err == nil {
+		t.Fatal("No misplaced pair is found in a skewed map!")
+	}
+	if size := segments[0].Size(); size < uint64(number) {
+		t.Fatalf("Inconsistent segment size: expected: >= %d, actual: %d", number, size)
+	}
+
+	moved := cm.RebalanceSegments()
+	if err := cm.VerifyPlacement(); err != nil {
+		t.Fatalf("An error occurs when verifying placement after rebalancing: %s", err)
+	}
+	// key-0 可能恰好属于第一个散列段，此时它已被 Put 替换而不是重复存放
+	if moved != number && moved != number-1 {
+		t.Fatalf("Inconsistent moved count: expected: %d or %d, actual: %d", number-1, number, moved)
+	}
+	if cm.Len() != uint64(number) {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", number, cm.Len())
+	}
+	for _, s := range segments {
+		s.Range(func(p Pair) bool {
+			if expected := c.findSegment(c.opts.hash(p.Key())); expected != s {
+				t.Fatalf("Key %s is not in the segment dictated by findSegment!", p.Key())
+			}
+			return true
+		})
+	}
+	if element := cm.Get("key-0"); element != "kept" {
+		t.Fatalf("Inconsistent element: expected: %v, actual: %v", "kept", element)
+	}
+	for i := 1; i < number; i++ {
+		if element := cm.Get(fmt.Sprintf("key-%d", i)); element != i {
+			t.Fatalf("Inconsistent element: expected: %v, actual: %v", i, element)
+		}
+	}
+	if moved := cm.RebalanceSegments(); moved != 0 {
+		t.Fatalf("Inconsistent moved count: expected: %d, actual: %d", 0, moved)
+	}
+}
@@ -0,0 +1,102 @@
+package cmap
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// 用于返回给定散列值对应的散列桶
+// 后台再散列期间，已迁移的旧散列桶中的键值对位于目标散列桶中
+// 几乎所有访问键的操作都会调用该方法，因此在这里统计访问次数
+// 注意！必须在锁的保护下调用该方法，该方法只读取散列段的状态，持有读锁即可
+func (s *segment) bucketOf(keyHash uint64) Bucket {
+	if s.opts.autoTune {
+		atomic.AddUint64(&s.opCount, 1)
+	}
+	i := int(keyHash % uint64(s.bucketsLen))
+	if s.rehashTarget != nil && i < s.rehashIndex {
+		return s.rehashTarget[int(keyHash%uint64(len(s.rehashTarget)))]
+	}
+	return s.buckets[i]
+}
+
+// 用于返回给定散列值对应的散列桶在其所在的散列桶切片中的索引
+// 注意！必须在锁的保护下调用该方法
+func (s *segment) bucketIndexOf(keyHash uint64) int {
+	i := int(keyHash % uint64(s.bucketsLen))
+	if s.rehashTarget != nil && i < s.rehashIndex {
+		return int(keyHash % uint64(len(s.rehashTarget)))
+	}
+	return i
+}
+
+// 用于返回当前存放着键值对的所有散列桶
+// 注意！必须在互斥锁的保护下调用该方法
+func (s *segment) allBuckets() []Bucket {
+	if s.rehashTarget == nil {
+		return s.buckets
+	}
+	buckets := make([]Bucket, 0, s.bucketsLen-s.rehashIndex+len(s.rehashTarget))
+	buckets = append(buckets, s.buckets[s.rehashIndex:]...)
+	return append(buckets, s.rehashTarget...)
+}
+
+// 用于开始迁移到 newNumber 个散列桶的后台再散列
+// 注意！必须在互斥锁的保护下调用该方法
+func (s *segment) startRehash(newNumber int) {
+	s.rehashTarget = make([]Bucket, newNumber)
+	for i := range s.rehashTarget {
+		s.rehashTarget[i] = newBucketOf(s.opts.bucketImpl)
+	}
+	s.rehashIndex = 0
+	go s.rehashLoop()
+}
+
+// 用于每隔 DEFAULT_REHASH_INTERVAL 在锁的保护下迁移 DEFAULT_REHASH_STEP 个旧散列桶，
+// 迁移完成后退出
+func (s *segment) rehashLoop() {
+	ticker := time.NewTicker(DEFAULT_REHASH_INTERVAL)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.lock.Lock()
+		oldBuckets := s.bucketsLen
+		done := s.rehashStep(DEFAULT_REHASH_STEP)
+		newBuckets := s.bucketsLen
+		s.lock.Unlock()
+		if done {
+			s.notifyRedistribute(oldBuckets, newBuckets)
+			return
+		}
+	}
+}
+
+// 用于迁移至多 n 个旧散列桶，返回值表示是否已全部迁移完成
+// 迁移的是键值对的副本，旧散列桶保持不变，因此不加锁的读操作仍能完整地遍历旧链表
+// 注意！必须在互斥锁的保护下调用该方法
+func (s *segment) rehashStep(n int) bool {
+	start := time.Now()
+	targetLen := uint64(len(s.rehashTarget))
+	var moved uint64
+	for end := s.rehashIndex + n; s.rehashIndex < end && s.rehashIndex < s.bucketsLen; s.rehashIndex++ {
+		b := s.buckets[s.rehashIndex]
+		for v, n := b.GetFirstPair(), 0; v != nil && n < MAX_CHAIN_LENGTH; v, n = v.Next(), n+1 {
+			p := v.Copy()
+			s.rehashTarget[int(p.Hash()%targetLen)].Put(p, nil)
+			moved++
+		}
+	}
+	finished := s.rehashIndex >= s.bucketsLen
+	if s.opts.redistributionCounter != nil {
+		s.opts.redistributionCounter.record(moved, finished, start)
+	}
+	if !finished {
+		return false
+	}
+	s.buckets = s.rehashTarget
+	s.bucketsLen = len(s.buckets)
+	s.bucketsView.Store(s.buckets)
+	s.rehashTarget = nil
+	s.rehashIndex = 0
+	atomic.AddUint64(&s.modCount, 1)
+	return true
+}
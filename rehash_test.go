@@ -0,0 +1,100 @@
+package cmap
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitRehash 用于等待散列段的后台再散列结束
+func waitRehash(t *testing.T, s *segment) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.lock.Lock()
+		rehashing := s.rehashTarget != nil
+		s.lock.Unlock()
+		if !rehashing {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("The background rehash doesn't finish in time!")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSegmentBackgroundRehash(t *testing.T) {
+	number := 5000
+	testCases := genNoRepetitiveTestingPairs(number)
+	var mu sync.Mutex
+	var changes [][2]int
+	opts := newOptions(WithBackgroundRehash(true),
+		WithRedistributeHook(func(segmentIndex int, oldBuckets, newBuckets int) {
+			mu.Lock()
+			changes = append(changes, [2]int{oldBuckets, newBuckets})
+			mu.Unlock()
+		}))
+	s := newSegmentWithOptions(0, DEFAULT_BUCKET_NUMBER, nil, opts).(*segment)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	// 迁移期间已放入的键值对必须始终可以读到
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			p := testCases[i%number]
+			if actual := s.Get(p.Key()); actual != nil && actual.Element() != p.Element() {
+				t.Errorf("Inconsistent element: expected: %#v, actual: %#v", p.Element(), actual.Element())
+				return
+			}
+		}
+	}()
+	for i, p := range testCases {
+		if _, err := s.Put(p); err != nil {
+			t.Fatalf("An error occurs when putting a pair: %s", err)
+		}
+		if i%100 == 0 {
+			for _, q := range testCases[:i+1] {
+				if s.Get(q.Key()) == nil {
+					t.Fatalf("Not found pair %s during the background rehash!", q.Key())
+				}
+			}
+		}
+	}
+	close(done)
+	wg.Wait()
+	waitRehash(t, s)
+	if s.bucketsLen <= DEFAULT_BUCKET_NUMBER {
+		t.Fatalf("The segment doesn't grow: bucketsLen: %d", s.bucketsLen)
+	}
+	if s.Size() != uint64(number) {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d", number, s.Size())
+	}
+	var count int
+	s.Range(func(p Pair) bool {
+		count++
+		return true
+	})
+	if count != number {
+		t.Fatalf("Inconsistent range count: expected: %d, actual: %d", number, count)
+	}
+	for _, p := range testCases {
+		if s.GetStaleWithHash(p.Key(), p.Hash()) == nil {
+			t.Fatalf("Not found pair %s after the background rehash!", p.Key())
+		}
+		if !s.Delete(p.Key()) {
+			t.Fatalf("Couldn't delete pair %s after the background rehash!", p.Key())
+		}
+	}
+	waitRehash(t, s)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(changes) == 0 {
+		t.Fatal("The redistribute hook is not called after the background rehash!")
+	}
+}
@@ -0,0 +1,59 @@
+package cmap
+
+// Rename 同时持有新旧两个键所在散列段的锁，按散列段的索引从小到大加锁，因此不会因加锁顺序而死锁
+// 先放入新键再删除旧键，放入失败时不做任何修改；持有读锁的读操作不会看到两个键同时存在或同时不存在
+// 新的键值对保留原有的元素、过期时间和校验和，但版本号和访问统计重新开始
+func (c *myConcurrentMap) Rename(oldKey, newKey string) bool {
+	oldKey, newKey = c.normalizeKey(oldKey), c.normalizeKey(newKey)
+	if oldKey == newKey {
+		return false
+	}
+	if err := c.lockForWrite(); err != nil {
+		return false
+	}
+	defer c.resizeLock.RUnlock()
+	segments := c.getSegments()
+	oldIndex := segmentIndex(c.opts.hash(oldKey), len(segments))
+	newIndex := segmentIndex(c.opts.hash(newKey), len(segments))
+	var renamed bool
+	rename := func(oldTx, newTx SegmentTx) {
+		p := oldTx.Get(oldKey)
+		if p == nil || newTx.Get(newKey) != nil {
+			return
+		}
+		element := p.Element()
+		if _, ok := element.(emptyElement); ok {
+			return
+		}
+		renamedPair, err := newPairWithHash(newKey, c.opts.hash(newKey), element)
+		if err != nil {
+			return
+		}
+		renamedPair.SetExpiry(p.Expiry())
+		renamedPair.SetChecksum(p.Checksum())
+		if ok, err := newTx.Put(renamedPair); !ok || err != nil {
+			return
+		}
+		oldTx.Delete(oldKey)
+		renamed = true
+	}
+	switch {
+	case oldIndex == newIndex:
+		segments[oldIndex].Atomic(func(tx SegmentTx) {
+			rename(tx, tx)
+		})
+	case oldIndex < newIndex:
+		segments[oldIndex].Atomic(func(oldTx SegmentTx) {
+			segments[newIndex].Atomic(func(newTx SegmentTx) {
+				rename(oldTx, newTx)
+			})
+		})
+	default:
+		segments[newIndex].Atomic(func(newTx SegmentTx) {
+			segments[oldIndex].Atomic(func(oldTx SegmentTx) {
+				rename(oldTx, newTx)
+			})
+		})
+	}
+	return renamed
+}
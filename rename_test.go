@@ -0,0 +1,111 @@
+package cmap
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// keysInSegments 用于返回与 key 位于同一散列段和不同散列段的键
+func keysInSegments(cm ConcurrentMap, key string) (same, other string) {
+	index := cm.SegmentIndexOf(key)
+	for i := 0; same == "" || other == ""; i++ {
+		candidate := fmt.Sprintf("%s-%d", key, i)
+		if cm.SegmentIndexOf(candidate) == index {
+			if same == "" {
+				same = candidate
+			}
+		} else if other == "" {
+			other = candidate
+		}
+	}
+	return
+}
+
+func TestCmapRename(t *testing.T) {
+	cm, _ := NewConcurrentMap(8, nil)
+	same, other := keysInSegments(cm, "old")
+	for _, newKey := range []string{same, other} {
+		cm.Put("old", newKey)
+		if !cm.Rename("old", newKey) {
+			t.Fatalf("Couldn't rename the key to %s!", newKey)
+		}
+		if element := cm.Get(newKey); element != newKey {
+			t.Fatalf("Inconsistent element: expected: %v, actual: %v", newKey, element)
+		}
+		if cm.Get("old") != nil {
+			t.Fatal("The old key still exists after renaming!")
+		}
+		if cm.Len() != 1 {
+			t.Fatalf("Inconsistent map length: expected: %d, actual: %d", 1, cm.Len())
+		}
+		cm.Delete(newKey)
+	}
+
+	// 新键已存在、旧键不存在或元素已被取走时不做任何修改
+	cm.Put("old", 1)
+	cm.Put(same, 2)
+	cm.Put(other, 3)
+	for _, newKey := range []string{same, other, "old"} {
+		if cm.Rename("old", newKey) {
+			t.Fatalf("Renamed the key to the existing key %s!", newKey)
+		}
+	}
+	if cm.Rename("missing", "absent") {
+		t.Fatal("Renamed an absent key!")
+	}
+	cm.TakeElement(other)
+	if cm.Rename(other, "absent") {
+		t.Fatal("Renamed a taken key!")
+	}
+	expected := map[string]interface{}{"old": 1, same: 2, other: nil, "absent": nil}
+	for key, element := range expected {
+		if actual := cm.Get(key); actual != element {
+			t.Fatalf("Inconsistent element of key %s: expected: %v, actual: %v", key, element, actual)
+		}
+	}
+	if cm.Len() != 3 {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", 3, cm.Len())
+	}
+}
+
+func TestCmapRenameInParallel(t *testing.T) {
+	cm, _ := NewConcurrentMap(8, nil)
+	_, other := keysInSegments(cm, "a")
+	cm.Put("a", "element")
+	// 两个 goroutine 以相反的顺序锁住两个散列段，只要加锁顺序一致就不会死锁
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	var renamed int
+	number := 200
+	for _, keys := range [][2]string{{"a", other}, {other, "a"}} {
+		wg.Add(1)
+		go func(from, to string) {
+			defer wg.Done()
+			for i := 0; i < number; i++ {
+				if cm.Rename(from, to) {
+					lock.Lock()
+					renamed++
+					lock.Unlock()
+				}
+			}
+		}(keys[0], keys[1])
+	}
+	wg.Wait()
+	if cm.Len() != 1 {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", 1, cm.Len())
+	}
+	// 每次成功的重命名都会使元素换到另一个键上
+	expectedKey := "a"
+	if renamed%2 == 1 {
+		expectedKey = other
+	}
+	if element := cm.Get(expectedKey); element != "element" {
+		t.Fatalf("Inconsistent element of key %s: expected: %v, actual: %v (renamed: %d)",
+			expectedKey, "element", element, renamed)
+	}
+	if size := cm.(*myConcurrentMap).findSegment(hash("a")).Size() +
+		cm.(*myConcurrentMap).findSegment(hash(other)).Size(); size != 1 {
+		t.Fatalf("Inconsistent segment sizes: expected: %d, actual: %d", 1, size)
+	}
+}
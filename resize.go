@@ -0,0 +1,192 @@
+package cmap
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// newSegments 会使用当前 map 的配置创建 concurrency 个散列段
+// 启用了并行初始化时，散列段会被分成 GOMAXPROCS 组分别在各自的 goroutine 中创建
+func (c *myConcurrentMap) newSegments(concurrency int) []Segment {
+	segments := make([]Segment, concurrency)
+	workers := runtime.GOMAXPROCS(0)
+	if !c.opts.parallelInit || workers == 1 || concurrency == 1 {
+		for i := 0; i < concurrency; i++ {
+			segments[i] = newSegmentWithOptions(i, c.opts.bucketNumber, c.pairRedistributor, c.opts)
+		}
+		return segments
+	}
+	if workers > concurrency {
+		workers = concurrency
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+			// 每个 goroutine 负责连续的一段索引，各自写入切片的不同位置
+			for i := w * concurrency / workers; i < (w+1)*concurrency/workers; i++ {
+				segments[i] = newSegmentWithOptions(i, c.opts.bucketNumber, c.pairRedistributor, c.opts)
+			}
+		}(w)
+	}
+	wg.Wait()
+	return segments
+}
+
+// Resize 会先置位 resizing 使新的写操作返回 MapResizingError，
+// 再获取 resizeLock 的写锁等待进行中的写操作结束，
+// 然后在新的散列段中放入所有键值对的副本，迁移预留，最后整体替换散列段切片
+// 读操作不加锁，在替换之前读到的是旧的散列段，其内容在调整期间不会改变
+func (c *myConcurrentMap) Resize(concurrency int) error {
+	if concurrency <= 0 {
+		return newIllegalParameterError("concurrency is too small")
+	}
+	if concurrency > c.opts.maxConcurrency {
+		return newConcurrencyLimitError(concurrency, c.opts.maxConcurrency)
+	}
+	if !atomic.CompareAndSwapInt32(&c.resizing, 0, 1) {
+		return newMapResizingError()
+	}
+	defer atomic.StoreInt32(&c.resizing, 0)
+	c.resizeLock.Lock()
+	defer c.resizeLock.Unlock()
+
+	oldSegments := c.getSegments()
+	if len(oldSegments) == concurrency {
+		return nil
+	}
+	newSegments := c.newSegments(concurrency)
+	// 迁移到新的散列段不是对键的修改，不记录到 WithMutationLog 中
+	muteMutations(newSegments, true)
+	for _, s := range oldSegments {
+		var err error
+		s.Range(func(p Pair) bool {
+			_, err = newSegments[segmentIndex(p.Hash(), concurrency)].Put(p.Copy())
+			return err == nil
+		})
+		if err != nil {
+			c.releaseInternedKeys(newSegments)
+			return err
+		}
+		for _, key := range s.ReservedKeys() {
+			newSegments[segmentIndex(c.opts.hash(key), concurrency)].Reserve(key)
+		}
+	}
+	muteMutations(newSegments, false)
+	c.segments.Store(newSegments)
+	// 唤醒旧散列段上的等待者，使其在新的散列段上重新登记
+	for _, s := range oldSegments {
+		s.WakeWatchers()
+	}
+	// 新的散列段中的副本各自持有驻留键的引用，旧散列段中的键值对的引用都要释放
+	c.releaseInternedKeys(oldSegments)
+	return nil
+}
+
+// releaseInternedKeys 用于释放被丢弃的散列段中的键值对对驻留键的引用
+func (c *myConcurrentMap) releaseInternedKeys(segments []Segment) {
+	if c.opts.keyInterner == nil {
+		return
+	}
+	for _, s := range segments {
+		s.Range(func(p Pair) bool {
+			c.opts.keyInterner.release(p.Key())
+			return true
+		})
+	}
+}
+
+// fillSegments 会将 items 放入新创建的 concurrency 个散列段中
+func (c *myConcurrentMap) fillSegments(concurrency int, items map[string]interface{}) ([]Segment, error) {
+	segments := c.newSegments(concurrency)
+	for key, element := range items {
+		p, err := c.newPair(key, element)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := segments[segmentIndex(p.Hash(), concurrency)].Put(p); err != nil {
+			c.releaseInternedKeys(segments)
+			return nil, err
+		}
+	}
+	return segments, nil
+}
+
+// ReplaceAll 会在不加锁的情况下构建新的散列段，
+// 只在迁移预留和替换散列段切片时短暂地持有 resizeLock 的写锁
+// 若构建期间并发量被 Resize 改变，则会在锁内以新的并发量重新构建
+func (c *myConcurrentMap) ReplaceAll(items map[string]interface{}) error {
+	// 先校验全部元素，避免构建到一半失败时在前缀索引中留下多余的键
+	for key, element := range items {
+		if element == nil {
+			return newIllegalParameterError(fmt.Sprintf("element of key %s is nil", key))
+		}
+	}
+	if c.opts.maxEntries > 0 && uint64(len(items)) > c.opts.maxEntries {
+		return newCapacityExceededError(c.opts.maxEntries)
+	}
+	if c.opts.keyNormalizer != nil {
+		normalized := make(map[string]interface{}, len(items))
+		for key, element := range items {
+			normalized[c.normalizeKey(key)] = element
+		}
+		items = normalized
+	}
+	concurrency := c.Concurrency()
+	newSegments, err := c.fillSegments(concurrency, items)
+	if err != nil {
+		return err
+	}
+	var evicted []Pair
+	// 在释放 resizeLock 之后调用
+	defer func() {
+		c.notifyEvicted(evicted)
+	}()
+	c.resizeLock.Lock()
+	defer c.resizeLock.Unlock()
+	oldSegments := c.getSegments()
+	if len(oldSegments) != concurrency {
+		concurrency = len(oldSegments)
+		c.releaseInternedKeys(newSegments)
+		if newSegments, err = c.fillSegments(concurrency, items); err != nil {
+			return err
+		}
+	}
+	for _, s := range oldSegments {
+		// 已放入新内容的键会拒绝预留
+		for _, key := range s.ReservedKeys() {
+			newSegments[segmentIndex(c.opts.hash(key), concurrency)].Reserve(key)
+		}
+	}
+	c.segments.Store(newSegments)
+	atomic.StoreUint64(&c.total, uint64(len(items)))
+	for _, s := range oldSegments {
+		// 新的散列段已将其键加入前缀索引和插入顺序，这里只需移除被丢弃的键
+		if c.opts.prefixIndex != nil || c.opts.insertionOrder != nil || c.opts.onEvict != nil {
+			s.Range(func(p Pair) bool {
+				if _, ok := items[p.Key()]; ok {
+					return true
+				}
+				if c.opts.prefixIndex != nil {
+					c.opts.prefixIndex.remove(p.Key())
+				}
+				if c.opts.insertionOrder != nil {
+					c.opts.insertionOrder.remove(p.Key())
+				}
+				if c.opts.onEvict != nil {
+					evicted = append(evicted, p)
+				}
+				return true
+			})
+		}
+		s.WakeWatchers()
+	}
+	// 保留下来的键在新的散列段中也持有驻留键的引用，因此旧散列段中所有键值对的引用都要释放
+	c.releaseInternedKeys(oldSegments)
+	return nil
+}
@@ -0,0 +1,340 @@
+package cmap
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCmapResize(t *testing.T) {
+	number := 1000
+	testCases := genNoRepetitiveTestingPairs(number)
+	cm, _ := NewConcurrentMap(4, nil)
+	for _, p := range testCases {
+		cm.Put(p.Key(), p.Element())
+	}
+	for _, concurrency := range []int{16, 1, 7} {
+		if err := cm.Resize(concurrency); err != nil {
+			t.Fatalf("An error occurs when resizing to %d: %s", concurrency, err)
+		}
+		if cm.Concurrency() != concurrency {
+			t.Fatalf("Inconsistent concurrency: expected: %d, actual: %d",
+				concurrency, cm.Concurrency())
+		}
+		if cm.Len() != uint64(number) {
+			t.Fatalf("Inconsistent size: expected: %d, actual: %d", number, cm.Len())
+		}
+		var total uint64
+		for _, s := range cm.(*myConcurrentMap).getSegments() {
+			total += s.Size()
+		}
+		if total != uint64(number) {
+			t.Fatalf("Inconsistent segment size sum: expected: %d, actual: %d", number, total)
+		}
+		for _, p := range testCases {
+			if actual := cm.Get(p.Key()); actual != p.Element() {
+				t.Fatalf("Inconsistent element: expected: %#v, actual: %#v (key: %s)",
+					p.Element(), actual, p.Key())
+			}
+		}
+	}
+	for _, concurrency := range []int{0, MAX_CONCURRENCY + 1} {
+		if err := cm.Resize(concurrency); err == nil {
+			t.Fatalf("No error when resizing to %d, but should not be the case!", concurrency)
+		}
+	}
+}
+
+func TestCmapResizeKeepsReservationsAndWaiters(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	committed, commit, _ := cm.Reserve("reserved")
+	if committed {
+		t.Fatal("Couldn't reserve an absent key!")
+	}
+	done := make(chan interface{})
+	go func() {
+		element, _ := cm.GetOrWait("awaited", 5*time.Second)
+		done <- element
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if err := cm.Resize(9); err != nil {
+		t.Fatalf("An error occurs when resizing: %s", err)
+	}
+	if again, _, _ := cm.Reserve("reserved"); !again {
+		t.Fatal("Reservation is lost after resizing!")
+	}
+	commit("element")
+	if actual := cm.Get("reserved"); actual != "element" {
+		t.Fatalf("Inconsistent element: expected: %#v, actual: %#v", "element", actual)
+	}
+	cm.Put("awaited", "value")
+	select {
+	case element := <-done:
+		if element != "value" {
+			t.Fatalf("Inconsistent element: expected: %#v, actual: %#v", "value", element)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Waiter is not woken after resizing!")
+	}
+}
+
+func TestCmapResizingError(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	m := cm.(*myConcurrentMap)
+	atomic.StoreInt32(&m.resizing, 1)
+	if _, err := cm.Put("key", "element"); err == nil {
+		t.Fatal("No error when putting during resizing, but should not be the case!")
+	} else if _, ok := err.(MapResizingError); !ok {
+		t.Fatalf("Inconsistent error type: expected: %T, actual: %T", MapResizingError{}, err)
+	}
+	if _, _, err := cm.GetOrPut("key", "element"); err == nil {
+		t.Fatal("No error when putting during resizing, but should not be the case!")
+	}
+	if err := cm.Resize(8); err == nil {
+		t.Fatal("No error when resizing during resizing, but should not be the case!")
+	}
+	atomic.StoreInt32(&m.resizing, 0)
+	if _, err := cm.Put("key", "element"); err != nil {
+		t.Fatalf("An error occurs when putting after resizing: %s", err)
+	}
+	if cm.Len() != 1 {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d", 1, cm.Len())
+	}
+
+	// 不返回错误的写操作在调整期间不做任何修改
+	_, version, _ := cm.LoadVersioned("key")
+	src, _ := NewConcurrentMap(1, nil)
+	src.Put("warm", 1)
+	atomic.StoreInt32(&m.resizing, 1)
+	if cm.Delete("key") {
+		t.Fatal("The key is deleted during resizing!")
+	}
+	if _, ok := cm.DeleteAndReturn("key"); ok {
+		t.Fatal("The key is deleted and returned during resizing!")
+	}
+	if _, ok := cm.TakeElement("key"); ok {
+		t.Fatal("The element is taken during resizing!")
+	}
+	if cm.CompareVersionAndSwap("key", version, "other") {
+		t.Fatal("The element is swapped during resizing!")
+	}
+	if putCount, delCount := cm.ApplyChanges(map[string]interface{}{"a": 1}, []string{"key"}); putCount != 0 || delCount != 0 {
+		t.Fatalf("Inconsistent changes applied during resizing: puts: %d, deletes: %d", putCount, delCount)
+	}
+	if result := cm.GetOrPutMulti(map[string]interface{}{"b": 1}); len(result) != 0 {
+		t.Fatalf("Inconsistent result of getting or putting during resizing: %v", result)
+	}
+	if copied := cm.WarmFrom(src, nil); copied != 0 {
+		t.Fatalf("Inconsistent warmed count during resizing: expected: %d, actual: %d", 0, copied)
+	}
+	atomic.StoreInt32(&m.resizing, 0)
+	if cm.Len() != 1 || cm.Get("key") != "element" {
+		t.Fatalf("Inconsistent map after writing during resizing: length: %d, element: %v", cm.Len(), cm.Get("key"))
+	}
+}
+
+func TestCmapResizeInParallel(t *testing.T) {
+	number := 20000
+	testCases := genNoRepetitiveTestingPairs(number)
+	cm, _ := NewConcurrentMap(4, nil)
+	var retries int64
+	var wg sync.WaitGroup
+	workers := 4
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := i; j < number; j += workers {
+				p := testCases[j]
+				for {
+					_, err := cm.Put(p.Key(), p.Element())
+					if err == nil {
+						break
+					}
+					if _, ok := err.(MapResizingError); !ok {
+						t.Errorf("Inconsistent error type: expected: %T, actual: %T",
+							MapResizingError{}, err)
+						return
+					}
+					atomic.AddInt64(&retries, 1)
+				}
+			}
+		}(i)
+	}
+	for cm.Len() < uint64(number/10) {
+		time.Sleep(time.Millisecond)
+	}
+	for _, concurrency := range []int{8, 3, 16, 5} {
+		if err := cm.Resize(concurrency); err != nil {
+			t.Fatalf("An error occurs when resizing to %d: %s", concurrency, err)
+		}
+	}
+	wg.Wait()
+	t.Logf("Retries caused by resizing: %d", retries)
+	if cm.Len() != uint64(number) {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d", number, cm.Len())
+	}
+	for _, p := range testCases {
+		if actual := cm.Get(p.Key()); actual != p.Element() {
+			t.Fatalf("Inconsistent element: expected: %#v, actual: %#v (key: %s)",
+				p.Element(), actual, p.Key())
+		}
+	}
+}
+
+func TestCmapReplaceAll(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil, WithPrefixIndex(true))
+	cm.Put("old-only", 1)
+	cm.Put("shared", 1)
+	items := map[string]interface{}{"shared": 2, "new-only": 2}
+	if err := cm.ReplaceAll(items); err != nil {
+		t.Fatalf("An error occurs when replacing all pairs: %s", err)
+	}
+	if cm.Len() != 2 {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d", 2, cm.Len())
+	}
+	for key, element := range items {
+		if actual := cm.Get(key); actual != element {
+			t.Fatalf("Inconsistent element: expected: %#v, actual: %#v", element, actual)
+		}
+	}
+	if cm.Get("old-only") != nil {
+		t.Fatal("Found a discarded pair after replacing all pairs!")
+	}
+	if keys := cm.(*myConcurrentMap).opts.prefixIndex.keysWithPrefix("old"); len(keys) != 0 {
+		t.Fatalf("Found discarded keys in the prefix index: %v", keys)
+	}
+	if err := cm.ReplaceAll(map[string]interface{}{"a": 1, "nil": nil}); err == nil {
+		t.Fatal("No error when replacing with a nil element, but should not be the case!")
+	}
+	if cm.Len() != 2 || cm.Get("a") != nil {
+		t.Fatal("A failed replacement is partially applied!")
+	}
+}
+
+func TestCmapReplaceAllInParallel(t *testing.T) {
+	number := 100
+	cm, _ := NewConcurrentMap(4, nil)
+	gen := func(element int) map[string]interface{} {
+		items := make(map[string]interface{}, number)
+		for _, p := range genNoRepetitiveTestingPairs(number) {
+			items[p.Key()] = element
+		}
+		return items
+	}
+	cm.ReplaceAll(gen(0))
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= 100; i++ {
+			cm.ReplaceAll(gen(i))
+		}
+		close(done)
+	}()
+	for {
+		select {
+		case <-done:
+			wg.Wait()
+			return
+		default:
+		}
+		// 一次替换之后，每个散列段的内容都应来自同一次替换
+		for i := 0; i < cm.Concurrency(); i++ {
+			clone, _ := cm.CloneSegment(i)
+			var first interface{}
+			for _, element := range clone {
+				if first == nil {
+					first = element
+				} else if element != first {
+					t.Fatalf("Observed a mixed segment: %v", clone)
+				}
+			}
+		}
+	}
+}
+
+func TestCmapRangeDuringResize(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	number := 1000
+	for i := 0; i < number; i++ {
+		cm.Put(fmt.Sprintf("key-%d", i), i)
+	}
+	visited := make(map[string]int)
+	cm.Range(func(key string, element interface{}) bool {
+		visited[key]++
+		switch len(visited) {
+		case 10:
+			if err := cm.Resize(16); err != nil {
+				t.Fatalf("An error occurs when resizing the map: %s", err)
+			}
+			cm.Put("new-key", 1)
+		case 500:
+			if err := cm.Resize(3); err != nil {
+				t.Fatalf("An error occurs when resizing the map: %s", err)
+			}
+		}
+		return true
+	})
+	if len(visited) != number {
+		t.Fatalf("Inconsistent visited count: expected: %d, actual: %d", number, len(visited))
+	}
+	for i := 0; i < number; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if visited[key] != 1 {
+			t.Fatalf("Inconsistent visit count of %s: expected: %d, actual: %d", key, 1, visited[key])
+		}
+	}
+	if cm.Concurrency() != 3 || cm.Len() != uint64(number+1) {
+		t.Fatalf("Inconsistent map after resizing: concurrency: %d, length: %d", cm.Concurrency(), cm.Len())
+	}
+}
+
+func TestCmapRangeDuringRehash(t *testing.T) {
+	for _, background := range []bool{false, true} {
+		cm, _ := NewConcurrentMap(1, nil, WithBackgroundRehash(background))
+		number := 1000
+		for i := 0; i < number; i++ {
+			cm.Put(fmt.Sprintf("key-%d", i), i)
+		}
+		visited := make(map[string]int)
+		cm.Range(func(key string, element interface{}) bool {
+			visited[key]++
+			switch len(visited) {
+			case 10:
+				// 放入足够多的键，使散列段在遍历期间扩容
+				for i := 0; i < 4*number; i++ {
+					cm.Put(fmt.Sprintf("extra-%d", i), i)
+				}
+			case 500:
+				// 删除足够多的键，使散列段在遍历期间收缩
+				for i := 0; i < 4*number; i++ {
+					cm.Delete(fmt.Sprintf("extra-%d", i))
+				}
+			}
+			if background {
+				time.Sleep(DEFAULT_REHASH_INTERVAL)
+			}
+			return true
+		})
+		for key, count := range visited {
+			if count != 1 {
+				t.Fatalf("Inconsistent visit count of %s (background: %v): expected: %d, actual: %d",
+					key, background, 1, count)
+			}
+		}
+		for i := 0; i < number; i++ {
+			if key := fmt.Sprintf("key-%d", i); visited[key] != 1 {
+				t.Fatalf("Inconsistent visit count of %s (background: %v): expected: %d, actual: %d",
+					key, background, 1, visited[key])
+			}
+		}
+		assertUniqueKeys(t, cm)
+		if cm.Len() != uint64(number) {
+			t.Fatalf("Inconsistent length (background: %v): expected: %d, actual: %d", background, number, cm.Len())
+		}
+	}
+}
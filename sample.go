@@ -0,0 +1,61 @@
+package cmap
+
+import "math/rand"
+
+// RandomEntries 每次尝试都会随机选择一个散列段及其中的一个散列桶，
+// 再以蓄水池抽样从桶的链表中选出一个键值对
+// 空桶和重复选中都会浪费一次尝试，尝试次数用尽时返回的键值对可能少于 n 个
+// 若 n 不小于键值对数量，则直接遍历返回全部键值对
+func (c *myConcurrentMap) RandomEntries(n int) map[string]interface{} {
+	entries := make(map[string]interface{})
+	if n <= 0 {
+		return entries
+	}
+	if uint64(n) >= c.Len() {
+		c.Range(func(key string, element interface{}) bool {
+			entries[key] = element
+			return len(entries) < n
+		})
+		return entries
+	}
+	segments := c.getSegments()
+	for attempts := 4*n + 16; attempts > 0 && len(entries) < n; attempts-- {
+		s := segments[rand.Intn(len(segments))]
+		b := s.GetBucketWithHash(rand.Uint64())
+		var chosen Pair
+		var seen int
+		for v := b.GetFirstPair(); v != nil && seen < MAX_CHAIN_LENGTH; v = v.Next() {
+			seen++
+			if rand.Intn(seen) == 0 {
+				chosen = v
+			}
+		}
+		if chosen != nil {
+			entries[chosen.Key()] = visibleElement(chosen.Element())
+		}
+	}
+	return entries
+}
+
+// Preview 按散列段和散列桶的顺序遍历，收集到 n 个键值对后立即停止，
+// 因此开销只与 n 和遍历到的空桶数有关，而与键值对总数无关
+// 元素已被取走的键不计入，元素会像 Get 一样被解码
+func (c *myConcurrentMap) Preview(n int) map[string]interface{} {
+	entries := make(map[string]interface{})
+	if n <= 0 {
+		return entries
+	}
+	for _, s := range c.getSegments() {
+		if !s.Range(func(p Pair) bool {
+			element, err := c.decodeElement(p.Element())
+			if err != nil || element == nil {
+				return true
+			}
+			entries[p.Key()] = element
+			return len(entries) < n
+		}) {
+			break
+		}
+	}
+	return entries
+}
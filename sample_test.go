@@ -0,0 +1,76 @@
+package cmap
+
+import "testing"
+
+func TestCmapRandomEntries(t *testing.T) {
+	number := 200
+	testCases := genNoRepetitiveTestingPairs(number)
+	cm, _ := NewConcurrentMap(8, nil)
+	for _, p := range testCases {
+		cm.Put(p.Key(), p.Element())
+	}
+	seen := make(map[string]bool)
+	n := 10
+	for i := 0; i < 500; i++ {
+		entries := cm.RandomEntries(n)
+		if len(entries) > n {
+			t.Fatalf("Inconsistent entry count: expected: <= %d, actual: %d", n, len(entries))
+		}
+		for key, element := range entries {
+			if actual := cm.Get(key); actual != element {
+				t.Fatalf("Inconsistent element: expected: %#v, actual: %#v", actual, element)
+			}
+			seen[key] = true
+		}
+	}
+	if len(seen) < number*9/10 {
+		t.Fatalf("Too few keys are sampled: %d/%d", len(seen), number)
+	}
+	if entries := cm.RandomEntries(number * 2); len(entries) != number {
+		t.Fatalf("Inconsistent entry count: expected: %d, actual: %d", number, len(entries))
+	}
+	if entries := cm.RandomEntries(0); len(entries) != 0 {
+		t.Fatalf("Inconsistent entry count: expected: %d, actual: %d", 0, len(entries))
+	}
+}
+
+func TestCmapPreview(t *testing.T) {
+	number := 200
+	testCases := genNoRepetitiveTestingPairs(number)
+	cm, _ := NewConcurrentMap(8, nil)
+	for _, n := range []int{-1, 0, 10} {
+		if entries := cm.Preview(n); len(entries) != 0 {
+			t.Fatalf("Inconsistent entry count of an empty map: expected: %d, actual: %d", 0, len(entries))
+		}
+	}
+	for _, p := range testCases {
+		cm.Put(p.Key(), p.Element())
+	}
+	for _, n := range []int{1, 20, number} {
+		entries := cm.Preview(n)
+		if len(entries) != n {
+			t.Fatalf("Inconsistent entry count: expected: %d, actual: %d", n, len(entries))
+		}
+		for key, element := range entries {
+			if actual := cm.Get(key); actual != element {
+				t.Fatalf("Inconsistent element: expected: %#v, actual: %#v", actual, element)
+			}
+		}
+	}
+	if entries := cm.Preview(number * 2); len(entries) != number {
+		t.Fatalf("Inconsistent entry count: expected: %d, actual: %d", number, len(entries))
+	}
+	// 元素已被取走的键不计入
+	for _, p := range testCases[:number/2] {
+		cm.TakeElement(p.Key())
+	}
+	entries := cm.Preview(number)
+	if len(entries) != number-number/2 {
+		t.Fatalf("Inconsistent entry count: expected: %d, actual: %d", number-number/2, len(entries))
+	}
+	for _, p := range testCases[:number/2] {
+		if _, ok := entries[p.Key()]; ok {
+			t.Fatalf("The taken key %s is previewed!", p.Key())
+		}
+	}
+}
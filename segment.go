@@ -4,23 +4,96 @@ import (
 	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // 用来表示并发安全对散列段的接口
+// 删除键值对时会复制其前面的键值对，再分布时会把所有键值对的副本放入新的散列桶，
+// 因此返回的键值对在释放锁之后可能已被副本替换：通过它修改元素可能不会生效，
+// 判断是否仍是同一个键值对时应比较键和版本号，而不是比较键值对本身
 type Segment interface {
 	// 根据参数放入一个键值对
 	// 第一个返回值表示是否新增成功
+	// p 的散列值与当前散列函数计算的不一致时返回 ForeignPairError
 	Put(p Pair) (bool, error)
+	// 若键已存在则返回已有的键值对，第二个返回值为 true
+	// 否则放入给定的键值对并将其返回，第二个返回值为 false
+	// p 的散列值与当前散列函数计算的不一致时返回 ForeignPairError
+	GetOrPut(p Pair) (Pair, bool, error)
 	// 根据参数返回一个键值对
 	Get(key string) Pair
 	// 根据参数返回一个键值对
+	// 若键不存在且 register 为 true，则登记并返回一个在键被放入时关闭的通知通道
+	Watch(key string, register bool) (Pair, <-chan struct{})
+	// 注销由 Watch 登记的通知通道
+	Unwatch(key string, ch <-chan struct{})
+	// 关闭所有已登记的通知通道
+	WakeWatchers()
+	// 根据参数返回一个键值对
 	// 注意！参数 keyHash 是基于key计算出的散列值
 	// 主要为了避免重复计算键的散列值
 	GetWithHash(key string, keyHash uint64) Pair
+	// 与 GetWithHash 相同但不加锁，再分布期间可能读不到已存在的键值对
+	GetStaleWithHash(key string, keyHash uint64) Pair
+	// 根据键的散列值返回其所在的散列桶
+	GetBucketWithHash(keyHash uint64) Bucket
+	// 与 GetBucketWithHash 相同，同时返回散列桶在散列桶切片中的索引和切片的长度
+	// 后台再散列期间已迁移的键所在的是目标散列桶切片
+	LocateBucketWithHash(keyHash uint64) (b Bucket, index int, bucketNumber int)
+	// 若指定键的元素版本号等于 expectedVersion，则将元素替换为 element
+	// 第一个返回值表示是否替换成功
+	CompareVersionAndSwap(key string, expectedVersion uint64, element interface{}) (bool, error)
+	// 若键不存在且未被预留，则预留该键并返回 true，否则返回 false
+	Reserve(key string) bool
+	// 放入键值对并解除对其键的预留
+	Commit(p Pair) (bool, error)
+	// 解除对给定键的预留
+	CancelReservation(key string)
+	// 返回所有已被预留但尚未提交的键
+	ReservedKeys() []string
 	// 删除指定参数的键值对
 	Delete(key string) bool
+	// 删除指定参数的键值对并返回被删除的键值对
+	DeleteAndReturn(key string) (Pair, bool)
+	// 遍历散列段中的键值对，f 返回 false 时停止遍历
+	// 返回值表示是否遍历完了所有键值对
+	Range(f func(p Pair) bool) bool
+	// 立即把散列桶的数量扩大到 bucketNumber，返回值表示是否扩容
+	// 散列桶的数量已不少于 bucketNumber 时不做任何事
+	Grow(bucketNumber int) bool
+	// 在锁的保护下复制散列段中的所有键值对
+	Clone() map[string]interface{}
+	// 检查散列段的各个散列桶中是否存在形成环的链表
+	HasCycle() bool
+	// 检查每个键值对是否位于其散列值对应的散列桶中，返回遇到的第一个错误
+	VerifyPlacement() error
+	// 在散列段的锁的保护下执行 f，f 只能通过 tx 访问当前散列段
+	// 注意！在 f 中调用当前散列段的其他方法会导致死锁
+	Atomic(f func(tx SegmentTx))
+	// 返回经由散列段访问键的次数，只有启用了自动调整并发量时才会统计
+	OpCount() uint64
+	// 返回结构性修改的次数，每次新增或删除键值对完成后都会加一
+	// 可用于判断两次不加锁的读操作之间散列段是否被修改过
+	ModCount() uint64
 	// 获取当前段段尺寸(其中包含的散列桶的数量)
 	Size() uint64
+	// 返回散列桶的数量，后台再散列期间返回迁移前的数量
+	BucketNumber() int
+}
+
+// 用于表示在散列段的锁的保护下对散列段的操作
+// 只在 Segment.Atomic 的参数函数中有效
+type SegmentTx interface {
+	// 根据参数返回一个键值对
+	Get(key string) Pair
+	// 根据参数放入一个键值对
+	// 第一个返回值表示是否新增成功
+	Put(p Pair) (bool, error)
+	// 删除指定参数的键值对并返回被删除的键值对
+	Delete(key string) (Pair, bool)
+	// 遍历散列段中的键值对，f 返回 false 时停止遍历
+	// f 中可以修改当前散列段
+	Range(f func(p Pair) bool) bool
 }
 
 // 用于表示并发安全的散列段的类型
@@ -29,17 +102,39 @@ type segment struct {
 	buckets []Bucket
 	// 用于表示散列桶切片的长度
 	bucketsLen int
+	// 用于表示后台再散列的目标散列桶切片，为 nil 表示没有进行中的后台再散列
+	rehashTarget []Bucket
+	// 用于表示已迁移到 rehashTarget 中的旧散列桶的数量
+	rehashIndex int
+	// 用于表示散列桶切片的快照，供不加锁的读操作使用
+	// 其中存放的是 []Bucket，每次替换 buckets 时同步更新
+	bucketsView atomic.Value
 	// 用于表示键值对总数
 	pairTotal uint64
+	// 用于表示结构性修改（新增、删除键值对）的次数，在修改完成后加一
+	modCount uint64
+	// 用于表示访问键的次数
+	opCount uint64
 	// 用于表示键值对的再分布器
 	pairRedistributor PairRedistributor
-	lock              sync.Mutex
+	lock              sync.RWMutex
+	// 用于表示当前散列段在 map 中的索引
+	index int
+	// 用于表示 map 的可选配置
+	opts *options
+	// 用于表示等待键被放入的通知通道，受 lock 保护
+	waiters map[string][]chan struct{}
+	// 用于表示已被预留但尚未提交的键，受 lock 保护
+	reserved map[string]struct{}
+	// 用于表示是否暂停记录修改，受 lock 保护
+	mutationsMuted bool
 }
 
 // 用于检查给定参数并设置相应的阈值和计数
 // 并在必要时重新分配所有散列桶中所有的键值对
+// 键值对总数只在散列段的锁的保护下修改，因此在修改之后读取一次即可得到与散列桶一致的值
 // 注意！必须在互斥锁的保护下调用该方法
-func (s *segment) redistribute(pairTotal uint64, bucketSize uint64) (err error) {
+func (s *segment) redistribute(bucketSize uint64) (err error) {
 	// 防止该方法出现 panic
 	defer func() {
 		if p := recover(); p != nil {
@@ -51,72 +146,547 @@ func (s *segment) redistribute(pairTotal uint64, bucketSize uint64) (err error)
 		}
 	}()
 
+	// 后台再散列期间不再触发新的再分布
+	if s.rehashTarget != nil {
+		return nil
+	}
+	pairTotal := atomic.LoadUint64(&s.pairTotal)
 	s.pairRedistributor.UpdateThreshold(pairTotal, s.bucketsLen)
 	bucketStatus := s.pairRedistributor.CheckBucketStatus(pairTotal, bucketSize)
+	if s.opts.backgroundRehash {
+		// 只有能够单独计算目标数量的再分布器才支持后台再散列
+		if planner, ok := s.pairRedistributor.(redistributionPlanner); ok {
+			if newNumber, changed := planner.planRedistribution(bucketStatus, uint64(s.bucketsLen)); changed {
+				s.startRehash(int(newNumber))
+			}
+			return nil
+		}
+	}
+	var start time.Time
+	if s.opts.redistributionCounter != nil {
+		start = time.Now()
+	}
 	newBuckets, changed := s.pairRedistributor.Redistribe(bucketStatus, s.buckets)
 	if changed {
 		s.buckets = newBuckets
 		s.bucketsLen = len(s.buckets)
+		s.bucketsView.Store(newBuckets)
+		if s.opts.redistributionCounter != nil {
+			s.opts.redistributionCounter.record(pairTotal, true, start)
+		}
 	}
 
 	return nil
 }
 
+// 用于在再分布改变了散列桶数量后调用回调
+// 注意！不能在互斥锁的保护下调用该方法
+func (s *segment) notifyRedistribute(oldBuckets, newBuckets int) {
+	if oldBuckets == newBuckets || s.opts.redistributeHook == nil {
+		return
+	}
+	s.opts.invokeCallback(func() {
+		s.opts.redistributeHook(s.index, oldBuckets, newBuckets)
+	})
+}
+
 func (s *segment) Put(p Pair) (bool, error) {
 	s.lock.Lock()
-	b := s.buckets[int(p.Hash()%uint64(s.bucketsLen))]
+	oldBuckets := s.bucketsLen
+	ok, err := s.put(p)
+	newBuckets := s.bucketsLen
+	s.lock.Unlock()
+	s.notifyRedistribute(oldBuckets, newBuckets)
+	return ok, err
+}
+
+// 用于放入一个键值对，并在必要时进行再分布
+// 注意！必须在互斥锁的保护下调用该方法
+func (s *segment) put(p Pair) (bool, error) {
+	// 散列值不一致的键值对会被放入错误的散列桶，之后按键再也找不到它
+	if s.opts.hash(p.Key()) != p.Hash() {
+		return false, newForeignPairError(p)
+	}
+	b := s.bucketOf(p.Hash())
+	var interned bool
+	if s.opts.keyInterner != nil {
+		// 只有新键会被放入，此时键值对尚未被其他 goroutine 看到，可以安全地替换其键
+		// 已存在的键只会更新元素，传入的键值对会被丢弃，因此不占用引用计数
+		if pp, ok := p.(*pair); ok && b.Get(pp.key) == nil {
+			pp.key = s.opts.keyInterner.intern(pp.key)
+			interned = true
+		}
+	}
+	var chainLenBefore uint64
+	if s.opts.collisionObserver != nil {
+		chainLenBefore = b.Size()
+	}
 	ok, err := b.Put(p, nil)
+	if interned && !ok {
+		s.opts.keyInterner.release(p.Key())
+	}
+	if err == nil {
+		if ok {
+			s.recordMutation(p.Key(), MUTATION_OP_INSERT)
+		} else {
+			s.recordMutation(p.Key(), MUTATION_OP_UPDATE)
+		}
+	}
 	if ok {
-		newTotal := atomic.AddUint64(&s.pairTotal, 1)
-		s.redistribute(newTotal, b.Size())
+		if s.opts.collisionObserver != nil && chainLenBefore > 0 {
+			// 在再分布之前调用，使散列桶索引对应的是键被放入时所在的散列桶
+			index := s.bucketIndexOf(p.Hash())
+			s.opts.invokeCallback(func() {
+				s.opts.collisionObserver(p.Key(), index, int(chainLenBefore))
+			})
+		}
+		if chs, found := s.waiters[p.Key()]; found {
+			for _, ch := range chs {
+				close(ch)
+			}
+			delete(s.waiters, p.Key())
+		}
+		if s.opts.prefixIndex != nil {
+			s.opts.prefixIndex.insert(p.Key())
+		}
+		if s.opts.insertionOrder != nil {
+			s.opts.insertionOrder.append(p.Key())
+		}
+		atomic.AddUint64(&s.pairTotal, 1)
+		s.redistribute(b.Size())
+		atomic.AddUint64(&s.modCount, 1)
 	}
-	s.lock.Unlock()
 	return ok, err
 }
 
+func (s *segment) GetOrPut(p Pair) (Pair, bool, error) {
+	s.lock.Lock()
+	b := s.bucketOf(p.Hash())
+	if actual := b.Get(p.Key()); actual != nil {
+		s.lock.Unlock()
+		return actual, true, nil
+	}
+	oldBuckets := s.bucketsLen
+	_, err := s.put(p)
+	newBuckets := s.bucketsLen
+	s.lock.Unlock()
+	s.notifyRedistribute(oldBuckets, newBuckets)
+	if err != nil {
+		return nil, false, err
+	}
+	return p, false, nil
+}
+
 func (s *segment) Get(key string) Pair {
-	return s.GetWithHash(key, hash(key))
+	return s.GetWithHash(key, s.opts.hash(key))
 }
 
+// GetWithHash 在 DELETE_MODE_COPY_FREE 模式下会在读锁的保护下遍历链表，
+// 使读到的链表总是当前的链表，而不会读到刚被原地删除的键值对，读操作之间不会互相阻塞
 func (s *segment) GetWithHash(key string, keyHash uint64) Pair {
+	s.lock.RLock()
+	b := s.bucketOf(keyHash)
+	if s.opts.deleteMode == DELETE_MODE_COPY_FREE {
+		defer s.lock.RUnlock()
+		return b.Get(key)
+	}
+	s.lock.RUnlock()
+	return b.Get(key)
+}
+
+// depthLimitedGetter 代表能够限制查找时访问的键值对数量的散列段。
+// WithMaxLookupDepth 依赖它使 Get 在过长的链表上提前停止。
+type depthLimitedGetter interface {
+	getWithHashAndDepth(key string, keyHash uint64, maxDepth int) (Pair, bool)
+}
+
+// getWithHashAndDepth 与 GetWithHash 相同，但最多只访问链表中的 maxDepth 个键值对
+// 第二个返回值表示是否因为达到 maxDepth 而在找到键之前停止
+func (s *segment) getWithHashAndDepth(key string, keyHash uint64, maxDepth int) (Pair, bool) {
+	s.lock.RLock()
+	b := s.bucketOf(keyHash)
+	if s.opts.deleteMode == DELETE_MODE_COPY_FREE {
+		defer s.lock.RUnlock()
+		return getWithDepth(b, key, maxDepth)
+	}
+	s.lock.RUnlock()
+	return getWithDepth(b, key, maxDepth)
+}
+
+// getWithDepth 用于在散列桶的链表的前 maxDepth 个键值对中查找键
+// 第二个返回值表示链表中是否还有未访问的键值对
+func getWithDepth(b Bucket, key string, maxDepth int) (Pair, bool) {
+	v := b.GetFirstPair()
+	for n := 0; v != nil && n < maxDepth; v, n = v.Next(), n+1 {
+		if v.Key() == key {
+			return v, false
+		}
+	}
+	return nil, v != nil
+}
+
+func (s *segment) LocateBucketWithHash(keyHash uint64) (Bucket, int, int) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	buckets := s.buckets
+	if s.rehashTarget != nil && int(keyHash%uint64(s.bucketsLen)) < s.rehashIndex {
+		buckets = s.rehashTarget
+	}
+	index := int(keyHash % uint64(len(buckets)))
+	return buckets[index], index, len(buckets)
+}
+
+// GetStaleWithHash 读取的是散列桶切片的快照，
+// 再分布会清空并重新填充散列桶，因此期间可能读不到键值对，但读到的键值对总是完整的
+func (s *segment) GetStaleWithHash(key string, keyHash uint64) Pair {
+	buckets := s.bucketsView.Load().([]Bucket)
+	return buckets[int(keyHash%uint64(len(buckets)))].Get(key)
+}
+
+func (s *segment) Watch(key string, register bool) (Pair, <-chan struct{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if p := s.bucketOf(s.opts.hash(key)).Get(key); p != nil {
+		return p, nil
+	}
+	if !register {
+		return nil, nil
+	}
+	ch := make(chan struct{})
+	if s.waiters == nil {
+		s.waiters = make(map[string][]chan struct{})
+	}
+	s.waiters[key] = append(s.waiters[key], ch)
+	return nil, ch
+}
+
+func (s *segment) Unwatch(key string, ch <-chan struct{}) {
 	s.lock.Lock()
-	b := s.buckets[int(keyHash%uint64(s.bucketsLen))]
+	s.removeWaiter(key, ch)
 	s.lock.Unlock()
-	return b.Get(key)
 }
 
-func (s *segment) Delete(key string) bool {
+func (s *segment) WakeWatchers() {
 	s.lock.Lock()
-	b := s.buckets[int(hash(key)%uint64(s.bucketsLen))]
-	ok := b.Delete(key, nil)
-	if ok {
-		newTotal := atomic.AddUint64(&s.pairTotal, ^uint64(0))
-		s.redistribute(newTotal, b.Size())
+	for _, chs := range s.waiters {
+		for _, ch := range chs {
+			close(ch)
+		}
 	}
+	s.waiters = nil
 	s.lock.Unlock()
+}
 
+// 用于注销等待键被放入的通知通道
+// 注意！必须在互斥锁的保护下调用该方法
+func (s *segment) removeWaiter(key string, ch <-chan struct{}) {
+	chs := s.waiters[key]
+	for i, c := range chs {
+		if c == ch {
+			chs = append(chs[:i], chs[i+1:]...)
+			break
+		}
+	}
+	if len(chs) == 0 {
+		delete(s.waiters, key)
+	} else {
+		s.waiters[key] = chs
+	}
+}
+
+func (s *segment) GetBucketWithHash(keyHash uint64) Bucket {
+	s.lock.RLock()
+	b := s.bucketOf(keyHash)
+	s.lock.RUnlock()
+	return b
+}
+
+func (s *segment) CompareVersionAndSwap(key string, expectedVersion uint64, element interface{}) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	p := s.bucketOf(s.opts.hash(key)).Get(key)
+	if p == nil || p.Version() != expectedVersion {
+		return false, nil
+	}
+	if err := p.SetElement(element); err != nil {
+		return false, err
+	}
+	if s.opts.elementChecksum != nil {
+		p.SetChecksum(s.opts.elementChecksum(element))
+	}
+	s.recordMutation(key, MUTATION_OP_UPDATE)
+	return true, nil
+}
+
+func (s *segment) Reserve(key string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.reserved[key]; ok {
+		return false
+	}
+	if s.bucketOf(s.opts.hash(key)).Get(key) != nil {
+		return false
+	}
+	if s.reserved == nil {
+		s.reserved = make(map[string]struct{})
+	}
+	s.reserved[key] = struct{}{}
+	return true
+}
+
+func (s *segment) Commit(p Pair) (bool, error) {
+	s.lock.Lock()
+	delete(s.reserved, p.Key())
+	oldBuckets := s.bucketsLen
+	ok, err := s.put(p)
+	newBuckets := s.bucketsLen
+	s.lock.Unlock()
+	s.notifyRedistribute(oldBuckets, newBuckets)
+	return ok, err
+}
+
+func (s *segment) CancelReservation(key string) {
+	s.lock.Lock()
+	delete(s.reserved, key)
+	s.lock.Unlock()
+}
+
+func (s *segment) ReservedKeys() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	keys := make([]string, 0, len(s.reserved))
+	for key := range s.reserved {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (s *segment) Delete(key string) bool {
+	_, ok := s.DeleteAndReturn(key)
 	return ok
 }
 
+func (s *segment) DeleteAndReturn(key string) (Pair, bool) {
+	s.lock.Lock()
+	oldBuckets := s.bucketsLen
+	p, ok := s.delete(key)
+	newBuckets := s.bucketsLen
+	s.lock.Unlock()
+	s.notifyRedistribute(oldBuckets, newBuckets)
+
+	return p, ok
+}
+
+// 用于删除一个键值对，并在必要时进行再分布
+// 注意！必须在互斥锁的保护下调用该方法
+func (s *segment) delete(key string) (Pair, bool) {
+	return s.deleteWithHash(key, s.opts.hash(key))
+}
+
+// 与 delete 相同，但在散列值为 keyHash 的散列桶中查找键
+// 用于删除散列值与当前散列函数不一致的键值对
+// 注意！必须在互斥锁的保护下调用该方法
+func (s *segment) deleteWithHash(key string, keyHash uint64) (Pair, bool) {
+	b := s.bucketOf(keyHash)
+	var p Pair
+	var ok bool
+	if deleter, isDeleter := b.(inPlaceDeleter); isDeleter && s.opts.deleteMode == DELETE_MODE_COPY_FREE {
+		p, ok = deleter.deleteInPlace(key)
+	} else {
+		p, ok = b.DeleteAndReturn(key, nil)
+	}
+	if ok {
+		s.recordMutation(key, MUTATION_OP_DELETE)
+		if s.opts.prefixIndex != nil {
+			s.opts.prefixIndex.remove(key)
+		}
+		if s.opts.keyInterner != nil {
+			s.opts.keyInterner.release(key)
+		}
+		if s.opts.insertionOrder != nil {
+			s.opts.insertionOrder.remove(key)
+		}
+		decreaseUint64(&s.pairTotal)
+		s.redistribute(b.Size())
+		atomic.AddUint64(&s.modCount, 1)
+	}
+	return p, ok
+}
+
+// Range 只在获取各散列桶的表头时加锁，遍历链表时不加锁
+// 因此 f 中可以安全地操作当前散列段
+// 放入只会替换表头，删除会拷贝前置节点，所以从取得的表头出发遍历到的
+// 始终是加锁时的链表，遍历期间的再分布和后台再散列不会使键值对被重复访问
+func (s *segment) Range(f func(p Pair) bool) bool {
+	s.lock.RLock()
+	buckets := s.allBuckets()
+	heads := make([]Pair, len(buckets))
+	for i, b := range buckets {
+		heads[i] = b.GetFirstPair()
+	}
+	s.lock.RUnlock()
+	for _, head := range heads {
+		for v, n := head, 0; v != nil && n < MAX_CHAIN_LENGTH; v, n = v.Next(), n+1 {
+			if !f(v) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (s *segment) Clone() map[string]interface{} {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	m := make(map[string]interface{}, s.Size())
+	for _, b := range s.allBuckets() {
+		for v, n := b.GetFirstPair(), 0; v != nil && n < MAX_CHAIN_LENGTH; v, n = v.Next(), n+1 {
+			m[v.Key()] = v.Element()
+		}
+	}
+	return m
+}
+
+func (s *segment) HasCycle() bool {
+	s.lock.RLock()
+	buckets := s.allBuckets()
+	s.lock.RUnlock()
+	for _, b := range buckets {
+		if chainHasCycle(b.GetFirstPair()) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyPlacement 在锁的保护下检查，后台再散列期间会分别检查未迁移的旧散列桶和目标散列桶
+// 同时会用当前的散列函数重新计算散列值，以发现散列值本身与键不符的键值对
+func (s *segment) VerifyPlacement() error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	check := func(buckets []Bucket, from int) error {
+		for i := from; i < len(buckets); i++ {
+			b := buckets[i]
+			for v, n := b.GetFirstPair(), 0; v != nil && n < MAX_CHAIN_LENGTH; v, n = v.Next(), n+1 {
+				if keyHash := s.opts.hash(v.Key()); keyHash != v.Hash() {
+					return newMisplacedPairError(fmt.Sprintf(
+						"key %s has hash %d, but its current hash is %d", v.Key(), v.Hash(), keyHash))
+				}
+				if expected := int(v.Hash() % uint64(len(buckets))); expected != i {
+					return newMisplacedPairError(fmt.Sprintf(
+						"key %s is in bucket %d of segment %d, expected bucket %d", v.Key(), i, s.index, expected))
+				}
+			}
+		}
+		return nil
+	}
+	if s.rehashTarget == nil {
+		return check(s.buckets, 0)
+	}
+	if err := check(s.buckets, s.rehashIndex); err != nil {
+		return err
+	}
+	return check(s.rehashTarget, 0)
+}
+
+// Atomic 使用 defer 释放锁，因此即使 f 发生 panic 也不会使散列段一直被锁住
+func (s *segment) Atomic(f func(tx SegmentTx)) {
+	var oldBuckets, newBuckets int
+	func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		oldBuckets = s.bucketsLen
+		defer func() {
+			newBuckets = s.bucketsLen
+		}()
+		f(segmentTx{s})
+	}()
+	s.notifyRedistribute(oldBuckets, newBuckets)
+}
+
+// 用于表示 SegmentTx 的实现类型
+type segmentTx struct {
+	s *segment
+}
+
+func (tx segmentTx) Get(key string) Pair {
+	s := tx.s
+	return s.bucketOf(s.opts.hash(key)).Get(key)
+}
+
+func (tx segmentTx) Put(p Pair) (bool, error) {
+	return tx.s.put(p)
+}
+
+func (tx segmentTx) Delete(key string) (Pair, bool) {
+	return tx.s.delete(key)
+}
+
+func (tx segmentTx) deleteWithHash(key string, keyHash uint64) (Pair, bool) {
+	return tx.s.deleteWithHash(key, keyHash)
+}
+
+// Range 会先收集所有键值对再调用 f，
+// 因为修改可能引发再分布，而再分布会改变键值对之间的链接
+func (tx segmentTx) Range(f func(p Pair) bool) bool {
+	var pairs []Pair
+	for _, b := range tx.s.allBuckets() {
+		for v, n := b.GetFirstPair(), 0; v != nil && n < MAX_CHAIN_LENGTH; v, n = v.Next(), n+1 {
+			pairs = append(pairs, v)
+		}
+	}
+	for _, p := range pairs {
+		if !f(p) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *segment) OpCount() uint64 {
+	return atomic.LoadUint64(&s.opCount)
+}
+
+func (s *segment) ModCount() uint64 {
+	return atomic.LoadUint64(&s.modCount)
+}
+
 func (s *segment) Size() uint64 {
 	return atomic.LoadUint64(&s.pairTotal)
 }
 
+func (s *segment) BucketNumber() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.bucketsLen
+}
+
 func newSegment(bucketNumber int, pairRedistributor PairRedistributor) Segment {
+	return newSegmentWithOptions(0, bucketNumber, pairRedistributor, newOptions())
+}
+
+// 参数 index 代表散列段在 map 中的索引
+// 参数 opts 代表 map 的可选配置，不能为 nil
+func newSegmentWithOptions(index int, bucketNumber int,
+	pairRedistributor PairRedistributor, opts *options) Segment {
 	if bucketNumber < 0 {
 		bucketNumber = DEFAULT_BUCKET_NUMBER
 	}
 	if pairRedistributor == nil {
-		pairRedistributor = newDefaultPairRedistributor(DEFAULT_BUCKET_LOAD_FACTOR, bucketNumber)
+		pairRedistributor = newDefaultPairRedistributor(opts.loadFactor, bucketNumber)
 	}
 	buckets := make([]Bucket, bucketNumber)
 	for i := 0; i < bucketNumber; i++ {
-		buckets[i] = newBucket()
+		buckets[i] = newBucketOf(opts.bucketImpl)
 	}
 
-	return &segment{
+	s := &segment{
 		buckets:           buckets,
 		bucketsLen:        bucketNumber,
 		pairRedistributor: pairRedistributor,
+		index:             index,
+		opts:              opts,
 	}
+	s.bucketsView.Store(buckets)
+	return s
 }
@@ -2,6 +2,8 @@ package cmap
 
 import (
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -309,3 +311,214 @@ func TestRunParallel(t *testing.T) {
 
 	t.Log("hahahah")
 }
+
+func TestSegmentShrinkAfterDelete(t *testing.T) {
+	number := 5000
+	testCases := genNoRepetitiveTestingPairs(number)
+	s := newSegment(-1, nil).(*segment)
+	for _, p := range testCases {
+		s.Put(p)
+	}
+	grown := s.bucketsLen
+	if grown <= DEFAULT_BUCKET_NUMBER {
+		t.Fatalf("The segment doesn't grow: bucketsLen: %d", grown)
+	}
+	for _, p := range testCases {
+		if !s.Delete(p.Key()) {
+			t.Fatalf("Couldn't delete a pair from the segment! (pair: %#v)", p)
+		}
+	}
+	if s.bucketsLen > DEFAULT_BUCKET_NUMBER*2 {
+		t.Fatalf("The segment doesn't shrink: bucketsLen: %d (grown: %d)", s.bucketsLen, grown)
+	}
+	if s.bucketsLen < DEFAULT_BUCKET_NUMBER {
+		t.Fatalf("The segment shrinks too much: bucketsLen: %d", s.bucketsLen)
+	}
+	// 收缩后仍然可以正常使用
+	for _, p := range testCases[:100] {
+		s.Put(p)
+		if s.Get(p.Key()) == nil {
+			t.Fatalf("Not found pair %s after shrinking!", p.Key())
+		}
+	}
+}
+
+// assertUniqueKeys 用于检查 Range 访问到的键没有重复，且数量等于 Len
+func assertUniqueKeys(t *testing.T, cm ConcurrentMap) {
+	seen := make(map[string]struct{})
+	cm.Range(func(key string, element interface{}) bool {
+		if _, ok := seen[key]; ok {
+			t.Fatalf("Duplicate key in range: %s", key)
+		}
+		seen[key] = struct{}{}
+		return true
+	})
+	if uint64(len(seen)) != cm.Len() {
+		t.Fatalf("Inconsistent key count: expected: %d, actual: %d", cm.Len(), len(seen))
+	}
+}
+
+func TestSegmentRedistributeChains(t *testing.T) {
+	number := 5000
+	cm, _ := NewConcurrentMap(DEFAULT_CONCURRENCY, nil)
+	for i := 0; i < number; i++ {
+		cm.Put(fmt.Sprintf("key-%d", i), i)
+	}
+	assertUniqueKeys(t, cm)
+	if keys := cm.Keys(); len(keys) != number {
+		t.Fatalf("Inconsistent key count: expected: %d, actual: %d", number, len(keys))
+	}
+	for i := 0; i < number; i++ {
+		cm.Delete(fmt.Sprintf("key-%d", i))
+	}
+	for i := 0; i < number; i++ {
+		if element := cm.Get(fmt.Sprintf("key-%d", i)); element != nil {
+			t.Fatalf("Deleted key-%d is still found after growing: %v", i, element)
+		}
+	}
+	assertUniqueKeys(t, cm)
+
+	// 单个散列段先扩容再收缩
+	number = 20000
+	cm, _ = NewConcurrentMap(1, nil)
+	for i := 0; i < number; i++ {
+		cm.Put(fmt.Sprintf("key-%d", i), i)
+	}
+	assertUniqueKeys(t, cm)
+	left := 10
+	for i := left; i < number; i++ {
+		cm.Delete(fmt.Sprintf("key-%d", i))
+	}
+	for i := 0; i < number; i++ {
+		element := cm.Get(fmt.Sprintf("key-%d", i))
+		if i < left && element != i {
+			t.Fatalf("Inconsistent element of key-%d: expected: %v, actual: %v", i, i, element)
+		}
+		if i >= left && element != nil {
+			t.Fatalf("Deleted key-%d is still found after shrinking: %v", i, element)
+		}
+	}
+	assertUniqueKeys(t, cm)
+	if clone := cm.(*myConcurrentMap).getSegments()[0].Clone(); len(clone) != left {
+		t.Fatalf("Inconsistent clone size: expected: %d, actual: %d", left, len(clone))
+	}
+	data, _ := cm.MarshalBinary()
+	restored, _ := NewConcurrentMap(1, nil)
+	if err := restored.UnmarshalBinary(data); err != nil || restored.Len() != uint64(left) {
+		t.Fatalf("Inconsistent restored length: expected: %d, actual: %d (error: %v)", left, restored.Len(), err)
+	}
+}
+
+func TestSegmentRejectForeignPair(t *testing.T) {
+	src, _ := NewConcurrentMap(1, nil, WithHashSeed(1))
+	dst, _ := NewConcurrentMap(1, nil, WithHashSeed(2))
+	src.Put("key", "element")
+	foreign := src.(*myConcurrentMap).getSegments()[0].Get("key")
+	s := dst.(*myConcurrentMap).getSegments()[0]
+	assertForeign := func(err error) {
+		if err == nil {
+			t.Fatal("No error when putting a pair created under another seed!")
+		}
+		if _, ok := err.(ForeignPairError); !ok {
+			t.Fatalf("Inconsistent error type: expected: %T, actual: %T", ForeignPairError{}, err)
+		}
+	}
+	_, err := s.Put(foreign.Copy())
+	assertForeign(err)
+	_, _, err = s.GetOrPut(foreign.Copy())
+	assertForeign(err)
+	s.Atomic(func(tx SegmentTx) {
+		_, err = tx.Put(foreign.Copy())
+	})
+	assertForeign(err)
+	if size := s.Size(); size != 0 {
+		t.Fatalf("Inconsistent segment size: expected: %d, actual: %d", 0, size)
+	}
+	if dst.Get("key") != nil {
+		t.Fatal("The foreign pair is found in the map!")
+	}
+	// 相同散列函数创建的键值对可以放入
+	p, _ := newPairWithHash("key", dst.(*myConcurrentMap).opts.hash("key"), "element")
+	if ok, err := s.Put(p); !ok || err != nil {
+		t.Fatalf("Couldn't put the pair created under the same seed: %v", err)
+	}
+}
+
+// assertSegmentConsistent 用于断言散列段的键值对总数与散列桶一致，且键值对都在其散列值对应的散列桶中
+func assertSegmentConsistent(t *testing.T, s *segment) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.bucketsLen != len(s.buckets) {
+		t.Fatalf("Inconsistent bucket number: expected: %d, actual: %d", len(s.buckets), s.bucketsLen)
+	}
+	var sizes, walked uint64
+	for i, b := range s.buckets {
+		sizes += b.Size()
+		for v := b.GetFirstPair(); v != nil; v = v.Next() {
+			if index := int(v.Hash() % uint64(s.bucketsLen)); index != i {
+				t.Fatalf("Inconsistent bucket of key %s: expected: %d, actual: %d", v.Key(), index, i)
+			}
+			walked++
+		}
+	}
+	if total := atomic.LoadUint64(&s.pairTotal); total != sizes || total != walked {
+		t.Fatalf("Inconsistent pair total: expected: %d (walked: %d), actual: %d", sizes, walked, total)
+	}
+}
+
+func TestSegmentPairTotalConsistency(t *testing.T) {
+	number, workers := 2000, 16
+	hammer := func(put func(p Pair), del func(key string)) {
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < number; i++ {
+					p, _ := newPair(fmt.Sprintf("key-%d-%d", w, i), i)
+					put(p)
+					if i%3 == 0 {
+						del(fmt.Sprintf("key-%d-%d", w, i/2))
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+	}
+
+	s := newSegment(DEFAULT_BUCKET_NUMBER, nil)
+	hammer(func(p Pair) { s.Put(p) }, func(key string) { s.Delete(key) })
+	assertSegmentConsistent(t, s.(*segment))
+	if s.BucketNumber() == DEFAULT_BUCKET_NUMBER {
+		t.Fatalf("No redistribution of the segment with %d pairs!", s.Size())
+	}
+
+	// 所有散列段共用调用方提供的再分布器
+	cm, _ := NewConcurrentMap(4, newDefaultPairRedistributor(DEFAULT_BUCKET_LOAD_FACTOR, DEFAULT_BUCKET_NUMBER))
+	hammer(func(p Pair) { cm.Put(p.Key(), p.Element()) }, func(key string) { cm.Delete(key) })
+	var total uint64
+	for _, s := range cm.(*myConcurrentMap).getSegments() {
+		assertSegmentConsistent(t, s.(*segment))
+		total += s.Size()
+	}
+	if total != cm.Len() {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", total, cm.Len())
+	}
+}
+
+func TestPairRedistributorUnderweightOverflow(t *testing.T) {
+	// 上阈限与散列桶数量之积超出 uint64 的范围
+	pr := &myPairRedistributor{
+		upperThreshold:  1 << 40,
+		bucketNumber:    1 << 30,
+		minBucketNumber: uint64(DEFAULT_BUCKET_NUMBER),
+	}
+	if status := pr.CheckBucketStatus(1000, 1); status != BUCKET_STATUS_UNDERWEIGHT {
+		t.Fatalf("Inconsistent bucket status: expected: %d, actual: %d", BUCKET_STATUS_UNDERWEIGHT, status)
+	}
+	// 键值对总数的四倍超出 uint64 的范围
+	pr.upperThreshold = 1 << 33
+	if status := pr.CheckBucketStatus(1<<62, 1); status != BUCKET_STATUS_NORMAL {
+		t.Fatalf("Inconsistent bucket status: expected: %d, actual: %d", BUCKET_STATUS_NORMAL, status)
+	}
+}
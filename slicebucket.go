@@ -0,0 +1,131 @@
+package cmap
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// BucketImpl 代表散列桶的实现方式。
+type BucketImpl uint8
+
+const (
+	// BUCKET_IMPL_LIST 代表以单链表存放键值对的散列桶，也是默认的实现。
+	BUCKET_IMPL_LIST BucketImpl = 0
+	// BUCKET_IMPL_SLICE 代表以写时复制的切片存放键值对的散列桶。
+	BUCKET_IMPL_SLICE BucketImpl = 1
+)
+
+// bucketIndex 代表切片散列桶中键值对的只读快照
+// keys 与 pairs 一一对应，单独存放键是为了在查找时连续地比较
+type bucketIndex struct {
+	keys  []string
+	pairs []Pair
+}
+
+var emptyBucketIndex = &bucketIndex{}
+
+// sliceBucket 代表以写时复制的切片加速查找的散列桶
+// 键值对仍然组成与 bucket 相同的链表，以便通过 GetFirstPair 遍历，
+// 每次修改后会在锁的保护下根据链表重建切片快照，Get 只读取快照，不需要加锁
+type sliceBucket struct {
+	bucket
+	index atomic.Value
+}
+
+func (b *sliceBucket) Put(p Pair, lock sync.Locker) (bool, error) {
+	if lock != nil {
+		lock.Lock()
+		defer lock.Unlock()
+	}
+	ok, err := b.bucket.Put(p, nil)
+	if ok {
+		b.rebuildIndex()
+	}
+	return ok, err
+}
+
+func (b *sliceBucket) Delete(key string, lock sync.Locker) bool {
+	_, ok := b.DeleteAndReturn(key, lock)
+	return ok
+}
+
+func (b *sliceBucket) DeleteAndReturn(key string, lock sync.Locker) (Pair, bool) {
+	if lock != nil {
+		lock.Lock()
+		defer lock.Unlock()
+	}
+	target, ok := b.bucket.DeleteAndReturn(key, nil)
+	if ok {
+		// 删除时前置节点都被拷贝过了，因此需要重建整个快照
+		b.rebuildIndex()
+	}
+	return target, ok
+}
+
+func (b *sliceBucket) deleteInPlace(key string) (Pair, bool) {
+	target, ok := b.bucket.deleteInPlace(key)
+	if ok {
+		b.rebuildIndex()
+	}
+	return target, ok
+}
+
+func (b *sliceBucket) Get(key string) Pair {
+	index := b.index.Load().(*bucketIndex)
+	for i, k := range index.keys {
+		if k == key {
+			return index.pairs[i]
+		}
+	}
+	return nil
+}
+
+func (b *sliceBucket) Clear(lock sync.Locker) {
+	if lock != nil {
+		lock.Lock()
+		defer lock.Unlock()
+	}
+	b.bucket.Clear(nil)
+	b.index.Store(emptyBucketIndex)
+}
+
+// rebuildIndex 用于根据链表重建切片快照
+// 注意！必须在锁的保护下调用该方法
+func (b *sliceBucket) rebuildIndex() {
+	n := int(b.bucket.Size())
+	index := &bucketIndex{
+		keys:  make([]string, 0, n),
+		pairs: make([]Pair, 0, n),
+	}
+	for v, n := b.GetFirstPair(), 0; v != nil && n < MAX_CHAIN_LENGTH; v, n = v.Next(), n+1 {
+		index.keys = append(index.keys, v.Key())
+		index.pairs = append(index.pairs, v)
+	}
+	b.index.Store(index)
+}
+
+func newSliceBucket() Bucket {
+	b := &sliceBucket{}
+	b.firstValue.Store(placeholder)
+	b.index.Store(emptyBucketIndex)
+	return b
+}
+
+// newBucketOf 会创建一个给定实现方式的散列桶
+func newBucketOf(impl BucketImpl) Bucket {
+	if impl == BUCKET_IMPL_SLICE {
+		return newSliceBucket()
+	}
+	return newBucket()
+}
+
+// newBucketLike 会创建一个与 buckets 中的散列桶实现方式相同的散列桶
+// 用于不知道 map 配置的散列桶再分布器
+func newBucketLike(buckets []Bucket) Bucket {
+	if len(buckets) > 0 {
+		if _, ok := buckets[0].(*sliceBucket); ok {
+			return newSliceBucket()
+		}
+	}
+	return newBucket()
+}
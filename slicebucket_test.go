@@ -0,0 +1,154 @@
+package cmap
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// bucketImpls 代表需要通过 Bucket 接口测试的全部散列桶实现。
+var bucketImpls = []struct {
+	name string
+	impl BucketImpl
+}{
+	{"List", BUCKET_IMPL_LIST},
+	{"Slice", BUCKET_IMPL_SLICE},
+}
+
+func TestBucketImplPutGetDelete(t *testing.T) {
+	number := 30
+	for _, bi := range bucketImpls {
+		t.Run(bi.name, func(t *testing.T) {
+			testCases := genNoRepetitiveTestingPairs(number)
+			b := newBucketOf(bi.impl)
+			for _, p := range testCases {
+				if ok, err := b.Put(p, nil); err != nil || !ok {
+					t.Fatalf("Couldn't put pair to the bucket! (pair: %#v, error: %v)", p, err)
+				}
+			}
+			if b.Size() != uint64(number) {
+				t.Fatalf("Inconsistent size: expected: %d, actual: %d", number, b.Size())
+			}
+			p0 := testCases[0]
+			replacement, _ := newPair(p0.Key(), "replaced")
+			if ok, _ := b.Put(replacement, nil); ok {
+				t.Fatalf("Couldn't replace the element of key %q!", p0.Key())
+			}
+			if e := b.Get(p0.Key()).Element(); e != "replaced" {
+				t.Fatalf("Inconsistent element: expected: %v, actual: %v", "replaced", e)
+			}
+			for i, p := range testCases {
+				if i%2 == 0 {
+					if !b.Delete(p.Key(), nil) {
+						t.Fatalf("Couldn't delete key %q!", p.Key())
+					}
+				}
+			}
+			for i, p := range testCases {
+				actual := b.Get(p.Key())
+				if i%2 == 0 && actual != nil {
+					t.Fatalf("Inconsistent pair: expected: %v, actual: %v", nil, actual)
+				}
+				if i%2 == 1 && (actual == nil || actual.Element() != p.Element()) {
+					t.Fatalf("Inconsistent pair: expected: %v, actual: %v", p, actual)
+				}
+			}
+			var count int
+			for v := b.GetFirstPair(); v != nil; v = v.Next() {
+				count++
+			}
+			if count != number/2 || b.Size() != uint64(number/2) {
+				t.Fatalf("Inconsistent size: expected: %d, actual: %d (chain: %d)",
+					number/2, b.Size(), count)
+			}
+			b.Clear(nil)
+			if b.Size() != 0 || b.GetFirstPair() != nil || b.Get(testCases[1].Key()) != nil {
+				t.Fatalf("Couldn't clear the bucket! (bucket: %s)", b)
+			}
+		})
+	}
+}
+
+func TestBucketImplGetDuringWrites(t *testing.T) {
+	number := 30
+	for _, bi := range bucketImpls {
+		t.Run(bi.name, func(t *testing.T) {
+			stable := genNoRepetitiveTestingPairs(number)
+			b := newBucketOf(bi.impl)
+			lock := new(sync.Mutex)
+			for _, p := range stable {
+				b.Put(p, lock)
+			}
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 200; i++ {
+					p, _ := newPair(fmt.Sprintf("extra-%d", i), i)
+					b.Put(p, lock)
+					b.Delete(p.Key(), lock)
+				}
+			}()
+			for i := 0; i < 200; i++ {
+				p := stable[i%number]
+				if actual := b.Get(p.Key()); actual == nil || actual.Element() != p.Element() {
+					t.Fatalf("Inconsistent pair: expected: %v, actual: %v", p, actual)
+				}
+			}
+			wg.Wait()
+			if b.Size() != uint64(number) {
+				t.Fatalf("Inconsistent size: expected: %d, actual: %d", number, b.Size())
+			}
+		})
+	}
+}
+
+func TestOptionBucketImpl(t *testing.T) {
+	number := 2000
+	cm, _ := NewConcurrentMap(2, nil, WithBucketImpl(BUCKET_IMPL_SLICE))
+	for i := 0; i < number; i++ {
+		cm.Put(fmt.Sprintf("key-%d", i), i)
+	}
+	for _, s := range cm.(*myConcurrentMap).segments.Load().([]Segment) {
+		for _, b := range s.(*segment).buckets {
+			if _, ok := b.(*sliceBucket); !ok {
+				t.Fatalf("Inconsistent bucket type: expected: %T, actual: %T", &sliceBucket{}, b)
+			}
+		}
+	}
+	for i := 0; i < number; i += 2 {
+		cm.Delete(fmt.Sprintf("key-%d", i))
+	}
+	for i := 0; i < number; i++ {
+		e := cm.Get(fmt.Sprintf("key-%d", i))
+		if i%2 == 0 && e != nil {
+			t.Fatalf("Inconsistent element: expected: %v, actual: %v", nil, e)
+		}
+		if i%2 == 1 && e != i {
+			t.Fatalf("Inconsistent element: expected: %v, actual: %v", i, e)
+		}
+	}
+	if cm.Len() != uint64(number/2) {
+		t.Fatalf("Inconsistent length: expected: %d, actual: %d", number/2, cm.Len())
+	}
+}
+
+func BenchmarkBucketImplGet(b *testing.B) {
+	number := 8
+	testCases := genNoRepetitiveTestingPairs(number)
+	for _, bi := range bucketImpls {
+		bucket := newBucketOf(bi.impl)
+		for _, p := range testCases {
+			bucket.Put(p, nil)
+		}
+		b.Run(bi.name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				var i int
+				for pb.Next() {
+					bucket.Get(testCases[i%number].Key())
+					i++
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package cmap
+
+// SnapshotAndReset 持有 resizeLock 的读锁，逐个散列段地在其锁的保护下复制并重置所有键值对
+// 同一散列段中的复制和重置之间不会有其他写操作，因此快照中的值与重置之后的写入不会重复计算
+// 不同散列段的快照不是同一时刻的，但每个键的值都只会出现在一次快照中
+func (c *myConcurrentMap) SnapshotAndReset(
+	reset func(key string, element interface{}) interface{}) map[string]interface{} {
+	if reset == nil {
+		return nil
+	}
+	var evicted []Pair
+	// 在释放 resizeLock 之后调用
+	defer func() {
+		c.notifyEvicted(evicted)
+	}()
+	if err := c.lockForWrite(); err != nil {
+		return nil
+	}
+	defer c.resizeLock.RUnlock()
+	snapshot := make(map[string]interface{})
+	for _, s := range c.getSegments() {
+		s.Atomic(func(tx SegmentTx) {
+			var deleted []string
+			tx.Range(func(p Pair) bool {
+				element, err := c.decodeElement(p.Element())
+				if err != nil || element == nil {
+					return true
+				}
+				var zeroed interface{}
+				if !c.opts.invokeCallback(func() {
+					zeroed = reset(p.Key(), element)
+				}) {
+					return true
+				}
+				snapshot[p.Key()] = element
+				if zeroed == nil {
+					deleted = append(deleted, p.Key())
+					return true
+				}
+				encoded, err := c.encodeElement(zeroed)
+				if err != nil || p.SetElement(encoded) != nil {
+					return true
+				}
+				if c.opts.elementChecksum != nil {
+					p.SetChecksum(c.opts.elementChecksum(encoded))
+				}
+				c.opts.recordMutation(p.Key(), MUTATION_OP_UPDATE)
+				return true
+			})
+			for _, key := range deleted {
+				if p, ok := tx.Delete(key); ok {
+					decreaseUint64(&c.total)
+					evicted = append(evicted, p)
+				}
+			}
+		})
+	}
+	return snapshot
+}
@@ -0,0 +1,103 @@
+package cmap
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestCmapSnapshotAndReset(t *testing.T) {
+	var evicted []string
+	cm, _ := NewConcurrentMap(4, nil, WithOnEvict(func(key string, element interface{}) {
+		evicted = append(evicted, key)
+	}))
+	number := 50
+	for i := 0; i < number; i++ {
+		cm.Put(fmt.Sprintf("counter-%d", i), i+1)
+	}
+	cm.Put("gauge", "temporary")
+	cm.Put("taken", 1)
+	cm.TakeElement("taken")
+	zero := func(key string, element interface{}) interface{} {
+		if _, ok := element.(int); ok {
+			return 0
+		}
+		return nil
+	}
+	snapshot := cm.SnapshotAndReset(zero)
+	if len(snapshot) != number+1 {
+		t.Fatalf("Inconsistent snapshot size: expected: %d, actual: %d", number+1, len(snapshot))
+	}
+	for i := 0; i < number; i++ {
+		key := fmt.Sprintf("counter-%d", i)
+		if snapshot[key] != i+1 {
+			t.Fatalf("Inconsistent snapshot of %s: expected: %v, actual: %v", key, i+1, snapshot[key])
+		}
+		if element := cm.Get(key); element != 0 {
+			t.Fatalf("Inconsistent element of %s after reset: expected: %v, actual: %v", key, 0, element)
+		}
+	}
+	// reset 返回 nil 的键被删除
+	if snapshot["gauge"] != "temporary" || cm.Contains("gauge") {
+		t.Fatalf("Inconsistent gauge: snapshot: %v, still exists: %v", snapshot["gauge"], cm.Contains("gauge"))
+	}
+	if len(evicted) != 1 || evicted[0] != "gauge" {
+		t.Fatalf("Inconsistent evicted keys: expected: %v, actual: %v", []string{"gauge"}, evicted)
+	}
+	if _, ok := snapshot["taken"]; ok {
+		t.Fatal("The taken key is in the snapshot!")
+	}
+	if cm.Len() != uint64(number+1) {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", number+1, cm.Len())
+	}
+	if snapshot := cm.SnapshotAndReset(nil); snapshot != nil {
+		t.Fatalf("Inconsistent snapshot with a nil reset: expected: <nil>, actual: %v", snapshot)
+	}
+}
+
+func TestCmapSnapshotAndResetInParallel(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil)
+	increment := func(old interface{}, exists bool) interface{} {
+		if !exists {
+			return 1
+		}
+		return old.(int) + 1
+	}
+	keys, workers, number := 8, 8, 500
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < number; i++ {
+				cm.GetAndUpdate(fmt.Sprintf("counter-%d", (w+i)%keys), increment)
+			}
+		}(w)
+	}
+	// 每次快照取出的都是上次重置之后的增量，累加起来不会丢失或重复
+	var flushed int
+	flush := func() {
+		for _, element := range cm.SnapshotAndReset(func(key string, element interface{}) interface{} {
+			return 0
+		}) {
+			flushed += element.(int)
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for {
+		select {
+		case <-done:
+			flush()
+			if flushed != workers*number {
+				t.Fatalf("Inconsistent flushed total: expected: %d, actual: %d", workers*number, flushed)
+			}
+			return
+		default:
+			flush()
+		}
+	}
+}
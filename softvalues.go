@@ -0,0 +1,43 @@
+package cmap
+
+import "time"
+
+// ReclaimSoftValues 会逐个散列段地检查键值对，
+// 在散列段的锁的保护下删除闲置时间超过阈值的键值对，直到键值对数量不再超过阈值
+// 删除前会重新检查最近使用时间，因此不会删除刚刚被使用过的键值对
+func (c *myConcurrentMap) ReclaimSoftValues() int {
+	if !c.opts.softValues {
+		return 0
+	}
+	var evicted []Pair
+	// 在释放 resizeLock 之后调用
+	defer func() {
+		c.notifyEvicted(evicted)
+	}()
+	if err := c.lockForWrite(); err != nil {
+		return 0
+	}
+	defer c.resizeLock.RUnlock()
+	deadline := time.Now().Add(-c.opts.softMaxAge).UnixNano()
+	underPressure := func() bool {
+		return c.opts.softMaxEntries == 0 || c.Len() > c.opts.softMaxEntries
+	}
+	for _, s := range c.getSegments() {
+		if !underPressure() {
+			break
+		}
+		s.Atomic(func(tx SegmentTx) {
+			tx.Range(func(p Pair) bool {
+				if p.Touched() >= deadline {
+					return true
+				}
+				if reclaimed, ok := tx.Delete(p.Key()); ok {
+					decreaseUint64(&c.total)
+					evicted = append(evicted, reclaimed)
+				}
+				return underPressure()
+			})
+		})
+	}
+	return len(evicted)
+}
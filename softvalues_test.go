@@ -0,0 +1,55 @@
+package cmap
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCmapReclaimSoftValues(t *testing.T) {
+	maxAge := 20 * time.Millisecond
+	cm, _ := NewConcurrentMap(4, nil,
+		WithSoftValues(true), WithSoftValuePolicy(maxAge, 5))
+	number := 10
+	for i := 0; i < number; i++ {
+		cm.Put(fmt.Sprintf("key-%d", i), i)
+	}
+	if reclaimed := cm.ReclaimSoftValues(); reclaimed != 0 {
+		t.Fatalf("Inconsistent reclaimed count: expected: %d, actual: %d", 0, reclaimed)
+	}
+	time.Sleep(2 * maxAge)
+	// 最近使用过的键值对不应被回收
+	cm.Get("key-0")
+	cm.Put("key-1", "new")
+	reclaimed := cm.ReclaimSoftValues()
+	if reclaimed != number-5 {
+		t.Fatalf("Inconsistent reclaimed count: expected: %d, actual: %d", number-5, reclaimed)
+	}
+	if cm.Len() != 5 {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d", 5, cm.Len())
+	}
+	if cm.Get("key-0") == nil || cm.Get("key-1") != "new" {
+		t.Fatal("A recently used pair is reclaimed!")
+	}
+	// 未超过数量阈值时不回收
+	time.Sleep(2 * maxAge)
+	if reclaimed := cm.ReclaimSoftValues(); reclaimed != 0 {
+		t.Fatalf("Inconsistent reclaimed count: expected: %d, actual: %d", 0, reclaimed)
+	}
+}
+
+func TestCmapReclaimSoftValuesDisabled(t *testing.T) {
+	cm, _ := NewConcurrentMap(4, nil, WithSoftValuePolicy(time.Nanosecond, 0))
+	cm.Put("key", "element")
+	time.Sleep(time.Millisecond)
+	if reclaimed := cm.ReclaimSoftValues(); reclaimed != 0 {
+		t.Fatalf("Inconsistent reclaimed count: expected: %d, actual: %d", 0, reclaimed)
+	}
+	if cm.Get("key") != "element" {
+		t.Fatal("A pair is reclaimed when soft values are disabled!")
+	}
+	p := cm.(*myConcurrentMap).findSegment(hash("key")).Get("key")
+	if p.Touched() != 0 {
+		t.Fatalf("Inconsistent touched time: expected: %d, actual: %d", 0, p.Touched())
+	}
+}
@@ -0,0 +1,60 @@
+package cmap
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// RedistributionStats 代表散列桶再分布的累计统计
+type RedistributionStats struct {
+	// Count 代表改变了散列桶数量的再分布次数，后台再散列在迁移完成时计一次
+	Count uint64
+	// PairsMoved 代表再分布时被重新放入散列桶的键值对数量
+	PairsMoved uint64
+	// Duration 代表在散列段的锁的保护下进行再分布所花费的累计时间
+	Duration time.Duration
+}
+
+// redistributionCounter 代表再分布的累计计数，所有字段都以原子操作访问
+type redistributionCounter struct {
+	count      uint64
+	pairsMoved uint64
+	nanos      uint64
+}
+
+// record 用于记录自 start 以来移动了 moved 个键值对的一次迁移
+// 参数 finished 代表这次迁移是否完成了一次再分布
+func (rc *redistributionCounter) record(moved uint64, finished bool, start time.Time) {
+	atomic.AddUint64(&rc.nanos, uint64(time.Since(start)))
+	atomic.AddUint64(&rc.pairsMoved, moved)
+	if finished {
+		atomic.AddUint64(&rc.count, 1)
+	}
+}
+
+// lookupCounter 代表 Get 命中和未命中的累计次数，所有字段都以原子操作访问
+type lookupCounter struct {
+	hits   uint64
+	misses uint64
+}
+
+// record 用于记录一次 Get 是否命中
+func (lc *lookupCounter) record(hit bool) {
+	if hit {
+		atomic.AddUint64(&lc.hits, 1)
+	} else {
+		atomic.AddUint64(&lc.misses, 1)
+	}
+}
+
+func (c *myConcurrentMap) RedistributionStats() RedistributionStats {
+	rc := c.opts.redistributionCounter
+	if rc == nil {
+		return RedistributionStats{}
+	}
+	return RedistributionStats{
+		Count:      atomic.LoadUint64(&rc.count),
+		PairsMoved: atomic.LoadUint64(&rc.pairsMoved),
+		Duration:   time.Duration(atomic.LoadUint64(&rc.nanos)),
+	}
+}
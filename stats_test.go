@@ -0,0 +1,58 @@
+package cmap
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCmapRedistributionStats(t *testing.T) {
+	var hookCalls uint64
+	cm, _ := NewConcurrentMap(1, nil, WithStats(true),
+		WithRedistributeHook(func(segmentIndex int, oldBuckets, newBuckets int) {
+			atomic.AddUint64(&hookCalls, 1)
+		}))
+	if stats := cm.RedistributionStats(); stats != (RedistributionStats{}) {
+		t.Fatalf("Inconsistent stats: expected: %+v, actual: %+v", RedistributionStats{}, stats)
+	}
+	number := 10000
+	for i := 0; i < number; i++ {
+		cm.Put(fmt.Sprintf("key-%d", i), i)
+	}
+	stats := cm.RedistributionStats()
+	if stats.Count < 2 {
+		t.Fatalf("Too few redistributions: expected: >= %d, actual: %d", 2, stats.Count)
+	}
+	if stats.Count != atomic.LoadUint64(&hookCalls) {
+		t.Fatalf("Inconsistent redistribution count: expected: %d, actual: %d",
+			atomic.LoadUint64(&hookCalls), stats.Count)
+	}
+	// 每次再分布都会移动当时散列段中的全部键值对
+	if stats.PairsMoved < stats.Count || stats.PairsMoved > stats.Count*uint64(number) {
+		t.Fatalf("Inconsistent pairs moved: %d (redistributions: %d)", stats.PairsMoved, stats.Count)
+	}
+	if stats.Duration <= 0 {
+		t.Fatalf("Inconsistent duration: expected: > 0, actual: %v", stats.Duration)
+	}
+
+	cm2, _ := NewConcurrentMap(1, nil)
+	for i := 0; i < number; i++ {
+		cm2.Put(fmt.Sprintf("key-%d", i), i)
+	}
+	if stats := cm2.RedistributionStats(); stats != (RedistributionStats{}) {
+		t.Fatalf("Inconsistent stats: expected: %+v, actual: %+v", RedistributionStats{}, stats)
+	}
+}
+
+func TestCmapRedistributionStatsBackground(t *testing.T) {
+	cm, _ := NewConcurrentMap(1, nil, WithStats(true), WithBackgroundRehash(true))
+	number := 5000
+	for i := 0; i < number; i++ {
+		cm.Put(fmt.Sprintf("key-%d", i), i)
+	}
+	waitRehash(t, cm.(*myConcurrentMap).segments.Load().([]Segment)[0].(*segment))
+	stats := cm.RedistributionStats()
+	if stats.Count == 0 || stats.PairsMoved == 0 {
+		t.Fatalf("Inconsistent stats: expected: non-zero, actual: %+v", stats)
+	}
+}
@@ -0,0 +1,29 @@
+package cmap
+
+import "errors"
+
+// BackingStore 代表 map 未命中时读取的后备存储
+type BackingStore interface {
+	// 返回键对应的元素，第二个返回值表示是否存在
+	// 可能被多个 goroutine 并发调用
+	Get(key string) (interface{}, bool)
+}
+
+// errNotInStore 表示后备存储中也没有要读取的键
+var errNotInStore = errors.New("concurrent map: key not in backing store")
+
+// loadFromStore 通过 GetWithLoader 读取后备存储，因此对同一个键的并发未命中只会读取一次
+// 后备存储中也不存在的键不会被放入 map
+func (c *myConcurrentMap) loadFromStore(key string) (interface{}, error) {
+	element, err := c.GetWithLoader(key, func(key string) (interface{}, error) {
+		element, ok := c.opts.backingStore.Get(key)
+		if !ok || element == nil {
+			return nil, errNotInStore
+		}
+		return element, nil
+	})
+	if err == errNotInStore {
+		return nil, nil
+	}
+	return element, err
+}
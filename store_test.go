@@ -0,0 +1,74 @@
+package cmap
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// mockStore 用于记录每个键被读取的次数
+type mockStore struct {
+	data  map[string]interface{}
+	lock  sync.Mutex
+	calls map[string]int
+}
+
+func (ms *mockStore) Get(key string) (interface{}, bool) {
+	ms.lock.Lock()
+	ms.calls[key]++
+	ms.lock.Unlock()
+	time.Sleep(time.Millisecond)
+	element, ok := ms.data[key]
+	return element, ok
+}
+
+func (ms *mockStore) callsOf(key string) int {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	return ms.calls[key]
+}
+
+func TestCmapBackingStore(t *testing.T) {
+	store := &mockStore{
+		data:  map[string]interface{}{"a": 1, "b": 2},
+		calls: make(map[string]int),
+	}
+	cm, _ := NewConcurrentMap(2, nil, WithBackingStore(store))
+	cm.Put("local", 0)
+	if element := cm.Get("local"); element != 0 || store.callsOf("local") != 0 {
+		t.Fatalf("Inconsistent hit: element: %v, store calls: %d", element, store.callsOf("local"))
+	}
+	if element := cm.Get("a"); element != 1 {
+		t.Fatalf("Inconsistent element: expected: %v, actual: %v", 1, element)
+	}
+	if !cm.Contains("a") || cm.Len() != 2 {
+		t.Fatal("The loaded element is not cached!")
+	}
+	cm.Get("a")
+	if calls := store.callsOf("a"); calls != 1 {
+		t.Fatalf("Inconsistent store calls: expected: %d, actual: %d", 1, calls)
+	}
+	if element := cm.Get("missing"); element != nil || cm.Contains("missing") {
+		t.Fatalf("Inconsistent element of a missing key: %v", element)
+	}
+
+	var wg sync.WaitGroup
+	var wrong int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if cm.Get("b") != 2 {
+				atomic.AddInt32(&wrong, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if wrong != 0 {
+		t.Fatalf("%d concurrent reads got a wrong element", wrong)
+	}
+	if calls := store.callsOf("b"); calls != 1 {
+		t.Fatalf("Inconsistent store calls: expected: %d, actual: %d", 1, calls)
+	}
+}
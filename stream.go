@@ -0,0 +1,33 @@
+package cmap
+
+import "context"
+
+// Entry 代表一个键值对的快照
+type Entry struct {
+	Key     string
+	Element interface{}
+}
+
+// Stream 会启动一个 goroutine 逐个散列段地遍历 map，并将每个键值对发送到返回的通道中
+// 遍历结束后通道会被关闭
+// 注意！遍历是弱一致的；若不打算读完通道，请使用 StreamContext，否则 goroutine 会泄漏
+func (c *myConcurrentMap) Stream() <-chan Entry {
+	return c.StreamContext(context.Background())
+}
+
+// StreamContext 与 Stream 相同，但在 ctx 结束时会停止遍历并关闭通道
+func (c *myConcurrentMap) StreamContext(ctx context.Context) <-chan Entry {
+	ch := make(chan Entry)
+	go func() {
+		defer close(ch)
+		c.Range(func(key string, element interface{}) bool {
+			select {
+			case ch <- Entry{Key: key, Element: element}:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+	return ch
+}
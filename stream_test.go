@@ -0,0 +1,60 @@
+package cmap
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCmapStream(t *testing.T) {
+	number := 1000
+	testCases := genNoRepetitiveTestingPairs(number)
+	cm, _ := NewConcurrentMap(8, nil)
+	for _, p := range testCases {
+		cm.Put(p.Key(), p.Element())
+	}
+	seen := make(map[string]interface{})
+	for entry := range cm.Stream() {
+		seen[entry.Key] = entry.Element
+	}
+	if len(seen) != number {
+		t.Fatalf("Inconsistent entry count: expected: %d, actual: %d", number, len(seen))
+	}
+	for _, p := range testCases {
+		if seen[p.Key()] != p.Element() {
+			t.Fatalf("Inconsistent element: expected: %#v, actual: %#v (key: %s)",
+				p.Element(), seen[p.Key()], p.Key())
+		}
+	}
+}
+
+func TestCmapStreamContextCancel(t *testing.T) {
+	number := 1000
+	cm, _ := NewConcurrentMap(8, nil)
+	for _, p := range genNoRepetitiveTestingPairs(number) {
+		cm.Put(p.Key(), p.Element())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := cm.StreamContext(ctx)
+	for i := 0; i < 10; i++ {
+		<-ch
+	}
+	cancel()
+	// 通道被关闭说明生产者 goroutine 已经退出
+	count := 10
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				if count >= number {
+					t.Fatal("Stream isn't stopped by cancellation!")
+				}
+				return
+			}
+			count++
+		case <-timeout:
+			t.Fatal("Producer goroutine doesn't exit after cancellation!")
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package cmap
+
+import "runtime"
+
+// SyncMap 是 ConcurrentMap 的适配器，提供与 sync.Map 相同的方法集
+// 便于在抽象了 map 实现的代码中替换使用
+// 注意！键必须是 string 类型，否则会 panic
+// sync.Map 的方法不返回错误，因此写操作遇到调整并发量时会重试到调整结束为止，
+// 其他放入失败的情况（例如 nil 值、超出 WithMaxEntries 设置的容量）不做任何修改：
+// Store 静默返回，LoadOrStore 返回 nil 和 false
+type SyncMap struct {
+	cm ConcurrentMap
+}
+
+// NewSyncMap 会创建一个包装了给定 ConcurrentMap 的 SyncMap
+func NewSyncMap(cm ConcurrentMap) *SyncMap {
+	return &SyncMap{cm: cm}
+}
+
+// resizingReporter 代表能够报告是否正在调整并发量的 map
+// Delete 等写操作在调整期间只返回 false，需要借此与键不存在区分开
+type resizingReporter interface {
+	isResizing() bool
+}
+
+// 用于判断被包装的 map 是否正在调整并发量
+func (m *SyncMap) resizing() bool {
+	r, ok := m.cm.(resizingReporter)
+	return ok && r.isResizing()
+}
+
+func (m *SyncMap) Store(key, value interface{}) {
+	for {
+		_, err := m.cm.Put(key.(string), value)
+		if _, ok := err.(MapResizingError); !ok {
+			return
+		}
+		runtime.Gosched()
+	}
+}
+
+func (m *SyncMap) Load(key interface{}) (value interface{}, ok bool) {
+	value = m.cm.Get(key.(string))
+	return value, value != nil
+}
+
+func (m *SyncMap) LoadOrStore(key, value interface{}) (actual interface{}, loaded bool) {
+	for {
+		actual, loaded, err := m.cm.GetOrPut(key.(string), value)
+		if err == nil {
+			return actual, loaded
+		}
+		if _, ok := err.(MapResizingError); !ok {
+			return nil, false
+		}
+		runtime.Gosched()
+	}
+}
+
+func (m *SyncMap) LoadAndDelete(key interface{}) (value interface{}, loaded bool) {
+	for {
+		if value, loaded = m.cm.DeleteAndReturn(key.(string)); loaded || !m.resizing() {
+			return value, loaded
+		}
+		runtime.Gosched()
+	}
+}
+
+func (m *SyncMap) Delete(key interface{}) {
+	m.LoadAndDelete(key)
+}
+
+func (m *SyncMap) Range(f func(key, value interface{}) bool) {
+	m.cm.Range(func(key string, element interface{}) bool {
+		return f(key, element)
+	})
+}
@@ -0,0 +1,149 @@
+package cmap
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// syncMapLike 代表 sync.Map 的方法集
+type syncMapLike interface {
+	Store(key, value interface{})
+	Load(key interface{}) (value interface{}, ok bool)
+	LoadOrStore(key, value interface{}) (actual interface{}, loaded bool)
+	LoadAndDelete(key interface{}) (value interface{}, loaded bool)
+	Delete(key interface{})
+	Range(f func(key, value interface{}) bool)
+}
+
+func newTestingSyncMap(t *testing.T) *SyncMap {
+	cm, err := NewConcurrentMap(4, nil)
+	if err != nil {
+		t.Fatalf("An error occurs when new a concurrent map: %s", err)
+	}
+	return NewSyncMap(cm)
+}
+
+func TestSyncMapParity(t *testing.T) {
+	impls := map[string]syncMapLike{
+		"sync.Map": &sync.Map{},
+		"SyncMap":  newTestingSyncMap(t),
+	}
+	for name, m := range impls {
+		t.Run(name, func(t *testing.T) {
+			m.Store("a", 1)
+			if v, ok := m.Load("a"); !ok || v != 1 {
+				t.Fatalf("Inconsistent load: expected: (%#v, %v), actual: (%#v, %v)",
+					1, true, v, ok)
+			}
+			if v, ok := m.Load("b"); ok || v != nil {
+				t.Fatalf("Inconsistent load: expected: (%#v, %v), actual: (%#v, %v)",
+					nil, false, v, ok)
+			}
+			if v, loaded := m.LoadOrStore("a", 2); !loaded || v != 1 {
+				t.Fatalf("Inconsistent load or store: expected: (%#v, %v), actual: (%#v, %v)",
+					1, true, v, loaded)
+			}
+			if v, loaded := m.LoadOrStore("b", 2); loaded || v != 2 {
+				t.Fatalf("Inconsistent load or store: expected: (%#v, %v), actual: (%#v, %v)",
+					2, false, v, loaded)
+			}
+			m.Store("c", 3)
+			seen := make(map[interface{}]interface{})
+			m.Range(func(key, value interface{}) bool {
+				seen[key] = value
+				return true
+			})
+			if len(seen) != 3 || seen["a"] != 1 || seen["b"] != 2 || seen["c"] != 3 {
+				t.Fatalf("Inconsistent range result: %#v", seen)
+			}
+			var count int
+			m.Range(func(key, value interface{}) bool {
+				count++
+				return false
+			})
+			if count != 1 {
+				t.Fatalf("Range didn't stop: expected: %d, actual: %d", 1, count)
+			}
+			if v, loaded := m.LoadAndDelete("a"); !loaded || v != 1 {
+				t.Fatalf("Inconsistent load and delete: expected: (%#v, %v), actual: (%#v, %v)",
+					1, true, v, loaded)
+			}
+			if v, loaded := m.LoadAndDelete("a"); loaded || v != nil {
+				t.Fatalf("Inconsistent load and delete: expected: (%#v, %v), actual: (%#v, %v)",
+					nil, false, v, loaded)
+			}
+			m.Delete("b")
+			m.Delete("not exist")
+			if _, ok := m.Load("b"); ok {
+				t.Fatal("Key b still exists after deletion!")
+			}
+		})
+	}
+}
+
+func TestSyncMapLoadOrStoreInParallel(t *testing.T) {
+	m := newTestingSyncMap(t)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var stored int
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, loaded := m.LoadOrStore("key", i); !loaded {
+				mu.Lock()
+				stored++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if stored != 1 {
+		t.Fatalf("Inconsistent store count: expected: %d, actual: %d", 1, stored)
+	}
+}
+
+func TestSyncMapDuringResizeAndCapacity(t *testing.T) {
+	m := newTestingSyncMap(t)
+	m.Store("a", 1)
+	cm := m.cm.(*myConcurrentMap)
+	// 调整并发量期间的写操作会重试到调整结束为止
+	atomic.StoreInt32(&cm.resizing, 1)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		atomic.StoreInt32(&cm.resizing, 0)
+	}()
+	m.Store("b", 2)
+	if v, ok := m.Load("b"); !ok || v != 2 {
+		t.Fatalf("Inconsistent load after storing during resizing: expected: (%#v, %v), actual: (%#v, %v)",
+			2, true, v, ok)
+	}
+	atomic.StoreInt32(&cm.resizing, 1)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		atomic.StoreInt32(&cm.resizing, 0)
+	}()
+	if v, loaded := m.LoadAndDelete("a"); !loaded || v != 1 {
+		t.Fatalf("Inconsistent load and delete during resizing: expected: (%#v, %v), actual: (%#v, %v)",
+			1, true, v, loaded)
+	}
+
+	// 超出容量时不做任何修改，也不会 panic
+	limited, _ := NewConcurrentMap(1, nil, WithMaxEntries(1))
+	lm := NewSyncMap(limited)
+	lm.Store("a", 1)
+	lm.Store("b", 2)
+	if _, ok := lm.Load("b"); ok || limited.Len() != 1 {
+		t.Fatalf("Inconsistent map after exceeding the capacity: length: %d", limited.Len())
+	}
+	if actual, loaded := lm.LoadOrStore("c", 3); actual != nil || loaded {
+		t.Fatalf("Inconsistent load or store after exceeding the capacity: expected: (%#v, %v), actual: (%#v, %v)",
+			nil, false, actual, loaded)
+	}
+	if actual, loaded := lm.LoadOrStore("a", 4); actual != 1 || !loaded {
+		t.Fatalf("Inconsistent load or store of an existing key: expected: (%#v, %v), actual: (%#v, %v)",
+			1, true, actual, loaded)
+	}
+}
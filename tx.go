@@ -0,0 +1,114 @@
+package cmap
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// TxSegment 会在给定键所在的散列段的锁的保护下执行事务
+// 所有键必须位于同一个散列段中，否则返回 IllegalParameterError
+// f 的参数 view 包含 keys 中已存在的键值对，返回值 updates 和 deletes 会被原子地应用，
+// 若某个键同时出现在两者中，删除优先
+// updates 和 deletes 中只能包含 keys 中的键，元素也不能为 nil，否则不会应用任何修改并返回错误
+// 注意！事务对加锁的操作（如 CloneSegment）是隔离的，但不加锁的 Get 可能读到事务中间的单个键
+// 若 f 发生 panic 且被 WithCallbackRecovery 捕获，则不会应用任何修改并返回 CallbackPanicError
+// 若设置了 WithKeyNormalizer，view 中的键是规范化后的键
+// 元素已被 TakeElement 取走的键在 view 中对应 nil，热点键对应其当前的计数
+// 在 f 中调用当前 map 的方法可能导致死锁
+func (c *myConcurrentMap) TxSegment(keys []string,
+	f func(view map[string]interface{}) (updates map[string]interface{}, deletes []string)) error {
+	if len(keys) == 0 {
+		return newIllegalParameterError("no key in the transaction")
+	}
+	var evicted []Pair
+	// 在释放 resizeLock 之后调用
+	defer func() {
+		c.notifyEvicted(evicted)
+	}()
+	if err := c.lockForWrite(); err != nil {
+		return err
+	}
+	defer c.resizeLock.RUnlock()
+	segments := c.getSegments()
+	index := segmentIndex(c.opts.hash(c.normalizeKey(keys[0])), len(segments))
+	allowed := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		key = c.normalizeKey(key)
+		if segmentIndex(c.opts.hash(key), len(segments)) != index {
+			return newIllegalParameterError(
+				fmt.Sprintf("keys %s and %s are in different segments", keys[0], key))
+		}
+		allowed[key] = struct{}{}
+	}
+
+	var err error
+	segments[index].Atomic(func(tx SegmentTx) {
+		view := make(map[string]interface{}, len(allowed))
+		for key := range allowed {
+			if p := tx.Get(key); p != nil {
+				element, dErr := c.decodeElement(p.Element())
+				if dErr != nil {
+					err = dErr
+					return
+				}
+				view[key] = element
+			}
+		}
+		var updates map[string]interface{}
+		var deletes []string
+		if !c.opts.invokeCallback(func() {
+			updates, deletes = f(view)
+		}) {
+			err = newCallbackPanicError()
+			return
+		}
+		// 先校验全部修改再应用，保证要么全部生效要么全部不生效
+		pairs := make([]Pair, 0, len(updates))
+		for key, element := range updates {
+			if _, ok := allowed[c.normalizeKey(key)]; !ok {
+				err = newIllegalParameterError(fmt.Sprintf("key %s is not in the transaction", key))
+				return
+			}
+			p, pErr := c.newPair(key, element)
+			if pErr != nil {
+				err = pErr
+				return
+			}
+			pairs = append(pairs, p)
+		}
+		for i, key := range deletes {
+			deletes[i] = c.normalizeKey(key)
+			if _, ok := allowed[deletes[i]]; !ok {
+				err = newIllegalParameterError(fmt.Sprintf("key %s is not in the transaction", key))
+				return
+			}
+		}
+		// 设置了 WithMaxEntries 时一次性占用全部新键的名额，名额不足时不做任何修改
+		var acquired bool
+		if c.opts.maxEntries > 0 {
+			newKeys := make(map[string]struct{})
+			for _, p := range pairs {
+				if tx.Get(p.Key()) == nil {
+					newKeys[p.Key()] = struct{}{}
+				}
+			}
+			if !c.acquireEntries(uint64(len(newKeys))) {
+				err = newCapacityExceededError(c.opts.maxEntries)
+				return
+			}
+			acquired = true
+		}
+		for _, p := range pairs {
+			if ok, _ := tx.Put(p); ok && !acquired {
+				atomic.AddUint64(&c.total, 1)
+			}
+		}
+		for _, key := range deletes {
+			if deleted, ok := tx.Delete(key); ok {
+				decreaseUint64(&c.total)
+				evicted = append(evicted, deleted)
+			}
+		}
+	})
+	return err
+}
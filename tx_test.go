@@ -0,0 +1,168 @@
+package cmap
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// genKeysInSegment 用于生成 number 个位于 cm 的同一散列段中的键，并返回散列段的索引
+func genKeysInSegment(cm ConcurrentMap, number int) ([]string, int) {
+	m := cm.(*myConcurrentMap)
+	concurrency := cm.Concurrency()
+	index := segmentIndex(m.opts.hash("key-0"), concurrency)
+	keys := []string{"key-0"}
+	for i := 1; len(keys) < number; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if segmentIndex(m.opts.hash(key), concurrency) == index {
+			keys = append(keys, key)
+		}
+	}
+	return keys, index
+}
+
+// genKeyInOtherSegment 用于生成一个不在索引为 index 的散列段中的键
+func genKeyInOtherSegment(cm ConcurrentMap, index int) string {
+	m := cm.(*myConcurrentMap)
+	for i := 0; ; i++ {
+		key := fmt.Sprintf("other-%d", i)
+		if segmentIndex(m.opts.hash(key), cm.Concurrency()) != index {
+			return key
+		}
+	}
+}
+
+func TestCmapTxSegment(t *testing.T) {
+	cm, _ := NewConcurrentMap(8, nil)
+	keys, _ := genKeysInSegment(cm, 3)
+	cm.Put(keys[0], 1)
+	cm.Put(keys[1], 2)
+	err := cm.TxSegment(keys, func(view map[string]interface{}) (map[string]interface{}, []string) {
+		if len(view) != 2 || view[keys[0]] != 1 || view[keys[1]] != 2 {
+			t.Fatalf("Inconsistent view: %#v", view)
+		}
+		updates := map[string]interface{}{
+			keys[0]: view[keys[0]].(int) + view[keys[1]].(int),
+			keys[2]: "new",
+		}
+		return updates, []string{keys[1]}
+	})
+	if err != nil {
+		t.Fatalf("An error occurs when executing a transaction: %s", err)
+	}
+	if actual := cm.Get(keys[0]); actual != 3 {
+		t.Fatalf("Inconsistent element: expected: %#v, actual: %#v", 3, actual)
+	}
+	if actual := cm.Get(keys[1]); actual != nil {
+		t.Fatalf("Inconsistent element: expected: %#v, actual: %#v", nil, actual)
+	}
+	if actual := cm.Get(keys[2]); actual != "new" {
+		t.Fatalf("Inconsistent element: expected: %#v, actual: %#v", "new", actual)
+	}
+	if cm.Len() != 2 {
+		t.Fatalf("Inconsistent size: expected: %d, actual: %d", 2, cm.Len())
+	}
+}
+
+func TestCmapTxSegmentError(t *testing.T) {
+	cm, _ := NewConcurrentMap(8, nil)
+	keys, index := genKeysInSegment(cm, 2)
+	other := genKeyInOtherSegment(cm, index)
+	called := false
+	err := cm.TxSegment([]string{keys[0], other}, func(view map[string]interface{}) (map[string]interface{}, []string) {
+		called = true
+		return nil, nil
+	})
+	if err == nil || called {
+		t.Fatal("No error when executing a transaction across segments, but should not be the case!")
+	}
+	cm.Put(keys[1], "old")
+	testCases := map[string]func(view map[string]interface{}) (map[string]interface{}, []string){
+		"update outside": func(view map[string]interface{}) (map[string]interface{}, []string) {
+			return map[string]interface{}{keys[0]: "new", "outside": 1}, nil
+		},
+		"delete outside": func(view map[string]interface{}) (map[string]interface{}, []string) {
+			return map[string]interface{}{keys[0]: "new"}, []string{keys[1], "outside"}
+		},
+		"nil element": func(view map[string]interface{}) (map[string]interface{}, []string) {
+			return map[string]interface{}{keys[0]: "new", keys[1]: nil}, nil
+		},
+	}
+	for name, f := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if err := cm.TxSegment(keys, f); err == nil {
+				t.Fatal("No error when applying an invalid transaction, but should not be the case!")
+			}
+			if cm.Get(keys[0]) != nil || cm.Get(keys[1]) != "old" {
+				t.Fatal("An invalid transaction is partially applied!")
+			}
+		})
+	}
+}
+
+func TestCmapTxSegmentIsolation(t *testing.T) {
+	cm, _ := NewConcurrentMap(8, nil)
+	keys, index := genKeysInSegment(cm, 2)
+	total := 100
+	cm.Put(keys[0], total)
+	cm.Put(keys[1], 0)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			cm.TxSegment(keys, func(view map[string]interface{}) (map[string]interface{}, []string) {
+				from, to := keys[i%2], keys[(i+1)%2]
+				amount := view[from].(int) / 2
+				return map[string]interface{}{
+					from: view[from].(int) - amount,
+					to:   view[to].(int) + amount,
+				}, nil
+			})
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		clone, _ := cm.CloneSegment(index)
+		if sum := clone[keys[0]].(int) + clone[keys[1]].(int); sum != total {
+			t.Fatalf("Observed a partially applied transaction: sum: %d", sum)
+		}
+	}
+	wg.Wait()
+}
+
+func TestCmapTxSegmentPanic(t *testing.T) {
+	cm, _ := NewConcurrentMap(8, nil)
+	keys, _ := genKeysInSegment(cm, 2)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("The panic in the transaction is not propagated!")
+			}
+		}()
+		cm.TxSegment(keys, func(view map[string]interface{}) (map[string]interface{}, []string) {
+			panic("tx")
+		})
+	}()
+	// 若散列段仍被锁住，这里会死锁
+	if _, err := cm.Put(keys[0], 1); err != nil {
+		t.Fatalf("An error occurs when putting a pair after a panic: %s", err)
+	}
+
+	var recovered interface{}
+	cm, _ = NewConcurrentMap(8, nil, WithCallbackRecovery(func(r interface{}) {
+		recovered = r
+	}))
+	cm.Put(keys[0], 1)
+	err := cm.TxSegment(keys, func(view map[string]interface{}) (map[string]interface{}, []string) {
+		panic("tx")
+	})
+	if _, ok := err.(CallbackPanicError); !ok {
+		t.Fatalf("Inconsistent error type: expected: %T, actual: %T", CallbackPanicError{}, err)
+	}
+	if recovered != "tx" {
+		t.Fatalf("Inconsistent recovered value: expected: %#v, actual: %#v", "tx", recovered)
+	}
+	if _, err := cm.Put(keys[1], 2); err != nil {
+		t.Fatalf("An error occurs when putting a pair after a panic: %s", err)
+	}
+}
@@ -1,5 +1,59 @@
 package cmap
 
+import (
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"hash/crc64"
+	"hash/fnv"
+	"sync/atomic"
+	"time"
+)
+
+// HashAlgo 代表内置散列算法的类型。
+type HashAlgo uint8
+
+const (
+	// HASH_ALGO_BKDR 代表BKDR哈希算法，也是默认的散列算法。
+	HASH_ALGO_BKDR HashAlgo = 0
+	// HASH_ALGO_FNV1A 代表64位的FNV-1a哈希算法。
+	HASH_ALGO_FNV1A HashAlgo = 1
+	// HASH_ALGO_FNV1 代表64位的FNV-1哈希算法。
+	HASH_ALGO_FNV1 HashAlgo = 2
+	// HASH_ALGO_CRC64 代表使用ECMA多项式的CRC-64校验算法。
+	HASH_ALGO_CRC64 HashAlgo = 3
+)
+
+// hashFuncOf 用于返回给定散列算法对应的散列函数。
+// 若算法未知则返回 nil。
+func hashFuncOf(algo HashAlgo) func(str string) uint64 {
+	switch algo {
+	case HASH_ALGO_BKDR:
+		return hash
+	case HASH_ALGO_FNV1A:
+		return hashFNV1a
+	case HASH_ALGO_FNV1:
+		return hashFNV1
+	case HASH_ALGO_CRC64:
+		return hashCRC64
+	default:
+		return nil
+	}
+}
+
+// decreaseUint64 用于以原子操作将 addr 指向的计数减一并返回新值。
+// 若计数已经为零则不做任何修改，第二个返回值为 false。
+func decreaseUint64(addr *uint64) (uint64, bool) {
+	for {
+		old := atomic.LoadUint64(addr)
+		if old == 0 {
+			return 0, false
+		}
+		if atomic.CompareAndSwapUint64(addr, old, old-1) {
+			return old - 1, true
+		}
+	}
+}
+
 // hash 用于计算给定字符串的哈希值的整数形式。
 // 本函数实现了BKDR哈希算法。
 func hash(str string) uint64 {
@@ -11,6 +65,57 @@ func hash(str string) uint64 {
 	return (hash & 0x7FFFFFFFFFFFFFFF)
 }
 
+// hashFNV1a 用于以FNV-1a哈希算法计算给定字符串的哈希值。
+func hashFNV1a(str string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(str))
+	return h.Sum64()
+}
+
+// seededHash 用于返回以 seed 为种子的FNV-1a哈希函数。
+// 种子会先于键被混入哈希状态，因此碰撞的键集合依赖于种子。
+func seededHash(seed uint64) func(str string) uint64 {
+	const offset64, prime64 = 14695981039346656037, 1099511628211
+	init := uint64(offset64)
+	for i := 0; i < 8; i++ {
+		init ^= (seed >> (8 * i)) & 0xff
+		init *= prime64
+	}
+	return func(str string) uint64 {
+		h := init
+		for i := 0; i < len(str); i++ {
+			h ^= uint64(str[i])
+			h *= prime64
+		}
+		return h
+	}
+}
+
+// randomSeed 用于生成一个随机的散列种子。
+// 优先使用 crypto/rand，失败时退回到当前时间。
+func randomSeed() uint64 {
+	var b [8]byte
+	if _, err := cryptorand.Read(b[:]); err != nil {
+		return uint64(time.Now().UnixNano())
+	}
+	return binary.LittleEndian.Uint64(b[:])
+}
+
+// hashFNV1 用于以FNV-1哈希算法计算给定字符串的哈希值。
+func hashFNV1(str string) uint64 {
+	h := fnv.New64()
+	h.Write([]byte(str))
+	return h.Sum64()
+}
+
+// crc64Table 代表CRC-64校验所用的ECMA多项式表。
+var crc64Table = crc64.MakeTable(crc64.ECMA)
+
+// hashCRC64 用于以CRC-64校验算法计算给定字符串的哈希值。
+func hashCRC64(str string) uint64 {
+	return crc64.Checksum([]byte(str), crc64Table)
+}
+
 // hash 用于计算给定字符串的哈希值的整数形式。
 // func hash(str string) uint64 {
 // 	h := md5.Sum([]byte(str))
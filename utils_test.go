@@ -0,0 +1,96 @@
+package cmap
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+var testingHashAlgos = map[string]HashAlgo{
+	"BKDR":  HASH_ALGO_BKDR,
+	"FNV1a": HASH_ALGO_FNV1A,
+	"FNV1":  HASH_ALGO_FNV1,
+	"CRC64": HASH_ALGO_CRC64,
+}
+
+func TestHashFuncOf(t *testing.T) {
+	for name, algo := range testingHashAlgos {
+		if hashFuncOf(algo) == nil {
+			t.Fatalf("Not found hash function for algorithm %s!", name)
+		}
+	}
+	if hashFuncOf(HashAlgo(255)) != nil {
+		t.Fatal("Found hash function for an unknown algorithm!")
+	}
+}
+
+func TestCmapWithHashAlgorithm(t *testing.T) {
+	number := 1000
+	keys := make([]string, number)
+	for i := 0; i < number; i++ {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	for name, algo := range testingHashAlgos {
+		t.Run(name, func(t *testing.T) {
+			concurrency := 16
+			cm, _ := NewConcurrentMap(concurrency, nil, WithHashAlgorithm(algo))
+			hashFunc := hashFuncOf(algo)
+			for i, key := range keys {
+				cm.Put(key, i)
+			}
+			usedSegments := 0
+			for _, s := range cm.(*myConcurrentMap).getSegments() {
+				if s.Size() > 0 {
+					usedSegments++
+				}
+				s.Range(func(p Pair) bool {
+					if p.Hash() != hashFunc(p.Key()) {
+						t.Fatalf("Inconsistent hash: expected: %d, actual: %d (key: %s)",
+							hashFunc(p.Key()), p.Hash(), p.Key())
+					}
+					return true
+				})
+			}
+			if usedSegments < 2 {
+				t.Fatalf("Keys are badly distributed: only %d of %d segments used",
+					usedSegments, concurrency)
+			}
+			for i, key := range keys {
+				if actual := cm.Get(key); actual != i {
+					t.Fatalf("Inconsistent element: expected: %#v, actual: %#v (key: %s)",
+						i, actual, key)
+				}
+			}
+			for _, key := range keys {
+				if !cm.Delete(key) {
+					t.Fatalf("Couldn't delete key %s!", key)
+				}
+			}
+			if cm.Len() != 0 {
+				t.Fatalf("Inconsistent size: expected: %d, actual: %d", 0, cm.Len())
+			}
+		})
+	}
+}
+
+func TestDecreaseUint64(t *testing.T) {
+	var count uint64
+	if n, ok := decreaseUint64(&count); ok || n != 0 {
+		t.Fatalf("Inconsistent decrease result: expected: (%d, %v), actual: (%d, %v)",
+			0, false, n, ok)
+	}
+	number := 100
+	count = uint64(number / 2)
+	var wg sync.WaitGroup
+	for i := 0; i < number; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			decreaseUint64(&count)
+		}()
+	}
+	wg.Wait()
+	if count != 0 {
+		t.Fatalf("Inconsistent count: expected: %d, actual: %d", 0, count)
+	}
+}
@@ -0,0 +1,54 @@
+package cmap
+
+// WarmFrom 会先通过 src 的 Range 收集要复制的键值对，
+// 再按目标散列段分组，每个散列段只加一次锁地放入同组的所有键值对
+// 若 filter 为 nil 则复制全部键值对，元素已被取走的键会被跳过
+// 返回成功放入（包括替换已有元素）的数量
+func (c *myConcurrentMap) WarmFrom(src ConcurrentMap,
+	filter func(key string, element interface{}) bool) int {
+	var pairs []Pair
+	src.Range(func(key string, element interface{}) bool {
+		if element == nil {
+			return true
+		}
+		if filter != nil {
+			var accepted bool
+			if !c.opts.invokeCallback(func() {
+				accepted = filter(key, element)
+			}) {
+				return false
+			}
+			if !accepted {
+				return true
+			}
+		}
+		if p, err := c.newPair(key, element); err == nil {
+			pairs = append(pairs, p)
+		}
+		return true
+	})
+	if len(pairs) == 0 {
+		return 0
+	}
+	if err := c.lockForWrite(); err != nil {
+		return 0
+	}
+	defer c.resizeLock.RUnlock()
+	segments := c.getSegments()
+	groups := make(map[int][]Pair)
+	for _, p := range pairs {
+		index := segmentIndex(p.Hash(), len(segments))
+		groups[index] = append(groups[index], p)
+	}
+	var copied int
+	for index, group := range groups {
+		segments[index].Atomic(func(tx SegmentTx) {
+			for _, p := range group {
+				if _, err := c.putInTx(tx, p); err == nil {
+					copied++
+				}
+			}
+		})
+	}
+	return copied
+}
@@ -0,0 +1,43 @@
+package cmap
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCmapWarmFrom(t *testing.T) {
+	src, _ := NewConcurrentMap(4, nil)
+	for i := 0; i < 100; i++ {
+		src.Put(fmt.Sprintf("hot-%d", i), i)
+		src.Put(fmt.Sprintf("cold-%d", i), i)
+	}
+	dst, _ := NewConcurrentMap(8, nil)
+	dst.Put("hot-0", -1)
+	dst.Put("own", 1)
+	copied := dst.WarmFrom(src, func(key string, element interface{}) bool {
+		return strings.HasPrefix(key, "hot-")
+	})
+	if copied != 100 {
+		t.Fatalf("Inconsistent copied count: expected: %d, actual: %d", 100, copied)
+	}
+	if dst.Len() != 101 {
+		t.Fatalf("Inconsistent map length: expected: %d, actual: %d", 101, dst.Len())
+	}
+	for i := 0; i < 100; i++ {
+		if actual := dst.Get(fmt.Sprintf("hot-%d", i)); actual != i {
+			t.Fatalf("Inconsistent element of hot-%d: expected: %d, actual: %v", i, i, actual)
+		}
+		if dst.Contains(fmt.Sprintf("cold-%d", i)) {
+			t.Fatalf("Filtered key cold-%d is copied!", i)
+		}
+	}
+	if dst.Get("own") != 1 {
+		t.Fatal("Existing key own is lost!")
+	}
+
+	all, _ := NewConcurrentMap(2, nil)
+	if copied := all.WarmFrom(src, nil); copied != 200 || all.Len() != 200 {
+		t.Fatalf("Inconsistent copied count: expected: %d, actual: %d (length: %d)", 200, copied, all.Len())
+	}
+}